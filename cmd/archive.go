@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/archive"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkArchive checks the archive settings of cfg, so that a typo in a
+// format or glob is reported before anything is built.
+func checkArchive(cfg *config.Config) error {
+	if cfg.Archive != "auto" && !archive.ValidFormat(cfg.Archive) {
+		return fmt.Errorf("unknown archive format %q, should be auto or one of %s",
+			cfg.Archive, strings.Join(archive.Formats, ", "))
+	}
+
+	_, err := archiveFiles(cfg.ArchiveFiles)
+	return err
+}
+
+// archiveStep packages the binary of result, and the other files of the
+// build, with the extra files.
+func archiveStep(cfg *config.Config, result *buildResult) ([]string, error) {
+	binary := result.Output
+	format := archiveFormat(cfg, result)
+
+	name := strings.TrimSuffix(binary, pkg.OutputExt(cfg.BuildMode, result.Platform.OS))
+	if cfg.ArchiveName != "" {
+		var err error
+		name, err = pkg.RenderTemplate(cfg, result.Platform, result.Path, "archive-name", cfg.ArchiveName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	output, err := filepath.Abs(name + "." + format)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := archiveDir(cfg, result)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := archiveFiles(cfg.ArchiveFiles)
+	if err != nil {
+		return nil, err
+	}
+	entries := []archive.Entry{{Name: filepath.Base(binary), Path: binary}}
+	for _, extra := range result.Extra {
+		entries = append(entries, archive.Entry{Name: filepath.Base(extra), Path: extra})
+	}
+	entries = append(entries, files...)
+	for i := range entries {
+		entries[i].Name = path.Join(dir, entries[i].Name)
+	}
+
+	return []string{output}, archive.Write(output, format, entries, buildTime(cfg))
+}
+
+// archiveFormat returns the format of the archive of result.
+func archiveFormat(cfg *config.Config, result *buildResult) string {
+	if cfg.Archive == "auto" {
+		return archive.DefaultFormat(result.Platform.OS)
+	}
+
+	return cfg.Archive
+}
+
+// archiveDir returns the directory wrapping the files in the archive of
+// result, empty if there is none.
+func archiveDir(cfg *config.Config, result *buildResult) (string, error) {
+	if cfg.ArchiveDir == "" {
+		return "", nil
+	}
+
+	return pkg.RenderTemplate(cfg, result.Platform, result.Path, "archive-dir", cfg.ArchiveDir)
+}
+
+// archiveFiles returns the files matching the globs, with the files in
+// matching directories, named by their path relative to the working
+// directory. Files outside of it are named by their base name. A glob
+// matching nothing is an error.
+func archiveFiles(globs []string) ([]archive.Entry, error) {
+	var entries []archive.Entry
+	seen := make(map[string]bool)
+	for _, glob := range globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("archive file %q: %s", glob, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("archive file %q matches no files", glob)
+		}
+
+		for _, match := range matches {
+			err := filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+
+				file = filepath.Clean(file)
+				if seen[file] {
+					return nil
+				}
+				seen[file] = true
+
+				name := file
+				if filepath.IsAbs(name) || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+					name = filepath.Base(name)
+				}
+				entries = append(entries, archive.Entry{Name: filepath.ToSlash(name), Path: file})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// buildTime is the time of the files in archives: the commit time, or
+// SOURCE_DATE_EPOCH, so that archives of the same commit are identical.
+// Outside of a git checkout it is a fixed time, the earliest zip allows.
+func buildTime(cfg *config.Config) time.Time {
+	if git := cfg.GitInfo(); git.Commit != stamp.Unknown().Commit || os.Getenv("SOURCE_DATE_EPOCH") != "" {
+		if t, err := time.Parse(time.RFC3339, git.Built); err == nil {
+			return t
+		}
+	}
+
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
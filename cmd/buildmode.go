@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"os"
+)
+
+// buildModeCheck checks the build modes of the jobs before anything is
+// built, reading the platforms of the go command for the first job
+// using another mode than the default.
+type buildModeCheck struct {
+	dist   map[string]pkg.DistPlatform
+	warned map[string]bool
+}
+
+// Check checks the build mode of a job for platform, cfg being its
+// configuration. Modes on ports that aren't first-class, whose breakages
+// don't hold up Go releases, only get a warning.
+func (c *buildModeCheck) Check(cfg *config.Config, platform config.Platform) error {
+	switch cfg.BuildMode {
+	case "", "default", "exe":
+		return nil
+	}
+
+	if c.dist == nil {
+		dist, err := pkg.GoDistList(cfg.GoCmd)
+		if err != nil {
+			return err
+		}
+		c.dist = dist
+		c.warned = make(map[string]bool)
+	}
+	if err := pkg.CheckBuildMode(cfg, platform, c.dist); err != nil {
+		return err
+	}
+
+	key := platform.String() + " " + cfg.BuildMode
+	if !c.dist[platform.String()].FirstClass && !c.warned[key] {
+		c.warned[key] = true
+		fmt.Fprintf(os.Stderr, "Warning: %s is not a first-class port, -buildmode=%s is less tested on it\n",
+			platform.String(), cfg.BuildMode)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/checksum"
+	"github.com/mitchellh/gox/pkg/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumsStep writes the checksums of the artifacts of the successful
+// builds and of the image, returning the checksum file followed by the
+// sidecars. Only the files of this run are listed, whatever else is in the
+// output directories.
+func checksumsStep(cfg *config.Config, results []buildResult, release []buildStep) ([]string, error) {
+	files := releaseArtifacts(results, release)
+
+	path := cfg.ChecksumsFile
+	if path == "" {
+		path = filepath.Join(commonDir(files), checksum.FileName(cfg.Checksums))
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []string{path}
+	sums := make([]checksum.Sum, 0, len(files))
+	for _, file := range files {
+		hex, err := checksum.File(cfg.Checksums, file)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := filepath.Rel(filepath.Dir(path), file)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, checksum.Sum{Name: filepath.ToSlash(name), Hex: hex})
+
+		if cfg.ChecksumsSidecars {
+			sidecar := checksum.Sum{Name: filepath.Base(file), Hex: hex}
+			if err := writeChecksums(file+checksum.Extension(cfg.Checksums), []checksum.Sum{sidecar}); err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, file+checksum.Extension(cfg.Checksums))
+		}
+	}
+	sort.Slice(sums, func(i, j int) bool { return sums[i].Name < sums[j].Name })
+
+	return outputs, writeChecksums(path, sums)
+}
+
+func writeChecksums(path string, sums []checksum.Sum) error {
+	var b strings.Builder
+	if err := checksum.Write(&b, sums); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// commonDir returns the deepest directory containing all the files, or the
+// working directory if there are none.
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return "."
+	}
+
+	dir := filepath.Dir(files[0])
+	for _, file := range files[1:] {
+		for !strings.HasPrefix(file, dir+string(os.PathSeparator)) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return dir
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/version"
+	"github.com/spf13/pflag"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ciEntry is one entry of a CI matrix: a runner building part of the jobs.
+type ciEntry struct {
+	Name  string `json:"name"`
+	OS    string `json:"os,omitempty"`
+	Arch  string `json:"arch,omitempty"`
+	Shard string `json:"shard,omitempty"`
+
+	// Command is the gox command line the entry runs.
+	Command string `json:"command"`
+}
+
+// planOnlyFlags are the flags of "gox plan" that aren't passed on to the
+// gox commands of a CI matrix.
+var planOnlyFlags = map[string]bool{
+	"json":        true,
+	"emit-script": true,
+	"ci":          true,
+	"ci-shards":   true,
+	"shard":       true,
+}
+
+// platformFlags select the platforms, they are replaced with "--osarch" in
+// per-platform entries.
+var platformFlags = map[string]bool{
+	"os":     true,
+	"arch":   true,
+	"osarch": true,
+	"all":    true,
+}
+
+// ciEntries returns an entry per platform, or shards entries when shards
+// is positive, each running gox with the flags that were set on the plan.
+// With universal, the darwin platforms merged into universal binaries get
+// a single darwin/universal entry.
+func ciEntries(flags *pflag.FlagSet, packages []string, platforms []config.Platform, shards int, universal bool) []ciEntry {
+	var base []string
+	flags.Visit(func(f *pflag.Flag) {
+		if planOnlyFlags[f.Name] || (shards <= 0 && platformFlags[f.Name]) {
+			return
+		}
+
+		base = append(base, flagArgs(f)...)
+	})
+
+	var entries []ciEntry
+	if shards > 0 {
+		for i := 1; i <= shards; i++ {
+			shard := fmt.Sprintf("%d/%d", i, shards)
+			entries = append(entries, ciEntry{
+				Name:    "shard " + shard,
+				Shard:   shard,
+				Command: goxCommand(base, "--shard="+shard, packages),
+			})
+		}
+
+		return entries
+	}
+
+	sorted := make([]string, 0, len(platforms))
+	byName := make(map[string]config.Platform)
+	for _, platform := range platforms {
+		sorted = append(sorted, platform.String())
+		byName[platform.String()] = platform
+	}
+	sort.Strings(sorted)
+
+	var darwin []string
+	for _, name := range sorted {
+		platform := byName[name]
+		if universal && isUniversalArch(platform) {
+			darwin = append(darwin, name)
+			if len(darwin) < len(universalArches) {
+				continue
+			}
+			entries = append(entries, ciEntry{
+				Name:    universalPlatform.String(),
+				OS:      universalPlatform.OS,
+				Arch:    universalPlatform.Arch,
+				Command: goxCommand(base, "--osarch="+strings.Join(darwin, " "), packages),
+			})
+			continue
+		}
+		entries = append(entries, ciEntry{
+			Name:    name,
+			OS:      platform.OS,
+			Arch:    platform.Arch,
+			Command: goxCommand(base, "--osarch="+name, packages),
+		})
+	}
+
+	return entries
+}
+
+// flagArgs renders a flag that was set on the command line back into
+// arguments.
+func flagArgs(f *pflag.Flag) []string {
+	// Defines are repeated, their values may contain commas.
+	if define, ok := f.Value.(pflag.SliceValue); ok && f.Value.Type() == "name=value" {
+		var args []string
+		for _, v := range define.GetSlice() {
+			args = append(args, "--"+f.Name+"="+v)
+		}
+		return args
+	}
+
+	value := f.Value.String()
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		value = strings.Join(slice.GetSlice(), ",")
+	}
+	if f.Value.Type() == "bool" && value == "true" {
+		return []string{"--" + f.Name}
+	}
+
+	return []string{"--" + f.Name + "=" + value}
+}
+
+func goxCommand(base []string, selector string, packages []string) string {
+	parts := []string{"gox"}
+	for _, arg := range base {
+		parts = append(parts, pkg.ShellQuote(arg))
+	}
+	parts = append(parts, pkg.ShellQuote(selector))
+	for _, p := range packages {
+		parts = append(parts, pkg.ShellQuote(p))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// templateAction matches the actions of a path template.
+var templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// ciPaths returns the paths the CI jobs upload once they are done: the
+// directories the outputs, archives, checksum file and image of the
+// platforms are written to, or globs matching them when they are written
+// next to other files.
+func ciPaths(cfg *config.Config, platforms []config.Platform) ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(template string) {
+		if template == "" {
+			return
+		}
+		p := templatePath(relPath(template))
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, platform := range platforms {
+		jobCfg, _, err := jobConfig(cfg, platform)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", platform.String(), err)
+		}
+		add(jobCfg.Output)
+		if jobCfg.Archive != "" {
+			add(jobCfg.ArchiveName)
+		}
+	}
+	add(cfg.ChecksumsFile)
+	add(cfg.OCI)
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// templatePath returns what to upload for the files written by a path
+// template: the directory before its first action, or a glob of the
+// template when its actions are in the file name. The glob also matches
+// the extensions and the signature and checksum files added to the name.
+func templatePath(template string) string {
+	template = path.Clean(template)
+	elems := strings.Split(template, "/")
+	for i, elem := range elems[:len(elems)-1] {
+		if i > 0 && templateAction.MatchString(elem) {
+			return strings.Join(elems[:i], "/")
+		}
+	}
+
+	glob := templateAction.ReplaceAllString(template, "*") + "*"
+	for strings.Contains(glob, "**") {
+		glob = strings.Replace(glob, "**", "*", -1)
+	}
+	return glob
+}
+
+// goxInstall returns the command installing this version of gox on the
+// runners, or the latest one for development builds.
+func goxInstall() string {
+	v := version.VERSION
+	switch {
+	case v == "" || v == "dev":
+		v = "latest"
+	case !strings.HasPrefix(v, "v"):
+		v = "v" + v
+	}
+
+	return "go install github.com/mitchellh/gox@" + v
+}
+
+// writeCI writes the entries as a CI configuration in the given format,
+// uploading paths once the gox command of an entry is done.
+func writeCI(w io.Writer, format string, entries []ciEntry, paths []string) error {
+	switch format {
+	case "json-matrix":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Include []ciEntry `json:"include"`
+		}{entries})
+	case "github":
+		return writeGitHub(w, entries, paths)
+	case "gitlab":
+		return writeGitLab(w, entries, paths)
+	default:
+		return fmt.Errorf("unknown CI format %q, expected github, gitlab or json-matrix", format)
+	}
+}
+
+func writeGitHub(w io.Writer, entries []ciEntry, paths []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Generated by \"gox plan --ci github\".\n")
+	fmt.Fprintf(bw, "jobs:\n")
+	fmt.Fprintf(bw, "  gox:\n")
+	fmt.Fprintf(bw, "    name: gox ${{ matrix.name }}\n")
+	fmt.Fprintf(bw, "    runs-on: ubuntu-latest\n")
+	fmt.Fprintf(bw, "    strategy:\n")
+	fmt.Fprintf(bw, "      fail-fast: false\n")
+	fmt.Fprintf(bw, "      matrix:\n")
+	fmt.Fprintf(bw, "        include:\n")
+	for _, entry := range entries {
+		fmt.Fprintf(bw, "          - name: %s\n", yamlString(entry.Name))
+		fmt.Fprintf(bw, "            command: %s\n", yamlString(entry.Command))
+	}
+	fmt.Fprintf(bw, "    steps:\n")
+	fmt.Fprintf(bw, "      - uses: actions/checkout@v4\n")
+	fmt.Fprintf(bw, "      - uses: actions/setup-go@v5\n")
+	fmt.Fprintf(bw, "        with:\n")
+	fmt.Fprintf(bw, "          go-version-file: go.mod\n")
+	fmt.Fprintf(bw, "      - run: %s\n", goxInstall())
+	fmt.Fprintf(bw, "      - run: ${{ matrix.command }}\n")
+	if len(paths) > 0 {
+		fmt.Fprintf(bw, "      - uses: actions/upload-artifact@v4\n")
+		fmt.Fprintf(bw, "        with:\n")
+		fmt.Fprintf(bw, "          name: gox-${{ strategy.job-index }}\n")
+		fmt.Fprintf(bw, "          path: |\n")
+		for _, p := range paths {
+			fmt.Fprintf(bw, "            %s\n", p)
+		}
+	}
+	return bw.Flush()
+}
+
+func writeGitLab(w io.Writer, entries []ciEntry, paths []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Generated by \"gox plan --ci gitlab\".\n")
+	fmt.Fprintf(bw, "gox:\n")
+	fmt.Fprintf(bw, "  image: golang:latest\n")
+	fmt.Fprintf(bw, "  parallel:\n")
+	fmt.Fprintf(bw, "    matrix:\n")
+	for _, entry := range entries {
+		fmt.Fprintf(bw, "      - GOX_ENTRY: %s\n", yamlString(entry.Name))
+		fmt.Fprintf(bw, "        GOX_COMMAND: %s\n", yamlString(entry.Command))
+	}
+	fmt.Fprintf(bw, "  script:\n")
+	fmt.Fprintf(bw, "    - %s\n", yamlString(goxInstall()))
+	fmt.Fprintf(bw, "    - eval \"$GOX_COMMAND\"\n")
+	if len(paths) > 0 {
+		fmt.Fprintf(bw, "  artifacts:\n")
+		fmt.Fprintf(bw, "    paths:\n")
+		for _, p := range paths {
+			fmt.Fprintf(bw, "      - %s\n", yamlString(p))
+		}
+	}
+	return bw.Flush()
+}
+
+// yamlString quotes s as a YAML double-quoted scalar, which JSON strings
+// are a subset of.
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testCIEntries = []ciEntry{
+	{Name: "linux/amd64", OS: "linux", Arch: "amd64", Command: "gox --osarch=linux/amd64"},
+	{Name: "windows/amd64", OS: "windows", Arch: "amd64", Command: "gox --osarch=windows/amd64"},
+}
+
+func TestWriteGitHub(t *testing.T) {
+	var buf bytes.Buffer
+	paths := []string{"*_*_*", "dist"}
+	if err := writeCI(&buf, "github", testCIEntries, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	var workflow struct {
+		Jobs map[string]struct {
+			Steps []struct {
+				Uses string
+				Run  string
+				With map[string]string
+			}
+		}
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &workflow); err != nil {
+		t.Fatalf("%s\n%s", err, buf.String())
+	}
+
+	// Gox is installed before the matrix command runs, and what it built
+	// is uploaded afterwards.
+	var steps []string
+	for _, step := range workflow.Jobs["gox"].Steps {
+		switch {
+		case strings.HasPrefix(step.Run, "go install github.com/mitchellh/gox@"):
+			steps = append(steps, "install")
+		case step.Run == "${{ matrix.command }}":
+			steps = append(steps, "gox")
+		case strings.HasPrefix(step.Uses, "actions/upload-artifact@"):
+			steps = append(steps, "upload")
+			if got := strings.Fields(step.With["path"]); !reflect.DeepEqual(got, paths) {
+				t.Errorf("uploads %q, want %q", got, paths)
+			}
+			if !strings.Contains(step.With["name"], "${{") {
+				t.Errorf("the artifact name %q is the same for every entry", step.With["name"])
+			}
+		}
+	}
+	if want := []string{"install", "gox", "upload"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps %q, want %q:\n%s", steps, want, buf.String())
+	}
+}
+
+func TestWriteGitLab(t *testing.T) {
+	var buf bytes.Buffer
+	paths := []string{"*_*_*", "dist"}
+	if err := writeCI(&buf, "gitlab", testCIEntries, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	var pipeline map[string]struct {
+		Script    []string
+		Artifacts struct {
+			Paths []string
+		}
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &pipeline); err != nil {
+		t.Fatalf("%s\n%s", err, buf.String())
+	}
+
+	job := pipeline["gox"]
+	if len(job.Script) != 2 || !strings.HasPrefix(job.Script[0], "go install github.com/mitchellh/gox@") ||
+		job.Script[1] != `eval "$GOX_COMMAND"` {
+		t.Errorf("script %q doesn't install gox before running it", job.Script)
+	}
+	if !reflect.DeepEqual(job.Artifacts.Paths, paths) {
+		t.Errorf("artifacts %q, want %q", job.Artifacts.Paths, paths)
+	}
+}
+
+func TestTemplatePath(t *testing.T) {
+	cases := []struct {
+		template string
+		want     string
+	}{
+		{"{{.Dir}}_{{.OS}}_{{.Arch}}", "*_*_*"},
+		{"dist/{{.Dir}}_{{.OS}}_{{.Arch}}", "dist/*_*_*"},
+		{"dist/{{.OS}}_{{.Arch}}/{{.Dir}}", "dist"},
+		{"build/dist/{{.OS}}/{{.Arch}}/app", "build/dist"},
+		{"{{.OS}}/{{.Dir}}", "*/*"},
+		{"bin/app", "bin/app*"},
+		{"./SHA256SUMS", "SHA256SUMS*"},
+	}
+
+	for _, tc := range cases {
+		if got := templatePath(tc.template); got != tc.want {
+			t.Errorf("templatePath(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
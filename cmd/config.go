@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/linuxpkg"
+	"github.com/spf13/pflag"
+	"os"
+	"sort"
+)
+
+// loadConfigFile reads the configuration file given with "--config", or the
+// default one if it exists, into cfg. Flags set on the command line take
+// precedence over the settings of the file.
+func loadConfigFile(flags *pflag.FlagSet, cfg *config.Config) error {
+	// Commands that don't build anything have no "--config" flag.
+	if flags.Lookup("config") == nil {
+		return nil
+	}
+
+	path := cfg.ConfigFile
+	if path == "" {
+		if _, err := os.Stat(config.DefaultFile); err != nil {
+			return nil
+		}
+		path = config.DefaultFile
+	}
+
+	f, err := config.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	setString := func(flag string, target *string, value *string) {
+		if value != nil && !flags.Changed(flag) {
+			*target = *value
+		}
+	}
+	setString("ldflags", &cfg.Ldflags, f.Ldflags)
+	setString("gcflags", &cfg.Gcflags, f.Gcflags)
+	setString("asmflags", &cfg.Asmflags, f.Asmflags)
+	setString("tags", &cfg.Tags, f.Tags)
+	setString("output", &cfg.Output, f.Output)
+	setString("mod", &cfg.ModMode, f.Mod)
+	setString("buildmode", &cfg.BuildMode, f.BuildMode)
+	setString("cgo-toolchain", &cfg.CgoToolchain, f.CgoToolchain)
+	setString("cgo-libc", &cfg.CgoLibc, f.CgoLibc)
+	setString("stamp", &cfg.Stamp, f.Stamp)
+	if f.Cgo != nil && !flags.Changed("cgo") {
+		cfg.Cgo = *f.Cgo
+	}
+	if f.Static != nil && !flags.Changed("static") {
+		cfg.Static = *f.Static
+	}
+	if f.BuildInfo != nil && !flags.Changed("buildinfo") {
+		cfg.BuildInfo = *f.BuildInfo
+	}
+	if f.Universal != nil && !flags.Changed("universal") {
+		cfg.Universal = *f.Universal
+	}
+	if f.WindowsResources != nil {
+		cfg.WindowsResources = f.WindowsResources
+	}
+	if a := f.Archive; a != nil {
+		// The section alone turns archives on.
+		format := "auto"
+		if a.Format != nil {
+			format = *a.Format
+		}
+		setString("archive", &cfg.Archive, &format)
+		setString("archive-name", &cfg.ArchiveName, a.Name)
+		setString("archive-dir", &cfg.ArchiveDir, a.Dir)
+		if !flags.Changed("archive-file") {
+			cfg.ArchiveFiles = a.Files
+		}
+	}
+	if p := f.Packages; p != nil {
+		// The section alone turns the packages on, in every format.
+		if !flags.Changed("packages") {
+			cfg.Packages = p.Formats
+			if len(cfg.Packages) == 0 {
+				cfg.Packages = linuxpkg.Formats
+			}
+		}
+		cfg.Package = p
+	}
+	if o := f.OCI; o != nil {
+		setString("oci", &cfg.OCI, o.Path)
+		setString("oci-base", &cfg.OCIBase, o.Base)
+		cfg.Image = o
+	}
+	if c := f.Checksums; c != nil {
+		// The section alone turns the checksums on.
+		algorithm := "sha256"
+		if c.Algorithm != nil {
+			algorithm = *c.Algorithm
+		}
+		setString("checksums", &cfg.Checksums, &algorithm)
+		setString("checksums-file", &cfg.ChecksumsFile, c.File)
+		if c.Sidecars != nil && !flags.Changed("checksums-sidecars") {
+			cfg.ChecksumsSidecars = *c.Sidecars
+		}
+	}
+	if sign := f.Sign; sign != nil {
+		setString("sign", &cfg.Sign, sign.Kind)
+		setString("sign-key", &cfg.SignKey, sign.Key)
+		setString("sign-passphrase-file", &cfg.SignPassphraseFile, sign.PassphraseFile)
+	}
+	if m := f.Manifests; m != nil && flags.Lookup("base-url") != nil {
+		if !flags.Changed("kinds") && len(m.Kinds) > 0 {
+			cfg.Manifests = m.Kinds
+		}
+		setString("dir", &cfg.ManifestsDir, m.Dir)
+		setString("base-url", &cfg.ManifestsURL, m.BaseURL)
+		cfg.Manifest = m
+	}
+	if f.Parallel != nil && !flags.Changed("parallel") {
+		cfg.Parallel = *f.Parallel
+	}
+
+	names := make([]string, 0, len(f.Env))
+	for name := range f.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg.Env = append(cfg.Env, name+"="+f.Env[name])
+	}
+
+	// Defines given on the command line win over those of the file.
+	for name, value := range f.Define {
+		if _, ok := cfg.Defines[name]; ok {
+			continue
+		}
+		if cfg.Defines == nil {
+			cfg.Defines = make(map[string]string)
+		}
+		cfg.Defines[name] = value
+	}
+
+	cfg.ConfigFile = path
+	cfg.Platforms = f.Platforms
+	return nil
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/checksum"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/publish"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var manifestsCmd = &cobra.Command{
+	Use:   "publish-manifests",
+	Short: "builds and renders Homebrew, Scoop and winget manifests",
+	Long:  manifestsHelpText,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(cfg.Manifests) == 0 {
+			cfg.Manifests = publish.Kinds
+		}
+		if code := main(args, cfg); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+// manifestSettings returns the description of the packages, with defaults.
+func manifestSettings(cfg *config.Config) *config.FileManifests {
+	m := config.FileManifests{}
+	if cfg.Manifest != nil {
+		m = *cfg.Manifest
+	}
+	if m.Name == "" {
+		m.Name = "{{.Dir}}"
+	}
+	if m.Version == "" {
+		m.Version = "{{.Version}}"
+	}
+
+	return &m
+}
+
+// checkManifests checks the manifest settings of cfg before anything is
+// built.
+func checkManifests(cfg *config.Config) error {
+	for _, kind := range cfg.Manifests {
+		if !publish.ValidKind(kind) {
+			return fmt.Errorf("unknown manifest kind %q, should be one of %s",
+				kind, strings.Join(publish.Kinds, ", "))
+		}
+	}
+	if cfg.ManifestsURL == "" {
+		return fmt.Errorf("the base URL of the artifacts is needed to publish manifests, see --base-url")
+	}
+
+	m := manifestSettings(cfg)
+	for _, kind := range cfg.Manifests {
+		if kind == publish.Winget && (m.Publisher == "" || m.License == "") {
+			return fmt.Errorf("winget manifests need the publisher and license of the manifests section of the configuration file, or select the others with --kinds")
+		}
+	}
+	templates := map[string]string{"name": m.Name, "version": m.Version, "base-url": cfg.ManifestsURL}
+	for name, text := range templates {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("manifest %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// manifestsStep renders the manifests of every package built by the run
+// into cfg.ManifestsDir, pointing at the archives of the builds or, if
+// they weren't archived, at their binaries.
+func manifestsStep(cfg *config.Config, results []buildResult, release []buildStep) ([]string, error) {
+	m := manifestSettings(cfg)
+
+	var order []string
+	packages := make(map[string]*publish.Package)
+	for i := range results {
+		result := &results[i]
+		render := func(name, text string) (string, error) {
+			return pkg.RenderTemplate(result.Config, result.Platform, result.Path, "manifest-"+name, text)
+		}
+
+		p, ok := packages[result.Path]
+		if !ok {
+			var err error
+			p = &publish.Package{
+				Description: m.Description,
+				Homepage:    m.Homepage,
+				License:     m.License,
+				Publisher:   m.Publisher,
+				Identifier:  m.Identifier,
+			}
+			if p.Name, err = render("name", m.Name); err != nil {
+				return nil, err
+			}
+			if p.Version, err = render("version", m.Version); err != nil {
+				return nil, err
+			}
+			if p.Command, err = render("command", "{{.Dir}}"); err != nil {
+				return nil, err
+			}
+			if p.Description == "" {
+				p.Description = p.Name
+			}
+			packages[result.Path] = p
+			order = append(order, result.Path)
+		}
+
+		artifact, err := manifestArtifact(result)
+		if err != nil {
+			return nil, err
+		}
+		base, err := render("base-url", cfg.ManifestsURL)
+		if err != nil {
+			return nil, err
+		}
+		artifact.URL = strings.TrimSuffix(base, "/") + "/" + filepath.Base(artifact.URL)
+		p.Artifacts = append(p.Artifacts, *artifact)
+	}
+
+	var outputs []string
+	for _, path := range order {
+		for _, kind := range cfg.Manifests {
+			files, err := publish.Render(kind, packages[path])
+			if err != nil {
+				return outputs, fmt.Errorf("%s: %s", kind, err)
+			}
+
+			for _, f := range files {
+				output, err := filepath.Abs(filepath.Join(cfg.ManifestsDir, filepath.FromSlash(f.Path)))
+				if err != nil {
+					return outputs, err
+				}
+				if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+					return outputs, err
+				}
+				if err := ioutil.WriteFile(output, f.Data, 0644); err != nil {
+					return outputs, err
+				}
+				outputs = append(outputs, output)
+			}
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("none of the platforms built is supported by the %s manifests",
+			strings.Join(cfg.Manifests, ", "))
+	}
+
+	return outputs, nil
+}
+
+// manifestArtifact returns the artifact of result installed by the
+// manifests, its archive if it has one, with URL holding its path.
+func manifestArtifact(result *buildResult) (*publish.Artifact, error) {
+	artifact := &publish.Artifact{
+		OS:     result.Platform.OS,
+		Arch:   result.Platform.Arch,
+		URL:    result.Output,
+		Binary: filepath.Base(result.Output),
+	}
+	for _, step := range result.Steps {
+		if step.Name != "archive" || len(step.Outputs) == 0 {
+			continue
+		}
+
+		dir, err := archiveDir(result.Config, result)
+		if err != nil {
+			return nil, err
+		}
+		artifact.URL = step.Outputs[0]
+		artifact.Archive = archiveFormat(result.Config, result)
+		artifact.Binary = path.Join(dir, artifact.Binary)
+	}
+
+	sum, err := checksum.File(checksum.SHA256, artifact.URL)
+	if err != nil {
+		return nil, err
+	}
+	artifact.SHA256 = sum
+
+	return artifact, nil
+}
+
+const manifestsHelpText = `Usage: gox publish-manifests [options] [packages]
+
+  Builds the packages like gox does, with the same options, and then
+  renders the manifests of package managers installing them: a Homebrew
+  formula for the darwin and linux amd64 and arm64 builds, and Scoop and
+  winget manifests for the windows builds. The manifests point at the
+  archives of the builds when "--archive" is given, or else at the
+  binaries, with their SHA-256 checksums.
+
+  The manifests are written to the directory given with "--dir", in the
+  layout of the repositories they belong in, so that it can be a checkout
+  of a tap, bucket or winget-pkgs fork:
+
+    Formula/app.rb
+    bucket/app.json
+    manifests/e/Example/App/1.2.0/Example.App.yaml (and .installer.yaml,
+      .locale.en-US.yaml)
+
+  "--kinds" selects some of homebrew, scoop and winget. "--base-url" is
+  the template of the URL of the directory the artifacts are uploaded to,
+  with the same variables as the output path, such as
+  "https://github.com/example/app/releases/download/{{.Version}}".
+
+  The packages are described by the "manifests" section of the
+  configuration file, which also accepts kinds, dir and base_url:
+
+    manifests:
+      base_url: https://example.com/downloads/{{.Version}}
+      description: Does things
+      homepage: https://example.com
+      license: MIT
+      publisher: Example
+      identifier: Example.App
+
+  The name and version are templates defaulting to "{{.Dir}}" and
+  "{{.Version}}". winget manifests need a publisher and a license, and
+  only install zip archives or bare binaries.
+
+`
+
+func init() {
+	manifestsCmd.Flags().SortFlags = false
+	manifestsCmd.Flags().StringSliceVar(&cfg.Manifests, "kinds", nil, "manifests to render: homebrew, scoop and/or winget, defaults to all")
+	manifestsCmd.Flags().StringVar(&cfg.ManifestsDir, "dir", "manifests", "directory the manifests are written to")
+	manifestsCmd.Flags().StringVar(&cfg.ManifestsURL, "base-url", "", "URL template of the directory the artifacts are downloaded from")
+	addBuildFlags(manifestsCmd.Flags())
+	addStepFlags(manifestsCmd.Flags())
+	manifestsCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+
+	rootCmd.AddCommand(manifestsCmd)
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/oci"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// imageSettings returns the description of the image, with defaults.
+func imageSettings(cfg *config.Config) *config.FileOCI {
+	o := config.FileOCI{}
+	if cfg.Image != nil {
+		o = *cfg.Image
+	}
+	if o.Tag == "" {
+		o.Tag = "{{.Version}}"
+	}
+	if o.BinDir == "" {
+		o.BinDir = "/usr/local/bin"
+	}
+
+	return &o
+}
+
+// checkOCI checks the image settings of cfg before anything is built.
+func checkOCI(cfg *config.Config) error {
+	o := imageSettings(cfg)
+	templates := map[string]string{"tag": o.Tag}
+	for name, value := range o.Labels {
+		templates["label "+name] = value
+	}
+	for name, text := range templates {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("oci %s: %s", name, err)
+		}
+	}
+
+	if err := oci.CheckPath(cfg.OCI); err != nil {
+		return err
+	}
+	if !path.IsAbs(o.BinDir) {
+		return fmt.Errorf("oci bindir must be an absolute path, not %q", o.BinDir)
+	}
+	if cfg.OCIBase != "" {
+		base, _ := oci.SplitRef(cfg.OCIBase)
+		if _, err := os.Stat(base); err != nil {
+			return fmt.Errorf("oci base: %s", err)
+		}
+	}
+
+	_, err := imageFiles(o)
+	return err
+}
+
+// ociStep assembles the image of the binaries of the linux builds, one
+// platform per architecture.
+func ociStep(cfg *config.Config, results []buildResult, release []buildStep) ([]string, error) {
+	o := imageSettings(cfg)
+	extra, err := imageFiles(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []oci.Platform
+	byArch := make(map[string]int)
+	var commands []string
+	var first *buildResult
+	for i := range results {
+		result := &results[i]
+		if result.Platform.OS != "linux" {
+			continue
+		}
+		if first == nil {
+			first = result
+		}
+
+		command, err := pkg.RenderTemplate(result.Config, result.Platform, result.Path, "oci-command", "{{.Dir}}")
+		if err != nil {
+			return nil, err
+		}
+		file := oci.File{Src: result.Output, Dst: path.Join(o.BinDir, command)}
+
+		i, ok := byArch[result.Platform.Arch]
+		if !ok {
+			i = len(platforms)
+			byArch[result.Platform.Arch] = i
+			platforms = append(platforms, oci.Platform{
+				OS:      "linux",
+				Arch:    result.Platform.Arch,
+				Variant: ociVariant(result),
+				Files:   append([]oci.File(nil), extra...),
+			})
+		}
+		platforms[i].Files = append(platforms[i].Files, file)
+		if i == 0 {
+			commands = append(commands, file.Dst)
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no linux binaries were built for the image")
+	}
+
+	image := &oci.Image{
+		Base:       cfg.OCIBase,
+		Entrypoint: o.Entrypoint,
+		Cmd:        o.Cmd,
+		User:       o.User,
+		WorkingDir: o.WorkingDir,
+		Created:    buildTime(cfg),
+	}
+	if len(image.Entrypoint) == 0 {
+		if len(commands) != 1 {
+			return nil, fmt.Errorf("the image has %d binaries, its entrypoint must be set", len(commands))
+		}
+		image.Entrypoint = commands
+	}
+
+	render := func(name, text string) (string, error) {
+		return pkg.RenderTemplate(first.Config, first.Platform, first.Path, "oci-"+name, text)
+	}
+	if image.Tag, err = render("tag", o.Tag); err != nil {
+		return nil, err
+	}
+	for name, value := range o.Labels {
+		if image.Labels == nil {
+			image.Labels = make(map[string]string)
+		}
+		if image.Labels[name], err = render("label", value); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(o.Env))
+	for name := range o.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		image.Env = append(image.Env, name+"="+o.Env[name])
+	}
+
+	output, err := filepath.Abs(cfg.OCI)
+	if err != nil {
+		return nil, err
+	}
+	if err := oci.Write(output, image, platforms); err != nil {
+		return nil, err
+	}
+
+	return []string{output}, nil
+}
+
+// ociVariant returns the variant of the architecture of result, as in
+// the platforms of image indexes.
+func ociVariant(result *buildResult) string {
+	if result.Platform.Arch != "arm" {
+		return ""
+	}
+
+	arm := strings.SplitN(result.Config.Getenv("GOARM"), ",", 2)[0]
+	if arm == "" {
+		arm = "7"
+	}
+	return "v" + arm
+}
+
+// imageFiles returns the extra files of the image.
+func imageFiles(o *config.FileOCI) ([]oci.File, error) {
+	var files []oci.File
+	for _, f := range o.Files {
+		if _, err := os.Stat(f.Src); err != nil {
+			return nil, fmt.Errorf("oci file: %s", err)
+		}
+		if !path.IsAbs(f.Dst) {
+			return nil, fmt.Errorf("oci file %s: the destination must be an absolute path, not %q", f.Src, f.Dst)
+		}
+
+		dst := f.Dst
+		if strings.HasSuffix(dst, "/") {
+			dst = path.Join(dst, filepath.Base(f.Src))
+		}
+		files = append(files, oci.File{Src: f.Src, Dst: dst})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/linuxpkg"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// systemdUnitDir is where the systemd units of the packages are installed.
+const systemdUnitDir = "/usr/lib/systemd/system"
+
+// packageSettings returns the description of the packages, with defaults.
+// The maintainer defaults to the author of the commit, which debs need.
+func packageSettings(cfg *config.Config) *config.FilePackages {
+	p := config.FilePackages{}
+	if cfg.Package != nil {
+		p = *cfg.Package
+	}
+	if p.Name == "" {
+		p.Name = "{{.Dir}}"
+	}
+	if p.Version == "" {
+		p.Version = "{{.Version}}"
+	}
+	if p.Maintainer == "" {
+		p.Maintainer = cfg.GitInfo().Author
+	}
+	if p.BinDir == "" {
+		p.BinDir = "/usr/bin"
+	}
+
+	return &p
+}
+
+// checkPackages checks the package settings of cfg, so that a missing file
+// is reported before anything is built.
+func checkPackages(cfg *config.Config) error {
+	for _, format := range cfg.Packages {
+		if !linuxpkg.ValidFormat(format) {
+			return fmt.Errorf("unknown package format %q, should be one of %s",
+				format, strings.Join(linuxpkg.Formats, ", "))
+		}
+	}
+
+	p := packageSettings(cfg)
+	if p.Maintainer == "" {
+		for _, format := range cfg.Packages {
+			if format == linuxpkg.Deb {
+				return fmt.Errorf("debs need a maintainer, set one in the packages section of the configuration file or build from a git checkout")
+			}
+		}
+	}
+	for name, text := range map[string]string{"name": p.Name, "version": p.Version} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("package %s: %s", name, err)
+		}
+	}
+	if !path.IsAbs(p.BinDir) {
+		return fmt.Errorf("package bindir must be an absolute path, not %q", p.BinDir)
+	}
+
+	_, err := packageFiles(p)
+	if err != nil {
+		return err
+	}
+	_, err = packageScripts(p)
+	return err
+}
+
+// packageStep installs the binary of result, if built for linux, with the
+// extra files in a package of every format.
+func packageStep(cfg *config.Config, result *buildResult) ([]string, error) {
+	if result.Platform.OS != "linux" {
+		return nil, nil
+	}
+
+	p := packageSettings(cfg)
+	render := func(name, text string) (string, error) {
+		return pkg.RenderTemplate(cfg, result.Platform, result.Path, "package-"+name, text)
+	}
+	name, err := render("name", p.Name)
+	if err != nil {
+		return nil, err
+	}
+	version, err := render("version", p.Version)
+	if err != nil {
+		return nil, err
+	}
+	command, err := render("command", "{{.Dir}}")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := packageFiles(p)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, linuxpkg.File{Src: result.Output, Dst: path.Join(p.BinDir, command), Mode: 0755})
+	scripts, err := packageScripts(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []string
+	for _, format := range cfg.Packages {
+		info := &linuxpkg.Info{
+			Name:        name,
+			Version:     version,
+			Maintainer:  p.Maintainer,
+			Description: p.Description,
+			Homepage:    p.Homepage,
+			License:     p.License,
+			Vendor:      p.Vendor,
+			Arch:        result.Platform.Arch,
+			ARM:         cfg.Getenv("GOARM"),
+			Depends:     packageDepends(p, format),
+			Files:       files,
+			Scripts:     *scripts,
+			Time:        buildTime(cfg),
+		}
+
+		file, err := linuxpkg.FileName(format, info)
+		if err != nil {
+			return outputs, err
+		}
+		output, err := filepath.Abs(filepath.Join(filepath.Dir(result.Output), file))
+		if err != nil {
+			return outputs, err
+		}
+		if err := linuxpkg.Write(format, output, info); err != nil {
+			return outputs, fmt.Errorf("%s: %s", file, err)
+		}
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+// packageFiles returns the extra files installed by the packages.
+func packageFiles(p *config.FilePackages) ([]linuxpkg.File, error) {
+	var files []linuxpkg.File
+	add := func(src, dst string, config bool) error {
+		if _, err := os.Stat(src); err != nil {
+			return fmt.Errorf("package file: %s", err)
+		}
+		if !path.IsAbs(dst) {
+			return fmt.Errorf("package file %s: the destination must be an absolute path, not %q", src, dst)
+		}
+		if strings.HasSuffix(dst, "/") {
+			dst = path.Join(dst, filepath.Base(src))
+		}
+
+		files = append(files, linuxpkg.File{Src: src, Dst: dst, Config: config})
+		return nil
+	}
+
+	for _, f := range p.Files {
+		if err := add(f.Src, f.Dst, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range p.ConfigFiles {
+		if err := add(f.Src, f.Dst, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, unit := range p.SystemdUnits {
+		if err := add(unit, systemdUnitDir+"/", false); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// packageScripts reads the scripts of the packages.
+func packageScripts(p *config.FilePackages) (*linuxpkg.Scripts, error) {
+	var scripts linuxpkg.Scripts
+	read := []struct {
+		path   string
+		target *string
+	}{
+		{p.Scripts.PreInstall, &scripts.PreInstall},
+		{p.Scripts.PostInstall, &scripts.PostInstall},
+		{p.Scripts.PreRemove, &scripts.PreRemove},
+		{p.Scripts.PostRemove, &scripts.PostRemove},
+	}
+	for _, r := range read {
+		if r.path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(r.path)
+		if err != nil {
+			return nil, fmt.Errorf("package script: %s", err)
+		}
+		*r.target = string(data)
+	}
+
+	return &scripts, nil
+}
+
+// packageDepends returns the dependencies of the package in format.
+func packageDepends(p *config.FilePackages, format string) []string {
+	formats := map[string]*config.FilePackageFormat{
+		linuxpkg.Deb: p.Deb,
+		linuxpkg.RPM: p.RPM,
+		linuxpkg.APK: p.APK,
+	}
+	if f := formats[format]; f != nil && len(f.Depends) > 0 {
+		return f.Depends
+	}
+
+	return p.Depends
+}
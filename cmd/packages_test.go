@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"strings"
+	"testing"
+)
+
+func TestPackageMaintainer(t *testing.T) {
+	author := &stamp.Info{Author: "Jane Doe <jane@example.com>"}
+	cases := []struct {
+		name       string
+		packages   []string
+		maintainer string
+		git        *stamp.Info
+		want       string
+		err        string
+	}{
+		{"file", []string{"deb"}, "Ops <ops@example.com>", author, "Ops <ops@example.com>", ""},
+		{"author", []string{"deb"}, "", author, "Jane Doe <jane@example.com>", ""},
+		{"none", []string{"deb", "rpm"}, "", &stamp.Info{}, "", "debs need a maintainer"},
+		{"no deb", []string{"rpm", "apk"}, "", &stamp.Info{}, "", ""},
+	}
+
+	for _, tc := range cases {
+		cfg := &config.Config{
+			Packages: tc.packages,
+			Package:  &config.FilePackages{Maintainer: tc.maintainer},
+			Git:      tc.git,
+		}
+		if got := packageSettings(cfg).Maintainer; got != tc.want {
+			t.Errorf("%s: maintainer %q, want %q", tc.name, got, tc.want)
+		}
+
+		err := checkPackages(cfg)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
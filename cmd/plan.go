@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	planScript   string
+	planJSON     bool
+	planCI       string
+	planCIShards int
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "resolves the build jobs without building anything",
+	Long:  planHelpText,
+	Run: func(cmd *cobra.Command, args []string) {
+		if code := planMain(cmd.Flags(), args, cfg); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+// plannedJob is a build job resolved to the command that runs it.
+type plannedJob struct {
+	Platform config.Platform
+	Path     string
+	Config   *config.Config
+	Command  *pkg.Command
+
+	// Overrides are the per-platform settings applied to the job.
+	Overrides []config.Override
+}
+
+func planMain(flags *pflag.FlagSet, args []string, cfg *config.Config) int {
+	mainDirs, platforms, ok := resolve(args, cfg)
+	if !ok {
+		return 1
+	}
+
+	if planCI != "" {
+		entries := ciEntries(flags, args, platforms, planCIShards, cfg.Universal)
+		paths, err := ciPaths(cfg, platforms)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error planning builds: %s\n", err)
+			return 1
+		}
+		if err := writeCI(os.Stdout, planCI, entries, paths); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing CI configuration: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	buildJobs := buildJobs(cfg, platforms, mainDirs)
+	if planScript == "" {
+		return printPlan(cfg, buildJobs)
+	}
+
+	jobs, err := planJobs(cfg, buildJobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning builds: %s\n", err)
+		return 1
+	}
+
+	if err := writeScript(planScript, jobs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing script: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printPlan prints the jobs that would be built, as text or as JSON.
+func printPlan(cfg *config.Config, buildJobs []buildJob) int {
+	jobs, err := planJobs(cfg, buildJobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning builds: %s\n", err)
+		return 1
+	}
+
+	if planJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(newPlanDocument(jobs)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing plan: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("Number of jobs: %d\n", len(jobs))
+	for _, job := range jobs {
+		sources := settingSources(job.Overrides)
+		fmt.Printf("\n--> %15s: %s\n", job.Platform.String(), job.Path)
+		for _, setting := range [][2]string{
+			{"output", relPath(job.Command.Output)},
+			{"cgo", strconv.FormatBool(pkg.CgoEnabled(job.Config, job.Platform))},
+			{"ldflags", job.Config.Ldflags},
+			{"define", strings.Join(config.Defines(job.Config.JobDefines()), " ")},
+			{"gcflags", job.Config.Gcflags},
+			{"asmflags", job.Config.Asmflags},
+			{"tags", job.Config.Tags},
+			{"mod", job.Config.ModMode},
+			{"buildmode", job.Config.BuildMode},
+			{"sysroot", job.Config.Sysroot},
+			{"env", strings.Join(job.Config.Env, " ")},
+		} {
+			from := sources[setting[0]]
+			if setting[1] == "" && len(from) == 0 && setting[0] != "output" && setting[0] != "cgo" {
+				continue
+			}
+
+			line := fmt.Sprintf("    %-10s %s", setting[0]+":", setting[1])
+			if len(from) > 0 {
+				line += "  (from " + strings.Join(from, ", ") + ")"
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("    %-10s %s\n", "command:", job.Command.String())
+	}
+
+	return 0
+}
+
+// planDocument is the JSON form of a plan. Its fields are only ever
+// added to, and jobs are sorted, so that plans can be diffed.
+type planDocument struct {
+	Jobs []planDocumentJob `json:"jobs"`
+}
+
+type planDocumentJob struct {
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	Package   string            `json:"package"`
+	Output    string            `json:"output"`
+	Dir       string            `json:"dir,omitempty"`
+	Cgo       bool              `json:"cgo"`
+	Env       map[string]string `json:"env"`
+	Ldflags   string            `json:"ldflags"`
+	Defines   map[string]string `json:"defines,omitempty"`
+	Gcflags   string            `json:"gcflags"`
+	Asmflags  string            `json:"asmflags"`
+	Tags      string            `json:"tags"`
+	Mod       string            `json:"mod"`
+	BuildMode string            `json:"buildmode"`
+	Overrides []string          `json:"overrides"`
+
+	// Sources maps each setting changed by overrides to where the
+	// overrides came from, in the order they were applied.
+	Sources map[string][]string `json:"sources"`
+}
+
+func newPlanDocument(jobs []plannedJob) *planDocument {
+	doc := &planDocument{Jobs: make([]planDocumentJob, 0, len(jobs))}
+	for _, job := range jobs {
+		env := make(map[string]string)
+		for _, kv := range job.Command.Env {
+			parts := strings.SplitN(kv, "=", 2)
+			env[parts[0]] = parts[1]
+		}
+
+		overrides := overrideSources(job.Overrides)
+
+		doc.Jobs = append(doc.Jobs, planDocumentJob{
+			OS:        job.Platform.OS,
+			Arch:      job.Platform.Arch,
+			Package:   job.Path,
+			Output:    relPath(job.Command.Output),
+			Dir:       job.Command.Dir,
+			Cgo:       pkg.CgoEnabled(job.Config, job.Platform),
+			Env:       env,
+			Ldflags:   job.Config.Ldflags,
+			Defines:   job.Config.JobDefines(),
+			Gcflags:   job.Config.Gcflags,
+			Asmflags:  job.Config.Asmflags,
+			Tags:      job.Config.Tags,
+			Mod:       job.Config.ModMode,
+			BuildMode: job.Config.BuildMode,
+			Overrides: overrides,
+			Sources:   settingSources(job.Overrides),
+		})
+	}
+
+	return doc
+}
+
+// overrideSources returns where each of the overrides came from.
+func overrideSources(overrides []config.Override) []string {
+	sources := make([]string, 0, len(overrides))
+	for _, o := range overrides {
+		sources = append(sources, o.Source)
+	}
+
+	return sources
+}
+
+// settingSources maps the settings shown in plans to the sources of the
+// overrides that changed them.
+func settingSources(overrides []config.Override) map[string][]string {
+	sources := make(map[string][]string)
+	for _, o := range overrides {
+		setting := strings.ToLower(o.Key)
+		if o.SetsEnv() {
+			setting = "env"
+		}
+
+		from := sources[setting]
+		if len(from) == 0 || from[len(from)-1] != o.Source {
+			sources[setting] = append(from, o.Source)
+		}
+	}
+
+	return sources
+}
+
+// relPath returns path relative to the working directory, with forward
+// slashes, when it is inside of it so that plans don't depend on where
+// the checkout is.
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// planJobs resolves every job to the command that builds it, checking its
+// build mode as a build would.
+func planJobs(cfg *config.Config, buildJobs []buildJob) ([]plannedJob, error) {
+	jobs := make([]plannedJob, 0, len(buildJobs))
+	var modes buildModeCheck
+	for _, job := range buildJobs {
+		jobCfg, overrides, err := jobConfig(cfg, job.Platform)
+		if err == nil {
+			err = modes.Check(jobCfg, job.Platform)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", job.Platform.String(), err)
+		}
+
+		cmd, err := pkg.GoBuildCommand(jobCfg, job.Platform, job.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", job.Platform.String(), err)
+		}
+
+		jobs = append(jobs, plannedJob{
+			Platform:  job.Platform,
+			Path:      job.Path,
+			Config:    jobCfg,
+			Command:   cmd,
+			Overrides: overrides,
+		})
+	}
+
+	return jobs, nil
+}
+
+// writeScript writes a POSIX shell script running the commands of the jobs
+// one after the other to path, "-" meaning stdout.
+func writeScript(path string, jobs []plannedJob) error {
+	if path == "-" {
+		return emitScript(os.Stdout, jobs)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err := emitScript(f, jobs); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func emitScript(w io.Writer, jobs []plannedJob) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#!/bin/sh\n")
+	fmt.Fprintf(bw, "# Generated by \"gox plan --emit-script\". Runs the same commands as gox,\n")
+	fmt.Fprintf(bw, "# one at a time, stopping at the first failure.\n")
+	fmt.Fprintf(bw, "set -e\n")
+
+	for _, job := range jobs {
+		label := fmt.Sprintf("--> %15s: %s", job.Platform.String(), job.Path)
+		fmt.Fprintf(bw, "\necho %s\n", pkg.ShellQuote(label))
+		writeScriptFiles(bw, job.Command.Files)
+		command := job.Command.String()
+		if job.Command.Dir != "" {
+			command = fmt.Sprintf("(cd %s && %s)", pkg.ShellQuote(job.Command.Dir), command)
+		}
+
+		// Files written to the source tree are never written over, and
+		// are removed whatever happens, interruptions included.
+		if len(job.Command.TreeFiles) > 0 {
+			paths := scriptTreePaths(job.Command.TreeFiles)
+			for _, path := range paths {
+				message := pkg.ShellQuote(" already exists, remove it if an interrupted build left it behind")
+				fmt.Fprintf(bw, "if [ -e %s ]; then echo %s%s >&2; exit 1; fi\n", path, path, message)
+			}
+			remove := "rm -f " + strings.Join(paths, " ")
+			fmt.Fprintf(bw, "trap %s INT TERM\n", pkg.ShellQuote(remove+"; exit 130"))
+			writeScriptTreeFiles(bw, job.Command.TreeFiles)
+			fmt.Fprintf(bw, "%s || { %s; exit 1; }\n%s\ntrap - INT TERM\n", command, remove, remove)
+		} else {
+			fmt.Fprintf(bw, "%s\n", command)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeScriptFiles writes the commands creating the generated files of a
+// job, in path order.
+func writeScriptFiles(w io.Writer, files map[string]string) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Fprintf(w, "mkdir -p %s\n", pkg.ShellQuote(filepath.Dir(path)))
+		fmt.Fprintf(w, "cat > %s <<'GOX_EOF'\n%sGOX_EOF\n", pkg.ShellQuote(path), files[path])
+	}
+}
+
+// scriptTreePaths returns the quoted paths of the files a job reads from
+// the source tree, in path order.
+func scriptTreePaths(files map[string]string) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		paths[i] = pkg.ShellQuote(path)
+	}
+	return paths
+}
+
+// writeScriptTreeFiles writes the commands creating the files a job reads
+// from the source tree, in path order. The files may be binary, so they
+// are written with printf escapes.
+func writeScriptTreeFiles(w io.Writer, files map[string]string) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		quoted := pkg.ShellQuote(path)
+		fmt.Fprintf(w, ": > %s\n", quoted)
+		data := files[path]
+		for len(data) > 0 {
+			n := 64
+			if n > len(data) {
+				n = len(data)
+			}
+			fmt.Fprintf(w, "printf '%s' >> %s\n", printfEscape(data[:n]), quoted)
+			data = data[n:]
+		}
+	}
+}
+
+// printfEscape escapes s for the format of printf in single quotes,
+// leaving the printable characters but "-", which could make it look like
+// an option, as they are.
+func printfEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '\\' && c != '\'' && c != '%' && c != '-' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%03o", c)
+		}
+	}
+	return b.String()
+}
+
+const planHelpText = `Usage: gox plan [options] [packages]
+
+  Resolves the packages, platforms and per-platform overrides exactly like
+  gox does, without building anything, and prints every job: its platform
+  and package, output path, whether cgo is enabled and the flags it is
+  built with. Settings changed for the job's platform are followed by the
+  configuration file rules and GOX_[OS]_[ARCH]_* variables they came
+  from. This is the same as "gox --dry-run".
+
+  "--json" prints the jobs as JSON instead. Jobs are sorted by platform
+  and package, and output paths are relative to the working directory,
+  so the result only changes when the build settings do and can be
+  checked in and diffed during code review.
+
+  "--emit-script build.sh" writes a standalone POSIX shell script running
+  every go command of the build, with its environment and directory, so
+  that the build can be reproduced without Gox. Use "-" to write the
+  script to stdout.
+
+CI configuration:
+
+  "--ci github|gitlab|json-matrix" prints a CI matrix that fans the build
+  out over several runners, along with the gox command each entry runs.
+  By default there is one entry per platform, building it with "--osarch",
+  but for the darwin platforms of "--universal", which share an entry.
+  With "--ci-shards n" there are n entries instead, each building one
+  "--shard i/n" slice of the jobs. The other flags and packages given to
+  "gox plan" are passed on to every entry.
+
+  "json-matrix" is the {"include": [...]} object GitHub Actions accepts
+  from fromJSON(), "github" is a workflow job and "gitlab" a job using
+  "parallel:matrix". These two install this version of Gox with "go
+  install" before running the entry, and then upload its outputs,
+  archives, checksum file and image as artifacts: the directories they are
+  written to or, when the templates write them next to other files, globs
+  of their names.
+
+`
+
+func init() {
+	planCmd.Flags().SortFlags = false
+	planCmd.Flags().BoolVar(&planJSON, "json", false, "print the jobs as JSON")
+	planCmd.Flags().StringVar(&planScript, "emit-script", "", "write a shell script reproducing the build to this file")
+	planCmd.Flags().StringVar(&planCI, "ci", "", "print a CI matrix: github, gitlab or json-matrix")
+	planCmd.Flags().IntVar(&planCIShards, "ci-shards", 0, "split the CI matrix in this many shards instead of per platform")
+	addBuildFlags(planCmd.Flags())
+
+	rootCmd.AddCommand(planCmd)
+}
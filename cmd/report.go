@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/gotest"
+	"github.com/mitchellh/gox/pkg/report"
+	"io"
+	"os"
+	"strings"
+)
+
+// addBuilds adds a case per build job, followed by a case per step run on
+// its binary, to the suite of its platform.
+func addBuilds(r *report.Report, builds []buildResult) {
+	for _, build := range builds {
+		r.Add(build.Platform.String(), buildCase(build))
+		for _, step := range build.Steps {
+			r.Add(build.Platform.String(), stepCase(build.Path, step))
+		}
+	}
+}
+
+// releaseSuite is the suite of the steps run on the artifacts of all the
+// platforms at once.
+const releaseSuite = "release"
+
+// addRelease adds a case per release step to their own suite.
+func addRelease(r *report.Report, steps []buildStep) {
+	for _, step := range steps {
+		r.Add(releaseSuite, stepCase("gox", step))
+	}
+}
+
+func stepCase(class string, step buildStep) report.Case {
+	outputs := make([]string, 0, len(step.Outputs))
+	for _, output := range step.Outputs {
+		outputs = append(outputs, relPath(output))
+	}
+
+	c := report.Case{
+		Class:   class,
+		Name:    step.Name,
+		Elapsed: step.Elapsed,
+		Output:  strings.Join(outputs, "\n"),
+	}
+	if step.Err != nil {
+		c.Failure = step.Err.Error()
+	}
+
+	return c
+}
+
+// addTests adds, for every test run, the build of the test binary and the
+// result of each test to the suite of its platform.
+func addTests(r *report.Report, runs []testRun) {
+	for _, run := range runs {
+		suite := run.Platform.String()
+		r.Add(suite, buildCase(run.buildResult))
+
+		switch {
+		case run.Err != nil:
+		case run.CompileOnly != "":
+			r.Add(suite, report.Case{
+				Class:   run.Path,
+				Name:    "run",
+				Skipped: "compile-only: " + run.CompileOnly,
+			})
+		case run.Result != nil:
+			for _, test := range run.Result.Tests {
+				r.Add(suite, testCase(run.Path, test))
+			}
+
+			// The binary can fail without any failing test, for example
+			// when it can't be started or TestMain exits.
+			if run.Result.Err != nil && run.Result.Count(gotest.StatusFail) == 0 {
+				r.Add(suite, report.Case{
+					Class:   run.Path,
+					Name:    "run",
+					Elapsed: run.Result.Elapsed,
+					Failure: run.Result.Err.Error(),
+					Details: run.Result.Output,
+				})
+			}
+		}
+	}
+}
+
+func buildCase(build buildResult) report.Case {
+	c := report.Case{
+		Class:   build.Path,
+		Name:    "build",
+		Elapsed: build.Elapsed,
+	}
+	if build.Binary != nil {
+		c.Properties = build.Binary.Attributes()
+	}
+
+	if build.Err != nil {
+		c.Failure = build.Err.Error()
+		if err, ok := build.Err.(*pkg.ExecError); ok {
+			c.Failure = "build failed: " + err.Err.Error()
+			c.Details = err.Stderr
+		}
+	}
+
+	return c
+}
+
+func testCase(path string, test gotest.Test) report.Case {
+	c := report.Case{
+		Class:   path,
+		Name:    test.Name,
+		Elapsed: test.Elapsed,
+	}
+
+	switch test.Status {
+	case gotest.StatusFail:
+		c.Failure = "test failed"
+		c.Details = test.Output
+	case gotest.StatusSkip:
+		c.Skipped = strings.TrimSpace(test.Output)
+		if c.Skipped == "" {
+			c.Skipped = "skipped"
+		}
+	default:
+		c.Output = test.Output
+	}
+
+	return c
+}
+
+// writeReports writes the report in each of the formats requested in cfg.
+func writeReports(cfg *config.Config, r *report.Report) error {
+	if cfg.JUnit != "" {
+		if err := writeReport(cfg.JUnit, r.WriteJUnit); err != nil {
+			return err
+		}
+	}
+	if cfg.TAP != "" {
+		if err := writeReport(cfg.TAP, r.WriteTAP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeReport(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
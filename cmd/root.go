@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hashicorp/go-version"
 	"github.com/mitchellh/gox/pkg"
 	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/progress"
+	"github.com/mitchellh/gox/pkg/report"
+	"github.com/mitchellh/gox/pkg/verify"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 var cfg = &config.Config{
@@ -26,6 +35,7 @@ var cfg = &config.Config{
 	Race:           false,
 	GoCmd:          "go",
 	ModMode:        "mod",
+	Stdout:         os.Stdout,
 	PlatformFlag: config.PlatformFlag{
 		OS:     nil,
 		Arch:   nil,
@@ -34,32 +44,58 @@ var cfg = &config.Config{
 	},
 }
 
+var dryRun bool
+
 var rootCmd = &cobra.Command{
 	Use:   "gox",
 	Short: "cross-compiles go applications in parallel.",
 	Long:  helpText,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// The flags were fine, don't bury the error under the usage.
+		cmd.SilenceUsage = true
+		if err := loadConfigFile(cmd.Flags(), cfg); err != nil {
+			return err
+		}
+		return readStamp(cmd.Flags(), cfg)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		main(args, cfg)
+		if code := main(args, cfg); code != 0 {
+			os.Exit(code)
+		}
 	},
 }
 
 func main(args []string, cfg *config.Config) int {
-	if cfg.Parallel < 2 {
-		cpus := runtime.NumCPU()
-		if cpus != 1 {
-			cfg.Parallel = cpus - 1
-		} else {
-			cfg.Parallel = cpus
-		}
-	}
+	setParallel(cfg)
 
 	if cfg.BuildToolchain {
 		return pkg.BuildToolchain(cfg, cfg.PlatformFlag)
 	}
 
+	mainDirs, platforms, ok := resolve(args, cfg)
+	if !ok {
+		return 1
+	}
+
+	jobs := buildJobs(cfg, platforms, mainDirs)
+	if dryRun {
+		return printPlan(cfg, jobs)
+	}
+
+	if err := checkSteps(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return build(cfg, jobs, pkg.GoCrossCompile)
+}
+
+// resolve determines the main packages in the given paths and the
+// platforms to build them for, telling the user what went wrong if it
+// fails.
+func resolve(args []string, cfg *config.Config) ([]string, []config.Platform, bool) {
 	if _, err := exec.LookPath(cfg.GoCmd); err != nil {
 		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n", cfg.GoCmd)
-		return 1
+		return nil, nil, false
 	}
 
 	packages := args
@@ -71,26 +107,65 @@ func main(args []string, cfg *config.Config) int {
 	mainDirs, err := pkg.GoMainDirs(packages, cfg.GoCmd)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
-		return 1
+		return nil, nil, false
 	}
 
-	// Determine the platforms we're building for
+	platforms := buildPlatforms(cfg)
+	if len(platforms) == 0 {
+		return nil, nil, false
+	}
+
+	if err := checkModMode(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, nil, false
+	}
+
+	if cfg.Universal {
+		if err := checkUniversal(cfg, platforms); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return nil, nil, false
+		}
+	}
+
+	return mainDirs, platforms, true
+}
+
+// setParallel defaults the amount of parallelism to the number of CPUs,
+// leaving one for the rest of the system.
+func setParallel(cfg *config.Config) {
+	if cfg.Parallel < 2 {
+		cpus := runtime.NumCPU()
+		if cpus != 1 {
+			cfg.Parallel = cpus - 1
+		} else {
+			cfg.Parallel = cpus
+		}
+	}
+}
+
+// buildPlatforms determines the platforms we're building for. An empty
+// list is returned, after telling the user, if nothing matched.
+func buildPlatforms(cfg *config.Config) []config.Platform {
 	platforms := cfg.PlatformFlag.Platforms(config.SupportedPlatforms())
 	if len(platforms) == 0 {
 		fmt.Println("No valid platforms to build for. If you specified a value")
 		fmt.Println("for the 'os', 'arch', or 'osarch' flags, make sure you're")
 		fmt.Println("using a valid value.")
-		return 1
 	}
 
+	return platforms
+}
+
+// checkModMode clears cfg.ModMode when the go compiler is too old to
+// support the -mod flag.
+func checkModMode(cfg *config.Config) error {
 	versionStr := pkg.GoVersion()
 	// Assume -mod is supported when no version prefix is found
 	if cfg.ModMode != "" && strings.HasPrefix(versionStr, "go") {
 		// go-version only cares about version numbers
 		current, err := version.NewVersion(versionStr[2:])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to parse current go version: %s\n%s", versionStr, err.Error())
-			return 1
+			return fmt.Errorf("Unable to parse current go version: %s\n%s", versionStr, err.Error())
 		}
 
 		constraint, err := version.NewConstraint(">= 1.11")
@@ -104,38 +179,278 @@ func main(args []string, cfg *config.Config) int {
 		}
 	}
 
-	// Build in parallel!
-	fmt.Printf("Number of parallel builds: %d\n\n", cfg.Parallel)
-	var errorLock sync.Mutex
+	return nil
+}
+
+// compileFunc compiles a single package for a single platform.
+type compileFunc func(cfg *config.Config, platform config.Platform, path string) error
+
+// buildJob is one package to compile for one platform.
+type buildJob struct {
+	Platform config.Platform
+	Path     string
+}
+
+// buildJobs returns a job for every package and platform pair that is part
+// of the shard selected in cfg. Jobs are sorted by platform and package so
+// that the list, and therefore the shards, don't depend on the order the
+// platforms were given in. With cfg.Universal, the darwin jobs of a
+// package that are merged into a universal binary are dealt out together.
+func buildJobs(cfg *config.Config, platforms []config.Platform, paths []string) []buildJob {
+	all := make([]buildJob, 0, len(platforms)*len(paths))
+	for _, platform := range platforms {
+		for _, path := range paths {
+			all = append(all, buildJob{Platform: platform, Path: path})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Platform.String() != all[j].Platform.String() {
+			return all[i].Platform.String() < all[j].Platform.String()
+		}
+		return all[i].Path < all[j].Path
+	})
+
+	// Jobs are dealt out by slot, the darwin jobs of a universal binary
+	// sharing the slot of the first.
+	slots := make([]int, len(all))
+	universalSlots := make(map[string]int)
+	next := 0
+	for i, job := range all {
+		if cfg.Universal && isUniversalArch(job.Platform) {
+			if slot, ok := universalSlots[job.Path]; ok {
+				slots[i] = slot
+				continue
+			}
+			universalSlots[job.Path] = next
+		}
+		slots[i] = next
+		next++
+	}
+
+	jobs := make([]buildJob, 0, len(all))
+	for i, job := range all {
+		if cfg.Shard.Includes(slots[i]) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
+
+// buildResult is the outcome of compiling one package for one platform.
+type buildResult struct {
+	buildJob
+
+	// Config is the configuration the job was built with, after the
+	// overrides for its platform were applied.
+	Config *config.Config
+
+	// Output is the path of the binary, once built. Extra are the other
+	// files the build wrote, like the C header of c-shared builds.
+	Output string
+	Extra  []string
+
+	// Binary is what the binary was found to be built for, nil if it
+	// wasn't checked.
+	Binary *verify.Binary
+
+	Elapsed time.Duration
+	Err     error
+
+	// Steps are run on the binary after a successful build, like
+	// packaging it, in order.
+	Steps []buildStep
+}
+
+// buildStep is the outcome of a step run on a built binary.
+type buildStep struct {
+	Name string
+
+	// Outputs are the files the step wrote.
+	Outputs []string
+
+	Elapsed time.Duration
+	Err     error
+}
+
+// build runs compile for every job in parallel and reports the errors,
+// returning the exit code.
+func build(cfg *config.Config, jobs []buildJob, compile compileFunc) int {
+	results, err := runBuilds(cfg, jobs, compile)
+	if err == nil && cfg.Universal {
+		results, err = addUniversal(cfg, results)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	release := runSteps(cfg, results)
+
+	r := report.New()
+	addBuilds(r, results)
+	addRelease(r, release)
+	if err := writeReports(cfg, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %s\n", err)
+		return 1
+	}
+
+	return reportErrors(results, release)
+}
+
+// runBuilds runs compile for every job, at most cfg.Parallel at a time,
+// and returns the results in job order. The configuration of every job is
+// checked first, a mistake in it stops everything before the first build.
+func runBuilds(cfg *config.Config, jobs []buildJob, compile compileFunc) ([]buildResult, error) {
+	if cfg.BuildInfo {
+		dir, err := ioutil.TempDir("", "gox-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		withWorkDir := *cfg
+		withWorkDir.WorkDir = dir
+		cfg = &withWorkDir
+	}
+
 	var wg sync.WaitGroup
-	errors := make([]string, 0)
+	results := make([]buildResult, 0, len(jobs))
+	progressJobs := make([]progress.Job, 0, len(jobs))
 	semaphore := make(chan int, cfg.Parallel)
-	for _, platform := range platforms {
-		for _, path := range mainDirs {
-			// Start the goroutine that will do the actual build
-			wg.Add(1)
-			go func(path string, platform config.Platform) {
-				defer wg.Done()
-				semaphore <- 1
-				fmt.Printf("--> %15s: %s\n", platform.String(), path)
-
-				// Determine if we have specific CFLAGS or LDFLAGS for this
-				// GOOS/GOARCH combo and override the defaults if so.
-				envOverride(&cfg.Ldflags, platform, "LDFLAGS")
-				envOverride(&cfg.Gcflags, platform, "GCFLAGS")
-				envOverride(&cfg.Asmflags, platform, "ASMFLAGS")
-
-				if err := pkg.GoCrossCompile(cfg, platform, path); err != nil {
-					errorLock.Lock()
-					defer errorLock.Unlock()
-					errors = append(errors,
-						fmt.Sprintf("%s error: %s", platform.String(), err))
-				}
-				<-semaphore
-			}(path, platform)
+	var modes buildModeCheck
+	var toolchainErrs []string
+	checked := make(map[string]bool)
+	for _, job := range jobs {
+		// Every job gets its own copy of the configuration with the
+		// overrides for its platform, so that they don't leak into other
+		// jobs.
+		jobCfg, _, err := jobConfig(cfg, job.Platform)
+		if err == nil {
+			_, err = pkg.Ldflags(jobCfg, job.Platform, job.Path)
+		}
+		if err == nil {
+			err = modes.Check(jobCfg, job.Platform)
 		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", job.Platform.String(), err)
+		}
+
+		// A missing C compiler is reported for every platform at once,
+		// rather than as a linker failure in the middle of the build.
+		if pkg.CgoEnabled(jobCfg, job.Platform) && !checked[job.Platform.String()] {
+			checked[job.Platform.String()] = true
+			if _, err := pkg.CgoToolchain(jobCfg, job.Platform); err != nil {
+				toolchainErrs = append(toolchainErrs, fmt.Sprintf("%s: %s", job.Platform.String(), err))
+			}
+		}
+
+		results = append(results, buildResult{buildJob: job, Config: jobCfg})
+		progressJobs = append(progressJobs, progress.Job{Platform: job.Platform.String(), Name: job.Path})
+	}
+
+	switch len(toolchainErrs) {
+	case 0:
+	case 1:
+		return nil, errors.New(toolchainErrs[0])
+	default:
+		return nil, fmt.Errorf("missing C toolchains:\n  %s", strings.Join(toolchainErrs, "\n  "))
+	}
+
+	// Build in parallel!
+	if !cfg.Quiet {
+		fmt.Printf("Number of parallel builds: %d\n\n", cfg.Parallel)
+	}
+
+	ui := newReporter(cfg, progressJobs)
+	defer setStdout(results, ui)()
+
+	for i := range results {
+		// Start the goroutine that will do the actual build
+		wg.Add(1)
+		go func(job int, result *buildResult) {
+			defer wg.Done()
+			semaphore <- 1
+			ui.Start(job)
+
+			start := time.Now()
+			result.Err = compile(result.Config, result.Platform, result.Path)
+			if result.Err == nil {
+				result.Output, result.Err = pkg.OutputPath(result.Config, result.Platform, result.Path)
+			}
+			if result.Err == nil && result.Config.BuildMode != "c-archive" {
+				result.Binary, result.Err = verify.File(result.Output, result.Platform.OS, result.Platform.Arch)
+			}
+			if result.Err == nil && pkg.Static(result.Config, result.Platform) {
+				result.Err = pkg.CheckStatic(result.Output)
+			}
+			if header := pkg.HeaderPath(result.Config.BuildMode, result.Output); result.Err == nil && header != "" {
+				if _, err := os.Stat(header); err == nil {
+					result.Extra = append(result.Extra, header)
+				}
+			}
+			result.Elapsed = time.Since(start)
+			ui.Finish(job, result.Err)
+			<-semaphore
+		}(i, &results[i])
 	}
 	wg.Wait()
+	ui.Close()
+
+	return results, nil
+}
+
+// newReporter returns the progress reporter for the jobs: a live table
+// when writing to a terminal, a line per job otherwise.
+func newReporter(cfg *config.Config, jobs []progress.Job) progress.Reporter {
+	switch {
+	case cfg.Quiet:
+		return progress.NewQuiet(os.Stdout)
+	case cfg.Plain || !progress.IsTerminal(os.Stdout):
+		return progress.NewLines(os.Stdout, jobs)
+	default:
+		return progress.NewLive(os.Stdout, jobs, cfg.Parallel)
+	}
+}
+
+// setStdout sends the verbose output of the jobs to the reporter so that it
+// doesn't garble the progress display. It is set on the configuration of
+// every job, which are copies made before the reporter exists. The returned
+// func restores it.
+func setStdout(results []buildResult, ui progress.Reporter) func() {
+	stdout := make([]io.Writer, len(results))
+	for i := range results {
+		stdout[i] = results[i].Config.Stdout
+		results[i].Config.Stdout = ui
+	}
+	return func() {
+		for i := range results {
+			results[i].Config.Stdout = stdout[i]
+		}
+	}
+}
+
+// reportErrors prints the errors of the failed builds, returning the exit
+// code.
+func reportErrors(results []buildResult, release []buildStep) int {
+	errors := make([]string, 0)
+	for _, result := range results {
+		if result.Err != nil {
+			errors = append(errors,
+				fmt.Sprintf("%s error: %s", result.Platform.String(), result.Err))
+		}
+		for _, step := range result.Steps {
+			if step.Err != nil {
+				errors = append(errors,
+					fmt.Sprintf("%s %s error: %s", result.Platform.String(), step.Name, step.Err))
+			}
+		}
+	}
+	for _, step := range release {
+		if step.Err != nil {
+			errors = append(errors, fmt.Sprintf("%s error: %s", step.Name, step.Err))
+		}
+	}
 
 	if len(errors) > 0 {
 		fmt.Fprintf(os.Stderr, "\n%d errors occurred:\n", len(errors))
@@ -148,12 +463,22 @@ func main(args []string, cfg *config.Config) int {
 	return 0
 }
 
-func envOverride(target *string, platform config.Platform, key string) {
-	key = strings.ToUpper(fmt.Sprintf(
-		"GOX_%s_%s_%s", platform.OS, platform.Arch, key))
-	if v := os.Getenv(key); v != "" {
-		*target = v
+// jobConfig returns a copy of cfg with the overrides for platform applied,
+// along with the overrides.
+func jobConfig(cfg *config.Config, platform config.Platform) (*config.Config, []config.Override, error) {
+	// The environment wins over the configuration file.
+	env, err := config.EnvOverrides(os.Environ(), platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides := append(config.RuleOverrides(cfg.Platforms, platform), env...)
+
+	c, err := cfg.WithOverrides(overrides)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	return c, overrides, nil
 }
 
 func Execute() {
@@ -175,7 +500,10 @@ Output path template:
   The output path for the compiled binaries is specified with the
   "--output" flag. The value is a string that is a Go text template.
   The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}". The variables and
-  their values should be self-explanatory.
+  their values should be self-explanatory. "{{.Package}}" is the full
+  import path of the package being built. The version information used by
+  "--stamp" is available as "{{.Version}}", "{{.Revision}}", "{{.Commit}}",
+  "{{.Branch}}", "{{.Dirty}}" and "{{.Built}}".
 
 Platforms (OS/Arch):
 
@@ -196,6 +524,256 @@ Platforms (OS/Arch):
   built even if the specific os and arch is negated in "--os" and "--arch",
   respectively.
 
+Compiler and linker flags:
+
+  The values of "--ldflags", "--gcflags" and "--asmflags" are split like a
+  shell would, so fields may be quoted with single or double quotes, but
+  backslashes are kept as they are, as in Windows paths. Repeating one of
+  these flags adds to its flags instead of replacing them, as does the
+  "_APPEND" form of the overrides below. Malformed quoting is reported
+  before anything is built.
+
+  "--define name=value" sets the string variable "name", qualified with its
+  import path as in "main.version", with the linker's -X flag. The value is
+  a template with the same variables as the output path, for example:
+
+    gox --ldflags "-s -w" --define 'main.platform={{.OS}}/{{.Arch}}'
+
+  "--stamp importpath" sets the VERSION, REVISION, BRANCH and BUILT
+  variables of that package, like pkg/version, from the git repository in
+  the working directory: the output of "git describe --tags --always
+  --dirty", the first 8 characters of the commit hash, the branch (or a
+  branch pointing at the commit when the HEAD is detached) and the commit
+  time, or SOURCE_DATE_EPOCH if set. "--define" wins over these. Outside of
+  a git checkout the variables get their usual defaults.
+
+  "--buildinfo" adds a generated gox_buildinfo.go file to every package
+  being built, declaring a typed BuildInfo variable with the fields and
+  methods of version.AppVersionInfo, the build time being a string in RFC
+  3339 format as with "--stamp", followed by the full commit hash, whether
+  the tree was dirty and the build tags. The file is passed to the go
+  command with -overlay from a temporary directory and never written to the
+  source tree. The "gox_buildinfo" build tag is set for these builds, so a
+  file with "//go:build !gox_buildinfo" can declare a fallback BuildInfo
+  for plain "go build".
+
+Cgo:
+
+  "--cgo" enables cgo for every platform, while it is only enabled for
+  the host platform by default. Builds for other platforms need a C cross
+  compiler: unless CC is set for the platform, the usual cross compilers
+  are looked up on the PATH, like aarch64-linux-gnu-gcc for linux/arm64,
+  x86_64-w64-mingw32-gcc for windows/amd64 or o64-clang from osxcross for
+  darwin/amd64, along with their C++ compiler and archiver. A CC set in
+  the environment of gox is only used for the platforms it targets, as
+  told by "$CC -dumpmachine", so that a host-wide CC=gcc doesn't build
+  for the others. A platform without a C compiler is reported before
+  anything is built.
+
+  The C toolchain can be set per platform with the cc, cxx, ar,
+  pkg_config_path, cgo_cflags, cgo_cxxflags and cgo_ldflags settings of
+  the configuration file rules, or the GOX_[OS]_[ARCH]_* variables below.
+  "sysroot" adds --sysroot to the C flags and points pkg-config at the
+  target system's packages:
+
+    platforms:
+      linux/arm64:
+        sysroot: /srv/sysroots/arm64
+        cgo_ldflags: -L/srv/sysroots/arm64/opt/lib
+
+  "--cgo-toolchain zig" compiles the C code of every platform with
+  "zig cc -target", so that linux, windows and macOS binaries can all be
+  built from one machine with nothing but zig installed. The target is
+  picked from the platform, as in aarch64-linux-gnu or x86_64-windows-gnu,
+  honoring GOARM and GOMIPS. "--cgo-libc" selects the C library of the
+  linux binaries: "gnu" by default, "gnu.2.17" or another version to link
+  against that glibc so that the binaries run on older systems, or "musl".
+  Both can be set per platform with the cgo_toolchain and cgo_libc rule
+  settings, and a CC set for a platform wins over zig:
+
+    gox --cgo --cgo-toolchain zig --cgo-libc gnu.2.17 \
+      --osarch "linux/amd64 linux/arm64 windows/amd64 darwin/arm64"
+
+Static binaries:
+
+  "--static" links the binaries of linux builds statically, so that they
+  run on any distribution. Builds without cgo are static already. With cgo,
+  the external linker gets -static through -extldflags and the "netgo" and
+  "osusergo" tags replace the host and user lookups of the C library by the
+  pure Go ones. The zig toolchain links them with musl. With "--buildmode
+  pie", the executables are linked externally with -static-pie, which needs
+  cgo and GCC 8 or later. Only executables can be static. Every binary is
+  then checked and the job fails if it still has a program interpreter or
+  needs shared libraries, which are listed.
+
+Build modes:
+
+  "--buildmode" passes -buildmode to the go command: "pie" for position
+  independent executables, "c-shared" and "c-archive" for C libraries and
+  "plugin" for Go plugins. It can be set per platform like the other
+  settings. Every job's mode is checked against its platform, using the
+  ports listed by "go tool dist list", before anything is built, and by
+  "gox plan" and "--dry-run" too. The C library and plugin modes need
+  cgo. Libraries are named with the output path template plus .so, .dll
+  or .dylib for "c-shared", .a for "c-archive" and .so for "plugin". The
+  C header generated next to them is archived, checksummed and signed
+  along with them.
+
+Universal macOS binaries:
+
+  "--universal" merges the darwin/amd64 and darwin/arm64 binaries of every
+  package into a universal binary running on both Intel and Apple silicon
+  Macs, like lipo does. It is named with the output path template, with
+  "universal" as {{.Arch}}, as in "app_darwin_universal", and is
+  archived, checksummed, signed and reported like the binary of a
+  darwin/universal build. Both darwin builds must be selected, or neither
+  for a run building other platforms, in the same build mode: the
+  default, "pie" or "c-shared", as the archives of "c-archive" can't be
+  merged. "--shard" deals both darwin jobs of a package to the same
+  shard, and "gox plan --ci" gives them a single darwin/universal entry.
+
+Windows resources:
+
+  The "windows_resources" section of the configuration file links the
+  version information, an icon and an application manifest into the
+  binaries of the windows builds, for Explorer and software inventory
+  tools. Its icon and manifest settings are the paths of a .ico file and
+  of a manifest. The version, "{{.Version}}" by default, company,
+  product and description, both defaulting to the package name,
+  copyright, trademarks and comments are templates like the output path.
+
+    windows_resources:
+      icon: assets/app.ico
+      company: Example Corp
+      copyright: Copyright 2024 Example Corp
+
+  The go command only links .syso objects found in the package directory,
+  so the resources are written to a gox_resources_windows_[arch].syso
+  object there for the duration of the go command, and removed after it
+  or when gox is interrupted. Gox never writes over an existing file of
+  that name: a build finding one fails, and the file left behind by a
+  killed run has to be removed.
+
+Archives:
+
+  "--archive" packages every binary in an archive after it is built: a zip
+  for windows and a tar.gz for other platforms, or the format given with
+  "--archive=tar.gz", "--archive=tar.zst" or "--archive=zip". Archives are
+  written next to the binaries with the same name, or at the path template
+  given with "--archive-name", without extension. "--archive-file" adds
+  files matching a glob, directories included, and can be repeated.
+  "--archive-dir" is a template of a directory wrapping the files in the
+  archive. All templates have the same variables as the output path.
+
+  Archives are reproducible: entries are sorted, owned by root and have
+  the commit time (or SOURCE_DATE_EPOCH) as modification time. The
+  configuration file has the same settings in an "archive" section:
+
+    archive:
+      format: auto
+      dir: "{{.Dir}}_{{.Version}}_{{.OS}}_{{.Arch}}"
+      files: [README.md, LICENSE]
+
+Linux packages:
+
+  "--packages=deb,rpm,apk" installs the binary of every linux build with a
+  package of each format, written next to it and named after the
+  conventions of the format, as in "app_1.2.0_amd64.deb". The binary is
+  installed as /usr/bin/<package directory>. The packages are described by
+  the "packages" section of the configuration file, which alone turns them
+  on in the formats given, or all three:
+
+    packages:
+      formats: [deb, rpm]
+      name: "{{.Dir}}"
+      version: "{{.Version}}"
+      maintainer: Ops <ops@example.com>
+      description: One line summary
+      homepage: https://example.com
+      license: MIT
+      depends: [ca-certificates]
+      rpm:
+        depends: ["glibc >= 2.17"]
+      bindir: /usr/bin
+      files:
+        - {src: README.md, dst: /usr/share/doc/app/}
+      config_files:
+        - {src: app.yml, dst: /etc/app/app.yml}
+      systemd_units: [app.service]
+      scripts:
+        postinstall: scripts/postinstall.sh
+
+  The name and version are templates with the same variables as the output
+  path. The maintainer, which debs require, defaults to the author of the
+  commit, and with neither debs are refused before anything is built. The
+  version is made valid for each format, so that a git describe version
+  like v1.2.0-3-g1a2b3c4 sorts after 1.2.0. The "deb", "rpm" and "apk"
+  sections replace the dependencies for that format. Configuration files
+  are kept on upgrades when they were changed, and systemd units are
+  installed in /usr/lib/systemd/system. GOARCH is mapped to the
+  architecture names of each format, like x86_64 for amd64 in rpm and apk
+  packages and armhf for arm with GOARM=7 in deb packages. Like archives,
+  packages are reproducible.
+
+Container images:
+
+  "--oci image" assembles a multi-platform container image of the linux
+  binaries in an OCI image layout directory, or in a tarball with
+  "--oci image.tar", without a container daemon or network access. Every
+  architecture built gets an image with the binaries in /usr/local/bin and
+  is listed in an image index named after the version. Tools like skopeo,
+  podman and crane load the result, for example with
+  "skopeo copy oci:image:1.2.0 docker://registry.example.com/app:1.2.0".
+
+  The image starts from scratch, or from the image in the layout given
+  with "--oci-base", as in "--oci-base distroless:latest", which must
+  have an image for every architecture. The "oci" section of the
+  configuration file sets the rest, the tag and labels being templates:
+
+    oci:
+      path: image.tar
+      base: distroless
+      tag: "{{.Version}}"
+      entrypoint: [/usr/local/bin/app, serve]
+      user: "65532:65532"
+      workdir: /data
+      env: {MODE: production}
+      labels:
+        org.opencontainers.image.version: "{{.Version}}"
+      files:
+        - {src: config.yml, dst: /etc/app/}
+
+  The entrypoint defaults to the binary when there is only one. Like
+  archives, images are reproducible.
+
+Checksums:
+
+  "--checksums" writes the SHA-256 checksums of the binaries, archives,
+  packages and image tarball built by the run, in the format of sha256sum,
+  to a SHA256SUMS file in the directory containing them all, or to the file
+  given with "--checksums-file". "--checksums=sha512" and
+  "--checksums=blake2b" use those algorithms and the SHA512SUMS and B2SUMS
+  files instead. "--checksums-sidecars" also writes the checksum of every
+  artifact next to it, as in "app_linux_amd64.tar.gz.sha256". Only the
+  files of the run are listed, and nothing is written when a build fails.
+  The configuration file has an equivalent "checksums" section with the
+  algorithm, file and sidecars settings.
+
+Signing:
+
+  "--sign pgp" writes an armored OpenPGP detached signature next to every
+  binary, archive, image tarball and the checksum file, as in
+  "app_linux_amd64.asc", and "--sign minisign" a minisign signature, as in
+  "app_linux_amd64.minisig". The secret key is read from the file given
+  with "--sign-key", or else from the GOX_SIGN_KEY environment variable
+  holding the key itself. The passphrase of an encrypted key is read from
+  the file given with "--sign-passphrase-file", or else from
+  GOX_SIGN_PASSPHRASE. OpenPGP keys may be RSA, DSA, ECDSA or Ed25519 keys,
+  and sign with a signing subkey when they have one. The key is loaded
+  before anything is built, and the signatures are listed in the "--junit"
+  and "--tap" reports. The configuration file has an equivalent "sign"
+  section with the kind, key and passphrase_file settings.
+
 Platform Overrides:
 
   The "--gcflags", "--ldflags" and "--asmflags" options can be overridden per-platform
@@ -206,29 +784,179 @@ Platform Overrides:
     GOX_[OS]_[ARCH]_LDFLAGS
     GOX_[OS]_[ARCH]_ASMFLAGS
 
+  The same goes for the other settings:
+
+    GOX_[OS]_[ARCH]_TAGS        build tags
+    GOX_[OS]_[ARCH]_OUTPUT      output path template
+    GOX_[OS]_[ARCH]_CGO         enable (1) or disable (0) cgo
+    GOX_[OS]_[ARCH]_CC          C compiler, for cgo
+    GOX_[OS]_[ARCH]_CXX         C++ compiler, for cgo
+    GOX_[OS]_[ARCH]_AR          archiver, for cgo
+    GOX_[OS]_[ARCH]_SYSROOT     root of the target's headers and libraries
+    GOX_[OS]_[ARCH]_CGO_TOOLCHAIN and _CGO_LIBC
+                                C toolchain and library, see "Cgo"
+    GOX_[OS]_[ARCH]_PKG_CONFIG_PATH, _CGO_CFLAGS, _CGO_CXXFLAGS
+      and _CGO_LDFLAGS          the variables of the same name, for cgo
+    GOX_[OS]_[ARCH]_MOD         go mod mode
+    GOX_[OS]_[ARCH]_BUILDMODE   go build mode
+    GOX_[OS]_[ARCH]_ENV_[NAME]  sets the environment variable NAME
+
+  Adding "_APPEND" to the name of a flags or tags variable, as in
+  GOX_WINDOWS_AMD64_LDFLAGS_APPEND, adds its value to the flags instead of
+  replacing them. Overrides only ever apply to the jobs of their platform.
+
+Configuration file:
+
+  Settings can also be kept in a YAML file, ".gox.yml" in the working
+  directory or the one given with "--config". Its top-level settings are
+  those of the flags (ldflags, gcflags, asmflags, tags, output, cgo,
+  cgo_toolchain, cgo_libc, static, mod, buildmode, parallel) plus "env", a
+  map of environment variables, and "define", a map of variables to set
+  like "--define", "stamp", "buildinfo", "universal", "windows_resources",
+  "archive", "packages", "oci", "checksums", "sign" and "manifests" (see
+  "gox publish-manifests --help"). Flags given on the command line take
+  precedence over them.
+
+  The "platforms" section overrides settings per platform, keyed by os/arch
+  patterns that may use wildcards:
+
+    ldflags: -s -w
+    platforms:
+      windows/*:
+        ldflags_append: -H windowsgui
+      linux/arm:
+        tags: noasm
+        env:
+          GOARM: "6"
+
+  A rule accepts ldflags, gcflags, asmflags, tags (each with an "_append"
+  variant), output, cgo, cc, cxx, ar, sysroot, pkg_config_path, cgo_cflags,
+  cgo_cxxflags, cgo_ldflags, cgo_toolchain, cgo_libc, mod, buildmode and
+  env. The settings of a job are resolved in this order, later ones
+  winning:
+
+    1. the flags, or the top-level settings of the file
+    2. the matching rules, from "*/*" to "os/*" or "*/arch" to "os/arch",
+       in the order of the file when as specific
+    3. the GOX_[OS]_[ARCH]_* environment variables
+
+  "gox plan" shows which rule or variable set each value.
+
+Progress:
+
+  When the output is a terminal, Gox shows a live table of the running
+  jobs with their elapsed time, how many are queued, succeeded and failed
+  and an estimate of the time left. Otherwise, or with "--plain", a line
+  is printed as each job starts. "-q" only prints errors while "-v" also
+  prints the go commands that are run and their output.
+
+  "-x" prints each command exactly as it is run, preceded by the GOOS,
+  GOARCH, CGO_ENABLED and other variables it sets, and by a "cd" when it
+  runs in another directory. "gox plan --emit-script build.sh" writes
+  these commands to a shell script that builds everything without Gox.
+
+Sharding:
+
+  "--shard i/n" only builds the i-th of n slices of the jobs, so that a
+  large build can be spread over n machines. Jobs are sorted by platform
+  and package and dealt out in turn, so every shard gets its share of
+  each platform and the same flags always select the same jobs, with
+  "--universal" keeping the darwin jobs of a package together. See
+  "gox plan --ci" to generate the matching CI configuration.
+
+Planning:
+
+  "--dry-run", or "gox plan", resolves the packages, platforms, overrides,
+  cgo setting and output path of every job and prints them without
+  building anything. "gox plan --json" prints them as JSON whose layout
+  only changes when the build settings do, so that it can be diffed.
+
+Reports:
+
+  "--junit file.xml" writes a JUnit XML report with a testsuite per
+  platform and a testcase per package built for it. Failed builds carry
+  the compiler errors. "--tap file" writes the same results as a TAP
+  stream, use "-" to write it to stdout.
+
+  Every binary is checked after it is built: the job fails unless its
+  object format, machine type, bitness and byte order are those of its
+  platform, as when a GOARCH set in the environment or an override builds
+  for another one. The attributes found are recorded as properties of the
+  build in the reports. The XCOFF binaries of aix and the archives of
+  "c-archive" builds aren't checked.
+
+Test binaries:
+
+  "gox test -c" compiles the test binary of every package with test files
+  for each platform instead. See "gox test --help".
+
 `
 
 func init() {
 	rootCmd.Flags().SortFlags = false
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the build jobs without building anything")
+	addBuildFlags(rootCmd.Flags())
+	addStepFlags(rootCmd.Flags())
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+}
 
-	rootCmd.Flags().StringSliceVar(&cfg.PlatformFlag.OS, "os", nil, "os to build for or skip")
-	rootCmd.Flags().StringSliceVar(&cfg.PlatformFlag.Arch, "arch", nil, "arch to build for or skip")
-	rootCmd.Flags().Var(cfg.PlatformFlag.OSArchFlagValue(), "osarch", "os/arch pairs to build for or skip")
-	rootCmd.Flags().BoolVar(&cfg.PlatformFlag.All, "all", false, "build all supported platforms")
-
-	rootCmd.Flags().StringVar(&cfg.Tags, "tags", "", "go build tags")
-	rootCmd.Flags().StringVar(&cfg.Output, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "output path")
-
-	rootCmd.Flags().IntVar(&cfg.Parallel, "parallel", -1, "amount of parallelism, defaults to number of cpus")
-	rootCmd.Flags().BoolVar(&cfg.BuildToolchain, "build-toolchain", false, "build cross-compilation toolchain")
-	rootCmd.Flags().BoolVar(&cfg.Cgo, "cgo", false, "sets cgo_enabled=1, requires proper c toolchain (advanced)")
-	rootCmd.Flags().BoolVar(&cfg.Rebuild, "rebuild", false, "force rebuilding of package that were up to date")
-	rootCmd.Flags().BoolVar(&cfg.Race, "race", false, "build with the go race detector enabled, requires cgo")
-
-	rootCmd.Flags().StringVar(&cfg.Ldflags, "ldflags", "", "linker flags")
-	rootCmd.Flags().StringVar(&cfg.Gcflags, "gcflags", "", "gcflags, eg:all=-trimpath=${GOPATH}")
-	rootCmd.Flags().StringVar(&cfg.Asmflags, "asmflags", "", "asmflags, eg:all=-trimpath=${GOPATH}")
-	rootCmd.Flags().StringVar(&cfg.GoCmd, "gocmd", "go", "go cmd")
-	rootCmd.Flags().StringVar(&cfg.ModMode, "mod", "", "go mod mode")
+// addStepFlags adds the flags of the steps run on the built binaries.
+func addStepFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&cfg.Universal, "universal", false, "merge the darwin/amd64 and darwin/arm64 binaries into a darwin/universal one")
+	flags.StringVar(&cfg.Archive, "archive", "", "package every binary in an archive: auto, tar.gz, tar.zst or zip")
+	flags.Lookup("archive").NoOptDefVal = "auto"
+	flags.StringVar(&cfg.ArchiveName, "archive-name", "", "archive path template, without extension, defaults to the binary's")
+	flags.StringVar(&cfg.ArchiveDir, "archive-dir", "", "directory template wrapping the files in the archives")
+	flags.StringArrayVar(&cfg.ArchiveFiles, "archive-file", nil, "extra file or glob to add to the archives (can be repeated)")
+	flags.StringSliceVar(&cfg.Packages, "packages", nil, "install the linux binaries with packages: deb, rpm and/or apk")
+	flags.StringVar(&cfg.OCI, "oci", "", "assemble a container image of the linux binaries in this OCI layout directory or .tar")
+	flags.StringVar(&cfg.OCIBase, "oci-base", "", "OCI layout directory or .tar of the base image, optionally followed by :name")
+	flags.StringVar(&cfg.Checksums, "checksums", "", "write a checksum file for the binaries, archives and image: sha256, sha512 or blake2b")
+	flags.Lookup("checksums").NoOptDefVal = "sha256"
+	flags.StringVar(&cfg.ChecksumsFile, "checksums-file", "", "path of the checksum file, defaults to SHA256SUMS or similar next to the artifacts")
+	flags.BoolVar(&cfg.ChecksumsSidecars, "checksums-sidecars", false, "also write a .sha256 or similar file next to every artifact")
+	flags.StringVar(&cfg.Sign, "sign", "", "sign the binaries, archives, image and checksum file: pgp or minisign")
+	flags.StringVar(&cfg.SignKey, "sign-key", "", "secret key file, defaults to the key in $GOX_SIGN_KEY")
+	flags.StringVar(&cfg.SignPassphraseFile, "sign-passphrase-file", "", "file holding the passphrase of the key, defaults to $GOX_SIGN_PASSPHRASE")
+}
 
+// addBuildFlags registers the flags shared by every command that compiles
+// packages, bound to the global cfg.
+func addBuildFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&cfg.PlatformFlag.OS, "os", nil, "os to build for or skip")
+	flags.StringSliceVar(&cfg.PlatformFlag.Arch, "arch", nil, "arch to build for or skip")
+	flags.Var(cfg.PlatformFlag.OSArchFlagValue(), "osarch", "os/arch pairs to build for or skip")
+	flags.BoolVar(&cfg.PlatformFlag.All, "all", false, "build all supported platforms")
+
+	flags.StringVar(&cfg.Tags, "tags", "", "go build tags")
+	flags.StringVar(&cfg.Output, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "output path")
+
+	flags.IntVar(&cfg.Parallel, "parallel", -1, "amount of parallelism, defaults to number of cpus")
+	flags.Var(&cfg.Shard, "shard", "only build the i-th of n slices of the jobs, as i/n")
+	flags.BoolVar(&cfg.BuildToolchain, "build-toolchain", false, "build cross-compilation toolchain")
+	flags.BoolVar(&cfg.Cgo, "cgo", false, "sets cgo_enabled=1, requires proper c toolchain (advanced)")
+	flags.StringVar(&cfg.CgoToolchain, "cgo-toolchain", "", "compile the C code of cgo builds for every platform with: zig")
+	flags.StringVar(&cfg.CgoLibc, "cgo-libc", "", "C library of linux builds with zig: gnu, gnu.X.Y for a glibc version, or musl")
+	flags.BoolVar(&cfg.Static, "static", false, "link the linux binaries statically, even with cgo, and check that they are")
+	flags.BoolVar(&cfg.Rebuild, "rebuild", false, "force rebuilding of package that were up to date")
+	flags.BoolVar(&cfg.Race, "race", false, "build with the go race detector enabled, requires cgo")
+
+	flags.Var(config.FlagsValue(&cfg.Ldflags), "ldflags", "linker flags, merged when repeated")
+	flags.Var(config.DefineValue(&cfg.Defines), "define", "set a string variable with -X, eg:main.version=1.0 (can be repeated)")
+	flags.StringVar(&cfg.Stamp, "stamp", "", "import path of a package to set the git version information in, eg:github.com/you/app/version")
+	flags.BoolVar(&cfg.BuildInfo, "buildinfo", false, "add a generated BuildInfo variable with the build metadata to the packages")
+	flags.Var(config.FlagsValue(&cfg.Gcflags), "gcflags", "gcflags, eg:all=-trimpath=${GOPATH}")
+	flags.Var(config.FlagsValue(&cfg.Asmflags), "asmflags", "asmflags, eg:all=-trimpath=${GOPATH}")
+	flags.StringVar(&cfg.ConfigFile, "config", "", "configuration file, defaults to "+config.DefaultFile+" if it exists")
+	flags.StringVar(&cfg.GoCmd, "gocmd", "go", "go cmd")
+	flags.StringVar(&cfg.ModMode, "mod", "", "go mod mode")
+	flags.StringVar(&cfg.BuildMode, "buildmode", "", "go build mode: exe, pie, c-shared, c-archive or plugin")
+
+	flags.BoolVarP(&cfg.Quiet, "quiet", "q", false, "only print errors")
+	flags.BoolVarP(&cfg.Verbose, "verbose", "v", false, "print the go commands and their output")
+	flags.BoolVar(&cfg.Plain, "plain", false, "print a line per job instead of the live progress table")
+	flags.BoolVarP(&cfg.Trace, "trace", "x", false, "print the commands with their environment and directory")
+
+	flags.StringVar(&cfg.JUnit, "junit", "", "write the results as JUnit XML to this file")
+	flags.StringVar(&cfg.TAP, "tap", "", "write the results as a TAP stream to this file, - for stdout")
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/progress"
+	"sync"
+	"testing"
+)
+
+func TestRunBuildsVerboseOutput(t *testing.T) {
+	var stdout bytes.Buffer
+	cfg := &config.Config{Parallel: 2, Quiet: true, Verbose: true, Stdout: &stdout}
+	jobs := []buildJob{
+		{Platform: config.Platform{OS: "linux", Arch: "amd64"}, Path: "a"},
+		{Platform: config.Platform{OS: "windows", Arch: "amd64"}, Path: "a"},
+	}
+
+	// The verbose output of every job goes to the reporter, not to the
+	// writer the configuration had before the reporter was created.
+	var mu sync.Mutex
+	var writers []string
+	compile := func(cfg *config.Config, platform config.Platform, path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := cfg.Stdout.(progress.Reporter); !ok {
+			writers = append(writers, platform.String())
+		}
+		return errors.New("not built")
+	}
+
+	results, err := runBuilds(cfg, jobs, compile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(writers) != 0 {
+		t.Errorf("the verbose output of %v doesn't go to the reporter", writers)
+	}
+
+	// It is restored once the builds are done.
+	for _, result := range results {
+		if result.Config.Stdout != &stdout {
+			t.Errorf("%s: Stdout not restored after the builds", result.Platform.String())
+		}
+	}
+	if cfg.Stdout != &stdout {
+		t.Error("Stdout of the configuration changed")
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/sign"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The environment variables holding the secret key and its passphrase
+// when no files are given, which is handier in CI.
+const (
+	signKeyEnv        = "GOX_SIGN_KEY"
+	signPassphraseEnv = "GOX_SIGN_PASSPHRASE"
+)
+
+// signer is loaded before building, so that a missing key or a wrong
+// passphrase are reported right away.
+var signer sign.Signer
+
+// loadSigner reads the secret key and its passphrase from the files given
+// in cfg or the environment.
+func loadSigner(cfg *config.Config) error {
+	key := []byte(os.Getenv(signKeyEnv))
+	if cfg.SignKey != "" {
+		var err error
+		if key, err = ioutil.ReadFile(cfg.SignKey); err != nil {
+			return fmt.Errorf("reading signing key: %s", err)
+		}
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("signing needs a key, from --sign-key or $%s", signKeyEnv)
+	}
+
+	passphrase := []byte(os.Getenv(signPassphraseEnv))
+	if cfg.SignPassphraseFile != "" {
+		data, err := ioutil.ReadFile(cfg.SignPassphraseFile)
+		if err != nil {
+			return fmt.Errorf("reading signing key passphrase: %s", err)
+		}
+		passphrase = []byte(strings.TrimRight(string(data), "\r\n"))
+	}
+
+	s, err := sign.Load(cfg.Sign, key, passphrase)
+	if err != nil {
+		return err
+	}
+
+	signer = s
+	return nil
+}
+
+// signStep signs the artifacts of the successful builds, the image and the
+// checksum file, returning the signatures.
+func signStep(cfg *config.Config, results []buildResult, release []buildStep) ([]string, error) {
+	files := releaseArtifacts(results, release)
+
+	signatures := make([]string, 0, len(files))
+	for _, file := range files {
+		signature, err := signer.Sign(file)
+		if err != nil {
+			return signatures, err
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"github.com/spf13/pflag"
+	"os"
+	"strings"
+	"sync"
+)
+
+// readStamp sets up cfg to read the version information of the source tree
+// for the templates and the "--stamp" package, the first time one of them
+// uses it, so that git only runs when needed. Outside of a git checkout
+// the defaults are used, with a warning if stamping was asked for.
+func readStamp(flags *pflag.FlagSet, cfg *config.Config) error {
+	// Commands that don't build anything have no "--stamp" flag.
+	if flags.Lookup("stamp") == nil {
+		return nil
+	}
+
+	if cfg.Stamp != "" && strings.ContainsAny(cfg.Stamp, " \t=") {
+		return fmt.Errorf("invalid stamp package %q: it should be an import path", cfg.Stamp)
+	}
+
+	var once sync.Once
+	var info *stamp.Info
+	stampPackage := cfg.Stamp
+	cfg.ReadGit = func() *stamp.Info {
+		once.Do(func() {
+			var err error
+			info, err = stamp.Read(".")
+			if err != nil && stampPackage != "" {
+				fmt.Fprintf(os.Stderr, "Warning: no version information to stamp (%s), using defaults\n",
+					strings.SplitN(err.Error(), "\n", 2)[0])
+			}
+		})
+		return info
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadStampLazy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake git is a shell script")
+	}
+
+	// A git logging its runs.
+	dir := t.TempDir()
+	log := filepath.Join(dir, "runs")
+	script := "#!/bin/sh\necho \"$*\" >> " + log + "\nexit 1\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	runs := func() int {
+		data, err := ioutil.ReadFile(log)
+		if os.IsNotExist(err) {
+			return 0
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+
+	c := &config.Config{}
+	if err := readStamp(rootCmd.Flags(), c); err != nil {
+		t.Fatal(err)
+	}
+	platform := config.Platform{OS: "linux", Arch: "amd64"}
+
+	// Git doesn't run for templates that don't use its information.
+	output, err := pkg.RenderTemplate(c, platform, "example.com/app", "output", "{{.Dir}}_{{.OS}}_{{.Arch}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "app_linux_amd64" {
+		t.Errorf("output %q", output)
+	}
+	if n := runs(); n != 0 {
+		t.Errorf("git ran %d times without being needed", n)
+	}
+
+	// It runs once they do, and only once.
+	for i := 0; i < 2; i++ {
+		version, err := pkg.RenderTemplate(c, platform, "example.com/app", "version", "{{.Version}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != "dev" {
+			t.Errorf("version %q outside of a checkout, want dev", version)
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("git ran %d times, want once", n)
+	}
+}
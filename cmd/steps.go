@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/checksum"
+	"github.com/mitchellh/gox/pkg/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// step is run on the binary of every successful build, returning the files
+// it wrote. The steps of a build see the results of the previous ones in
+// result.Steps.
+type step struct {
+	Name string
+	Run  func(cfg *config.Config, result *buildResult) ([]string, error)
+}
+
+// releaseStep is run once on the artifacts of all the builds, after their
+// steps, returning the files it wrote. The release steps see the results
+// of the previous ones in release.
+type releaseStep struct {
+	Name string
+	Run  func(cfg *config.Config, results []buildResult, release []buildStep) ([]string, error)
+}
+
+// buildSteps returns the steps enabled in cfg, in the order they run.
+func buildSteps(cfg *config.Config) []step {
+	var steps []step
+	if cfg.Archive != "" {
+		steps = append(steps, step{Name: "archive", Run: archiveStep})
+	}
+	if len(cfg.Packages) > 0 {
+		steps = append(steps, step{Name: "package", Run: packageStep})
+	}
+
+	return steps
+}
+
+// releaseSteps returns the release steps enabled in cfg, in the order they
+// run.
+func releaseSteps(cfg *config.Config) []releaseStep {
+	var steps []releaseStep
+	if cfg.OCI != "" {
+		steps = append(steps, releaseStep{Name: "oci", Run: ociStep})
+	}
+	if cfg.Checksums != "" {
+		steps = append(steps, releaseStep{Name: "checksums", Run: checksumsStep})
+	}
+	if cfg.Sign != "" {
+		steps = append(steps, releaseStep{Name: "sign", Run: signStep})
+	}
+	if len(cfg.Manifests) > 0 {
+		steps = append(steps, releaseStep{Name: "manifests", Run: manifestsStep})
+	}
+
+	return steps
+}
+
+// artifacts returns the files produced for a successful build: the binary
+// and the other files of the build followed by the outputs of its steps.
+func artifacts(result *buildResult) []string {
+	if result.Err != nil {
+		return nil
+	}
+
+	files := append([]string{result.Output}, result.Extra...)
+	for _, step := range result.Steps {
+		if step.Err == nil {
+			files = append(files, step.Outputs...)
+		}
+	}
+
+	return files
+}
+
+// releaseArtifacts returns the files of the release so far: the artifacts
+// of the successful builds followed by the outputs of the release steps
+// that ran before. The image is only one when it is a tarball rather than
+// an image layout directory, and the checksum sidecars follow the checksum
+// file, they aren't needed.
+func releaseArtifacts(results []buildResult, release []buildStep) []string {
+	var files []string
+	for i := range results {
+		files = append(files, artifacts(&results[i])...)
+	}
+	for _, step := range release {
+		if step.Err != nil || len(step.Outputs) == 0 {
+			continue
+		}
+
+		switch step.Name {
+		case "oci":
+			if strings.HasSuffix(step.Outputs[0], ".tar") {
+				files = append(files, step.Outputs[0])
+			}
+		case "checksums":
+			files = append(files, step.Outputs[0])
+		default:
+			files = append(files, step.Outputs...)
+		}
+	}
+
+	return files
+}
+
+// checkSteps checks the settings of the steps before anything is built.
+func checkSteps(cfg *config.Config) error {
+	if cfg.Archive != "" {
+		if err := checkArchive(cfg); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Packages) > 0 {
+		if err := checkPackages(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.OCI != "" {
+		if err := checkOCI(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.Checksums != "" {
+		if _, err := checksum.New(cfg.Checksums); err != nil {
+			return err
+		}
+	}
+	if cfg.Sign != "" {
+		if err := loadSigner(cfg); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Manifests) > 0 {
+		if err := checkManifests(cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runSteps runs the steps on the successful builds, at most cfg.Parallel
+// builds at a time, stopping at the first failed step of each build. The
+// release steps are run after them, unless something failed, and their
+// results returned.
+func runSteps(cfg *config.Config, results []buildResult) []buildStep {
+	steps := buildSteps(cfg)
+
+	var wg sync.WaitGroup
+	semaphore := make(chan int, cfg.Parallel)
+	for i := range results {
+		if results[i].Err != nil || len(steps) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *buildResult) {
+			defer wg.Done()
+			semaphore <- 1
+			defer func() { <-semaphore }()
+
+			for _, s := range steps {
+				start := time.Now()
+				outputs, err := s.Run(result.Config, result)
+				result.Steps = append(result.Steps, buildStep{
+					Name:    s.Name,
+					Outputs: outputs,
+					Elapsed: time.Since(start),
+					Err:     err,
+				})
+				if err != nil {
+					return
+				}
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	// A partial release would be mistaken for a complete one.
+	failed := false
+	for _, result := range results {
+		failed = failed || result.Err != nil
+		for _, step := range result.Steps {
+			failed = failed || step.Err != nil
+		}
+	}
+
+	var release []buildStep
+	for _, s := range releaseSteps(cfg) {
+		if failed {
+			break
+		}
+
+		start := time.Now()
+		outputs, err := s.Run(cfg, results, release)
+		release = append(release, buildStep{
+			Name:    s.Name,
+			Outputs: outputs,
+			Elapsed: time.Since(start),
+			Err:     err,
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	if cfg.Quiet || (len(steps) == 0 && len(release) == 0) {
+		return release
+	}
+	fmt.Println()
+	for _, result := range results {
+		for _, s := range result.Steps {
+			for _, output := range s.Outputs {
+				fmt.Printf("--> %15s: %s %s\n", result.Platform.String(), s.Name, relPath(output))
+			}
+		}
+	}
+	for _, s := range release {
+		for _, output := range s.Outputs {
+			fmt.Printf("--> %15s: %s\n", s.Name, relPath(output))
+		}
+	}
+
+	return release
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/checksum"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/sign"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSigner writes the name of the signed file as its signature.
+type testSigner struct{}
+
+func (testSigner) Sign(path string) (string, error) {
+	return path + ".sig", ioutil.WriteFile(path+".sig", []byte(filepath.Base(path)), 0644)
+}
+
+func TestReleaseStepsImage(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "app_linux_amd64")
+	if err := ioutil.WriteFile(binary, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Parallel:  1,
+		Quiet:     true,
+		Git:       stamp.Unknown(),
+		OCI:       filepath.Join(dir, "image.tar"),
+		Checksums: "sha256",
+		Sign:      "minisign",
+	}
+	results := []buildResult{{
+		buildJob: buildJob{Platform: config.Platform{OS: "linux", Arch: "amd64"}, Path: "example.com/app"},
+		Config:   cfg,
+		Output:   binary,
+	}}
+
+	defer func(s sign.Signer) { signer = s }(signer)
+	signer = testSigner{}
+
+	release := runSteps(cfg, results)
+	var names []string
+	for _, step := range release {
+		if step.Err != nil {
+			t.Fatalf("%s: %s", step.Name, step.Err)
+		}
+		names = append(names, step.Name)
+	}
+	if want := []string{"oci", "checksums", "sign"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("release steps %q, want %q", names, want)
+	}
+
+	// The image is listed in the checksum file along with the binary.
+	sums, err := ioutil.ReadFile(filepath.Join(dir, checksum.FileName("sha256")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, line := range strings.Split(strings.TrimSpace(string(sums)), "\n") {
+		fields := strings.Fields(line)
+		listed = append(listed, fields[len(fields)-1])
+	}
+	if want := []string{"app_linux_amd64", "image.tar"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("checksums of %q, want %q", listed, want)
+	}
+
+	// And it is signed, as are the binary and the checksum file.
+	var signed []string
+	for _, signature := range release[2].Outputs {
+		signed = append(signed, filepath.Base(strings.TrimSuffix(signature, ".sig")))
+	}
+	want := []string{"app_linux_amd64", "image.tar", checksum.FileName("sha256")}
+	if !reflect.DeepEqual(signed, want) {
+		t.Errorf("signed %q, want %q", signed, want)
+	}
+}
@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/gotest"
+	"github.com/mitchellh/gox/pkg/progress"
+	"github.com/mitchellh/gox/pkg/report"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultTestOutput is the output template used by "gox test" when the
+// "--output" flag isn't given, so that test binaries don't overwrite the
+// binaries of a regular build.
+const defaultTestOutput = "{{.Dir}}_{{.OS}}_{{.Arch}}.test"
+
+var testCompileOnly bool
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "cross-compiles and runs test binaries in parallel",
+	Long:  testHelpText,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Set before reading the configuration file, whose output wins
+		// over it.
+		if !cmd.Flags().Changed("output") {
+			cfg.Output = defaultTestOutput
+		}
+		if err := rootCmd.PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+
+		clearReleaseSettings(cfg)
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Everything after "--" is passed to the test binaries.
+		var testArgs []string
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, testArgs = args[:dash], args[dash:]
+		}
+
+		if code := testMain(args, testArgs, cfg); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+// clearReleaseSettings drops the universal binaries and the steps a
+// configuration file may enable: test binaries aren't released.
+func clearReleaseSettings(cfg *config.Config) {
+	cfg.Universal = false
+	cfg.Archive = ""
+	cfg.Packages = nil
+	cfg.OCI = ""
+	cfg.Checksums = ""
+	cfg.Sign = ""
+	cfg.Manifests = nil
+}
+
+// testRun is the outcome of running the test binary of one package for
+// one platform.
+type testRun struct {
+	buildResult
+
+	// Via describes how the binary was run, see gotest.Exec.
+	Via string
+
+	// CompileOnly is the reason the binary wasn't run, if it wasn't.
+	CompileOnly string
+
+	Result *gotest.Result
+}
+
+func (r *testRun) Failed() bool {
+	return r.Err != nil || (r.Result != nil && r.Result.Err != nil)
+}
+
+func testMain(args []string, testArgs []string, cfg *config.Config) int {
+	setParallel(cfg)
+
+	if _, err := exec.LookPath(cfg.GoCmd); err != nil {
+		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n", cfg.GoCmd)
+		return 1
+	}
+
+	packages := args
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+
+	// Get the packages that have tests in the given paths
+	testDirs, err := pkg.GoTestDirs(packages, cfg.GoCmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
+		return 1
+	}
+	if len(testDirs) == 0 {
+		fmt.Println("No packages with test files to build.")
+		return 0
+	}
+
+	platforms := buildPlatforms(cfg)
+	if len(platforms) == 0 {
+		return 1
+	}
+
+	if err := checkModMode(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	jobs := buildJobs(cfg, platforms, testDirs)
+	if testCompileOnly {
+		return build(cfg, jobs, pkg.GoCrossCompileTest)
+	}
+
+	builds, err := runBuilds(cfg, jobs, pkg.GoCrossCompileTest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	// Test binaries are run from their package directory, like go test.
+	dirs, err := pkg.GoPackageDirs(testDirs, cfg.GoCmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
+		return 1
+	}
+
+	runs := runTests(cfg, builds, dirs, testArgs)
+
+	r := report.New()
+	addTests(r, runs)
+	if err := writeReports(cfg, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %s\n", err)
+		return 1
+	}
+
+	return reportTests(runs)
+}
+
+// runTests runs the test binaries of the successful builds, at most
+// cfg.Parallel at a time, through the emulator for their platform.
+func runTests(cfg *config.Config, builds []buildResult, dirs map[string]string, testArgs []string) []testRun {
+	if !cfg.Quiet {
+		fmt.Println()
+	}
+
+	runs := make([]testRun, len(builds))
+	execs := make([]*gotest.Exec, len(builds))
+	binaries := make([]string, len(builds))
+	var pending []int
+	var jobs []progress.Job
+	for i, build := range builds {
+		run := &runs[i]
+		run.buildResult = build
+		if build.Err != nil {
+			continue
+		}
+
+		e, reason := gotest.Lookup(build.Platform)
+		if e == nil {
+			run.CompileOnly = reason
+			continue
+		}
+		run.Via = e.Via
+
+		execs[i] = e
+		binaries[i] = build.Output
+		pending = append(pending, i)
+		jobs = append(jobs, progress.Job{Platform: build.Platform.String(), Name: "testing " + build.Path})
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan int, cfg.Parallel)
+	ui := newReporter(cfg, jobs)
+	for job, i := range pending {
+		wg.Add(1)
+		go func(job int, run *testRun, e *gotest.Exec, binary string) {
+			defer wg.Done()
+			semaphore <- 1
+			ui.Start(job)
+			if cfg.Trace {
+				fmt.Fprintf(ui, "cd %s\n", pkg.ShellQuote(dirs[run.Path]))
+			}
+			if cfg.Trace || cfg.Verbose {
+				fmt.Fprintln(ui, strings.Join(e.Command(binary, testArgs...), " "))
+			}
+
+			run.Result = gotest.Run(e, binary, dirs[run.Path], testArgs...)
+			if cfg.Verbose {
+				io.WriteString(ui, run.Result.Output)
+			}
+			ui.Finish(job, run.Result.Err)
+			<-semaphore
+		}(job, &runs[i], execs[i], binaries[i])
+	}
+	wg.Wait()
+	ui.Close()
+
+	return runs
+}
+
+// reportTests prints the output of the failed test binaries followed by a
+// summary per platform, returning the exit code.
+func reportTests(runs []testRun) int {
+	for _, run := range runs {
+		switch {
+		case run.Err != nil:
+			fmt.Fprintf(os.Stderr, "\n--- FAIL: %s %s (build failed)\n%s\n",
+				run.Platform.String(), run.Path, run.Err)
+		case run.Failed():
+			fmt.Fprintf(os.Stderr, "\n--- FAIL: %s %s\n%s",
+				run.Platform.String(), run.Path, run.Result.Output)
+		}
+	}
+
+	var order []string
+	summaries := make(map[string]*testSummary)
+	for i := range runs {
+		run := &runs[i]
+		platform := run.Platform.String()
+		summary, ok := summaries[platform]
+		if !ok {
+			summary = &testSummary{}
+			summaries[platform] = summary
+			order = append(order, platform)
+		}
+		summary.add(run)
+	}
+
+	sort.Strings(order)
+
+	failed := false
+	fmt.Printf("\nTest summary:\n")
+	for _, platform := range order {
+		summary := summaries[platform]
+		failed = failed || summary.failed
+		fmt.Printf("--> %15s: %s\n", platform, summary.String())
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+// testSummary aggregates the test runs of all packages for a platform.
+type testSummary struct {
+	failed      bool
+	packages    int
+	pass        int
+	fail        int
+	skip        int
+	via         []string
+	compileOnly string
+}
+
+func (s *testSummary) add(run *testRun) {
+	s.packages++
+	if run.Failed() {
+		s.failed = true
+	}
+	if run.CompileOnly != "" {
+		s.compileOnly = run.CompileOnly
+	}
+	if run.Result != nil {
+		s.pass += run.Result.Count(gotest.StatusPass)
+		s.fail += run.Result.Count(gotest.StatusFail)
+		s.skip += run.Result.Count(gotest.StatusSkip)
+	}
+	if run.Via != "" {
+		for _, via := range s.via {
+			if via == run.Via {
+				return
+			}
+		}
+		s.via = append(s.via, run.Via)
+	}
+}
+
+func (s *testSummary) String() string {
+	status := "ok  "
+	if s.failed {
+		status = "FAIL"
+	}
+
+	// Builds may still fail for compile-only platforms.
+	if s.compileOnly != "" && len(s.via) == 0 {
+		return fmt.Sprintf("%s compile-only (%s)", status, s.compileOnly)
+	}
+
+	return fmt.Sprintf("%s %d packages, %d passed, %d failed, %d skipped (%s)",
+		status, s.packages, s.pass, s.fail, s.skip, strings.Join(s.via, ", "))
+}
+
+const testHelpText = `Usage: gox test [options] [packages] [-- test flags]
+
+  Compiles the test binary of every package with test files, for every
+  selected platform, in parallel, and then runs them.
+
+  The options are the same as for gox itself. The default output path
+  template is "{{.Dir}}_{{.OS}}_{{.Arch}}.test", unless the configuration
+  file sets one. In addition to the usual variables, "{{.Package}}" holds
+  the full import path of the package so that packages sharing a directory
+  name can be told apart. The universal binaries, archives, packages,
+  image, checksums and signatures a configuration file asks for are left
+  out, test binaries aren't released.
+
+Running tests:
+
+  Test binaries for the host platform are run directly. Binaries for
+  other linux architectures are run with qemu user-mode emulation, either
+  through a qemu-[arch] binary on the PATH or through a qemu handler
+  registered with binfmt_misc. Other platforms are compile-only: their
+  binaries are built but not run.
+
+  Each binary is run from its package directory with -test.v and any
+  flags given after "--". The output of failing packages is printed,
+  followed by a pass/fail summary per platform.
+
+  With "-c" the binaries are only compiled, like "go test -c".
+
+  The "--junit" and "--tap" reports contain, for every platform, the
+  build of each package followed by each of its tests.
+
+`
+
+func init() {
+	testCmd.Flags().SortFlags = false
+	testCmd.Flags().BoolVarP(&testCompileOnly, "compile", "c", false, "compile the test binaries but do not run them")
+	addBuildFlags(testCmd.Flags())
+	testCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+
+	rootCmd.AddCommand(testCmd)
+}
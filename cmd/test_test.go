@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTestConfig(t *testing.T) {
+	saved := *cfg
+	defer func() { *cfg = saved }()
+
+	cases := []struct {
+		name   string
+		file   string
+		output string
+	}{
+		{"default", "tags: netgo\n", defaultTestOutput},
+		{"file", "output: \"bin/{{.Dir}}.test\"\n", "bin/{{.Dir}}.test"},
+	}
+
+	for _, tc := range cases {
+		t.Chdir(t.TempDir())
+		file := tc.file + "universal: true\narchive: {format: zip}\nchecksums: {}\noci: {path: image.tar}\n"
+		if err := ioutil.WriteFile(config.DefaultFile, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		*cfg = saved
+		if err := testCmd.PersistentPreRunE(testCmd, nil); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if cfg.Output != tc.output {
+			t.Errorf("%s: output %q, want %q", tc.name, cfg.Output, tc.output)
+		}
+
+		// Test binaries are neither merged nor released.
+		if cfg.Universal || cfg.Archive != "" || cfg.Checksums != "" || cfg.OCI != "" {
+			t.Errorf("%s: release settings kept: universal %v, archive %q, checksums %q, oci %q",
+				tc.name, cfg.Universal, cfg.Archive, cfg.Checksums, cfg.OCI)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/universal"
+	"github.com/mitchellh/gox/pkg/verify"
+	"time"
+)
+
+// universalPlatform is the platform of universal macOS binaries.
+var universalPlatform = config.Platform{OS: "darwin", Arch: "universal"}
+
+// universalArches are the architectures merged into universal binaries.
+var universalArches = []string{"amd64", "arm64"}
+
+// universalModes are the build modes of which the darwin binaries can be
+// merged: executables and C shared libraries, which are Mach-O files
+// unlike the archives of c-archive builds.
+var universalModes = map[string]bool{
+	"":         true,
+	"default":  true,
+	"exe":      true,
+	"pie":      true,
+	"c-shared": true,
+}
+
+// isUniversalArch reports whether the binaries of platform are merged into
+// universal binaries.
+func isUniversalArch(platform config.Platform) bool {
+	if platform.OS != "darwin" {
+		return false
+	}
+	for _, arch := range universalArches {
+		if platform.Arch == arch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkUniversal checks that the darwin builds among platforms can be
+// merged into universal binaries: both architectures must be built, in
+// the same mode, and produce Mach-O files. There is nothing to merge when
+// neither is built, as in the CI entries of the other platforms.
+func checkUniversal(cfg *config.Config, platforms []config.Platform) error {
+	var modes []string
+	for _, platform := range platforms {
+		if !isUniversalArch(platform) {
+			continue
+		}
+		jobCfg, _, err := jobConfig(cfg, platform)
+		if err != nil {
+			return fmt.Errorf("%s: %s", platform.String(), err)
+		}
+		mode := jobCfg.BuildMode
+		if !universalModes[mode] {
+			return fmt.Errorf("--universal merges executables and C shared libraries, not the darwin builds of -buildmode=%s", mode)
+		}
+		if mode == "" || mode == "default" {
+			mode = "exe"
+		}
+		modes = append(modes, mode)
+	}
+
+	switch {
+	case len(modes) == 0:
+		return nil
+	case len(modes) != len(universalArches):
+		return fmt.Errorf("--universal needs both darwin/amd64 and darwin/arm64 builds")
+	case modes[0] != modes[1]:
+		return fmt.Errorf("--universal needs the darwin builds in the same build mode, not %s and %s", modes[0], modes[1])
+	}
+
+	return nil
+}
+
+// addUniversal merges the darwin binaries of every package into a
+// universal binary, added to results as the result of a darwin/universal
+// build. Packages of which a darwin build failed are left out.
+func addUniversal(cfg *config.Config, results []buildResult) ([]buildResult, error) {
+	var paths []string
+	binaries := make(map[string][]string)
+	failed := make(map[string]bool)
+	for _, result := range results {
+		if !isUniversalArch(result.Platform) {
+			continue
+		}
+		if result.Err != nil {
+			failed[result.Path] = true
+		}
+		if _, ok := binaries[result.Path]; !ok {
+			paths = append(paths, result.Path)
+		}
+		binaries[result.Path] = append(binaries[result.Path], result.Output)
+	}
+
+	for _, path := range paths {
+		if failed[path] {
+			continue
+		}
+
+		jobCfg, _, err := jobConfig(cfg, universalPlatform)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", universalPlatform.String(), err)
+		}
+		result := buildResult{
+			buildJob: buildJob{Platform: universalPlatform, Path: path},
+			Config:   jobCfg,
+		}
+
+		start := time.Now()
+		result.Output, result.Err = pkg.OutputPath(jobCfg, universalPlatform, path)
+		if result.Err == nil {
+			result.Err = universal.Merge(result.Output, binaries[path])
+		}
+		if result.Err == nil {
+			result.Binary, result.Err = verify.File(result.Output, universalPlatform.OS, universalPlatform.Arch)
+		}
+		result.Elapsed = time.Since(start)
+
+		if !cfg.Quiet {
+			fmt.Printf("--> %15s: %s\n", universalPlatform.String(), path)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
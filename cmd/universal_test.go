@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"strings"
+	"testing"
+)
+
+var testUniversalPlatforms = []config.Platform{
+	{OS: "darwin", Arch: "amd64"},
+	{OS: "darwin", Arch: "arm64"},
+	{OS: "linux", Arch: "amd64"},
+}
+
+func TestBuildJobsUniversalShards(t *testing.T) {
+	paths := []string{"a", "b", "c"}
+
+	for count := 1; count <= 4; count++ {
+		seen := make(map[buildJob]int)
+		for index := 1; index <= count; index++ {
+			cfg := &config.Config{Universal: true, Shard: config.Shard{Index: index, Count: count}}
+			jobs := buildJobs(cfg, testUniversalPlatforms, paths)
+
+			darwin := make(map[string]int)
+			for _, job := range jobs {
+				seen[job]++
+				if isUniversalArch(job.Platform) {
+					darwin[job.Path]++
+				}
+			}
+			for path, n := range darwin {
+				if n != len(universalArches) {
+					t.Errorf("shard %d/%d: %d darwin jobs of %s, want both", index, count, n, path)
+				}
+			}
+		}
+
+		// Every job is still built once.
+		if len(seen) != len(testUniversalPlatforms)*len(paths) {
+			t.Errorf("%d shards: %d jobs built, want %d", count, len(seen), len(testUniversalPlatforms)*len(paths))
+		}
+		for job, n := range seen {
+			if n != 1 {
+				t.Errorf("%d shards: %s of %s built %d times", count, job.Platform.String(), job.Path, n)
+			}
+		}
+	}
+}
+
+func TestCheckUniversal(t *testing.T) {
+	cases := []struct {
+		name      string
+		platforms []config.Platform
+		mode      string
+		armMode   string
+		err       string
+	}{
+		{"both", testUniversalPlatforms, "", "", ""},
+		{"neither", testUniversalPlatforms[2:], "", "", ""},
+		{"one", testUniversalPlatforms[1:], "", "", "needs both"},
+		{"c-shared", testUniversalPlatforms, "c-shared", "", ""},
+		{"pie", testUniversalPlatforms, "pie", "", ""},
+		{"c-archive", testUniversalPlatforms, "c-archive", "", "not the darwin builds of -buildmode=c-archive"},
+		{"override", testUniversalPlatforms, "", "c-shared", "same build mode, not exe and c-shared"},
+	}
+
+	for _, tc := range cases {
+		// Empty overrides are ignored.
+		t.Setenv("GOX_DARWIN_ARM64_BUILDMODE", tc.armMode)
+
+		cfg := &config.Config{Universal: true, BuildMode: tc.mode}
+		err := checkUniversal(cfg, tc.platforms)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
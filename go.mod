@@ -3,7 +3,11 @@ module github.com/mitchellh/gox
 go 1.0
 
 require (
+	github.com/ProtonMail/go-crypto v1.1.6
 	github.com/hashicorp/go-version v1.6.0
+	github.com/klauspost/compress v1.15.15
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.24.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,225 @@
+// Package archive writes the archives gox packages binaries in. Archives
+// are reproducible: entries are sorted, have fixed times and owners and
+// only the executable bit of their mode is kept.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The supported formats, also used as the extension of the archives.
+const (
+	TarGz  = "tar.gz"
+	TarZst = "tar.zst"
+	Zip    = "zip"
+)
+
+// Formats are the supported formats.
+var Formats = []string{TarGz, TarZst, Zip}
+
+// DefaultFormat returns the format used for goos when none is given: zip
+// for windows, where it is the native format, and tar.gz elsewhere.
+func DefaultFormat(goos string) string {
+	if goos == "windows" {
+		return Zip
+	}
+
+	return TarGz
+}
+
+// ValidFormat reports whether format is supported.
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Entry is a file to add to an archive.
+type Entry struct {
+	// Name is the slash-separated path of the file in the archive.
+	Name string
+
+	// Path is the file to read.
+	Path string
+}
+
+// Write writes an archive in the given format to path with the entries,
+// in name order, each with the time mtime. The parent directories of the
+// entries are added too.
+func Write(path, format string, entries []Entry, mtime time.Time) error {
+	if !ValidFormat(format) {
+		return fmt.Errorf("unknown archive format %q, should be one of %s",
+			format, strings.Join(Formats, ", "))
+	}
+
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		info, err := os.Stat(e.Path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s isn't a regular file", e.Path)
+		}
+		files = append(files, file{Entry: e, exec: info.Mode()&0111 != 0, size: info.Size()})
+	}
+	files = withDirs(files)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	for i := 1; i < len(files); i++ {
+		if files[i].Name == files[i-1].Name {
+			return fmt.Errorf("%s is added to the archive twice", files[i].Name)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	mtime = mtime.UTC().Truncate(time.Second)
+	switch format {
+	case Zip:
+		err = writeZip(f, files, mtime)
+	case TarZst:
+		var zw *zstd.Encoder
+		zw, err = zstd.NewWriter(f, zstd.WithEncoderConcurrency(1))
+		if err == nil {
+			err = closeAfter(zw, writeTar(zw, files, mtime))
+		}
+	default:
+		zw := gzip.NewWriter(f)
+		err = closeAfter(zw, writeTar(zw, files, mtime))
+	}
+
+	err = closeAfter(f, err)
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// file is an entry along with what is kept of its metadata. Entries
+// without Path are directories.
+type file struct {
+	Entry
+	exec bool
+	size int64
+}
+
+func (f *file) mode() int64 {
+	if f.Path == "" || f.exec {
+		return 0755
+	}
+
+	return 0644
+}
+
+// withDirs adds the missing parent directories of the files.
+func withDirs(files []file) []file {
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[f.Name] = true
+	}
+
+	result := files
+	for _, f := range files {
+		for dir := path.Dir(f.Name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if seen[dir+"/"] {
+				break
+			}
+			seen[dir+"/"] = true
+			result = append(result, file{Entry: Entry{Name: dir + "/"}})
+		}
+	}
+
+	return result
+}
+
+func writeTar(w io.Writer, files []file, mtime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.Name,
+			Mode:    f.mode(),
+			ModTime: mtime,
+		}
+		if f.Path == "" {
+			hdr.Typeflag = tar.TypeDir
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = f.size
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if f.Path != "" {
+			if err := copyFile(tw, f.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, files []file, mtime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		hdr := &zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: mtime,
+		}
+		hdr.SetMode(os.FileMode(f.mode()))
+		if f.Path == "" {
+			hdr.Method = zip.Store
+			hdr.SetMode(os.ModeDir | 0755)
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if f.Path != "" {
+			if err := copyFile(fw, f.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// closeAfter closes c, returning err if it is set or the error of Close.
+func closeAfter(c io.Closer, err error) error {
+	if cerr := c.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
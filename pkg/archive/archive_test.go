@@ -0,0 +1,195 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testEntries writes the files of an archive to a temporary directory.
+func testEntries(t *testing.T) []Entry {
+	dir := t.TempDir()
+	files := []struct {
+		name, data string
+		mode       os.FileMode
+	}{
+		{"app", "\x7fELF binary", 0750},
+		{"README.md", "# app\n", 0600},
+		{"LICENSE", "MIT\n", 0664},
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, []byte(f.data), f.mode); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, Entry{Name: "app_1.0/" + f.name, Path: path})
+	}
+	entries = append(entries, Entry{Name: "app_1.0/docs/README.md", Path: entries[1].Path})
+
+	return entries
+}
+
+func TestWriteReproducible(t *testing.T) {
+	for _, format := range Formats {
+		entries := testEntries(t)
+		first := filepath.Join(t.TempDir(), "first."+format)
+		if err := Write(first, format, entries, testTime); err != nil {
+			t.Fatal(err)
+		}
+
+		// The order of the entries and the times and owner permissions of
+		// the files don't change the archive.
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		for _, e := range entries {
+			if err := os.Chtimes(e.Path, time.Now(), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chmod(entries[0].Path, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Nor do the zone and the fraction of a second of the time.
+		mtime := testTime.In(time.FixedZone("CEST", 2*3600)).Add(time.Millisecond)
+		second := filepath.Join(t.TempDir(), "second."+format)
+		if err := Write(second, format, entries, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := ioutil.ReadFile(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: the archives differ", format)
+		}
+	}
+}
+
+// testHeader is what is checked of an entry.
+type testHeader struct {
+	name  string
+	mode  os.FileMode
+	dir   bool
+	mtime time.Time
+	owner string
+}
+
+// testHeaders are the headers of the archive of testEntries: sorted, with
+// their parent directories, the time of the archive, no owner and only the
+// executable bit of the mode kept.
+var testHeaders = []testHeader{
+	{"app_1.0/", 0755, true, testTime, "0:0::"},
+	{"app_1.0/LICENSE", 0644, false, testTime, "0:0::"},
+	{"app_1.0/README.md", 0644, false, testTime, "0:0::"},
+	{"app_1.0/app", 0755, false, testTime, "0:0::"},
+	{"app_1.0/docs/", 0755, true, testTime, "0:0::"},
+	{"app_1.0/docs/README.md", 0644, false, testTime, "0:0::"},
+}
+
+func TestWriteHeaders(t *testing.T) {
+	for _, format := range Formats {
+		path := filepath.Join(t.TempDir(), "app."+format)
+		if err := Write(path, format, testEntries(t), testTime); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []testHeader
+		if format == Zip {
+			got = zipHeaders(t, path)
+		} else {
+			got = tarHeaders(t, path, format)
+		}
+		if !reflect.DeepEqual(got, testHeaders) {
+			t.Errorf("%s: headers\n%v\nwant\n%v", format, got, testHeaders)
+		}
+	}
+}
+
+func tarHeaders(t *testing.T, path, format string) []testHeader {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r io.Reader
+	if format == TarZst {
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var headers []testHeader
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, testHeader{
+			name:  hdr.Name,
+			mode:  os.FileMode(hdr.Mode),
+			dir:   hdr.Typeflag == tar.TypeDir,
+			mtime: hdr.ModTime.UTC(),
+			owner: fmt.Sprintf("%d:%d:%s:%s", hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname),
+		})
+	}
+
+	return headers
+}
+
+func zipHeaders(t *testing.T, path string) []testHeader {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var headers []testHeader
+	for _, f := range zr.File {
+		headers = append(headers, testHeader{
+			name: f.Name,
+			mode: f.Mode().Perm(),
+			dir:  f.Mode().IsDir(),
+			// Zip times are in local time, without a zone.
+			mtime: time.Date(f.Modified.Year(), f.Modified.Month(), f.Modified.Day(),
+				f.Modified.Hour(), f.Modified.Minute(), f.Modified.Second(), 0, time.UTC),
+			// Zip entries have no owner.
+			owner: "0:0::",
+		})
+	}
+
+	return headers
+}
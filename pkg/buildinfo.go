@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"go/format"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuildInfoFile is the name of the file generated in the package being
+// built when cfg.BuildInfo is set, and BuildInfoTag the build tag set
+// along with it so that the package can provide a fallback for builds
+// without gox.
+const (
+	BuildInfoFile = "gox_buildinfo.go"
+	BuildInfoTag  = "gox_buildinfo"
+)
+
+// goPackage returns the name and directory of the package at packagePath,
+// or the one in chdir if it is empty.
+func goPackage(cfg *config.Config, chdir, packagePath string) (string, string, error) {
+	args := []string{"list", "-f", "{{.Name}}|{{.Dir}}"}
+	if packagePath != "" {
+		args = append(args, packagePath)
+	}
+	output, err := execGo(cfg.GoCmd, nil, chdir, args...)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(strings.TrimSpace(output), "|", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("bad line reading package %s: %s", packagePath, output)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// buildInfoOverlay returns the -overlay file adding the build information
+// source to the package name in dir, along with the files to write for it,
+// keyed by path. Nothing is written to the package directory.
+func buildInfoOverlay(cfg *config.Config, platform config.Platform, name, dir string) (string, map[string]string, error) {
+	source, err := buildInfoSource(cfg, platform, name, dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Every job gets its own directory, the source differs per platform.
+	h := fnv.New32a()
+	h.Write([]byte(dir))
+	workDir := cfg.WorkDir
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "gox-work")
+	}
+	jobDir := filepath.Join(workDir, fmt.Sprintf("buildinfo_%s_%s_%08x", platform.OS, platform.Arch, h.Sum32()))
+
+	sourcePath := filepath.Join(jobDir, BuildInfoFile)
+	overlay, err := json.MarshalIndent(map[string]map[string]string{
+		"Replace": {filepath.Join(dir, BuildInfoFile): sourcePath},
+	}, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+
+	overlayPath := filepath.Join(jobDir, "overlay.json")
+	return overlayPath, map[string]string{
+		sourcePath:  string(source),
+		overlayPath: string(overlay) + "\n",
+	}, nil
+}
+
+// buildInfoSource generates the source of the build information for a
+// package. The struct has the fields and methods of version.AppVersionInfo,
+// in the same order and with the same types, so that code using one can
+// use the other: BuiltAt is the build time as --stamp sets BUILT, in RFC
+// 3339 format. The Commit, Dirty and Tags fields come after them.
+func buildInfoSource(cfg *config.Config, platform config.Platform, packageName, dir string) ([]byte, error) {
+	data := templateData(cfg, platform, dir)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gox. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", packageName)
+	fmt.Fprintf(&buf, "import (\n\t\"fmt\"\n\t\"runtime\"\n)\n\n")
+	fmt.Fprintf(&buf, "// GoxBuildInfo is the build metadata generated by gox, shaped like\n")
+	fmt.Fprintf(&buf, "// version.AppVersionInfo.\n")
+	fmt.Fprintf(&buf, "type GoxBuildInfo struct {\n")
+	fmt.Fprintf(&buf, "\tName string `json:\"name\"`\n")
+	fmt.Fprintf(&buf, "\tVersion string `json:\"version\"`\n")
+	fmt.Fprintf(&buf, "\tRevision string `json:\"revision\"`\n")
+	fmt.Fprintf(&buf, "\tBranch string `json:\"branch\"`\n")
+	fmt.Fprintf(&buf, "\tGOVersion string `json:\"go_version\"`\n")
+	fmt.Fprintf(&buf, "\tBuiltAt string `json:\"built_at\"`\n")
+	fmt.Fprintf(&buf, "\tOS string `json:\"os\"`\n")
+	fmt.Fprintf(&buf, "\tArchitecture string `json:\"architecture\"`\n")
+	fmt.Fprintf(&buf, "\tCommit string `json:\"commit\"`\n")
+	fmt.Fprintf(&buf, "\tDirty bool `json:\"dirty\"`\n")
+	fmt.Fprintf(&buf, "\tTags []string `json:\"tags\"`\n")
+	fmt.Fprintf(&buf, "}\n\n")
+	fmt.Fprintf(&buf, "// BuildInfo describes this build.\n")
+	fmt.Fprintf(&buf, "var BuildInfo = GoxBuildInfo{\n")
+	fmt.Fprintf(&buf, "\tName: %q,\n", data.Dir)
+	fmt.Fprintf(&buf, "\tVersion: %q,\n", data.Version())
+	fmt.Fprintf(&buf, "\tRevision: %q,\n", data.Revision())
+	fmt.Fprintf(&buf, "\tBranch: %q,\n", data.Branch())
+	fmt.Fprintf(&buf, "\tGOVersion: runtime.Version(),\n")
+	fmt.Fprintf(&buf, "\tBuiltAt: %q,\n", data.Built())
+	fmt.Fprintf(&buf, "\tOS: %q,\n", platform.OS)
+	fmt.Fprintf(&buf, "\tArchitecture: %q,\n", platform.Arch)
+	fmt.Fprintf(&buf, "\tCommit: %q,\n", data.Commit())
+	fmt.Fprintf(&buf, "\tDirty: %t,\n", data.Dirty())
+	fmt.Fprintf(&buf, "\tTags: %#v,\n", splitTags(cfg.Tags))
+	fmt.Fprintf(&buf, "}\n")
+	buf.WriteString(buildInfoMethods)
+
+	return format.Source(buf.Bytes())
+}
+
+// buildInfoMethods are the methods of version.AppVersionInfo, for the
+// generated GoxBuildInfo.
+const buildInfoMethods = `
+func (v *GoxBuildInfo) Line() string {
+	return fmt.Sprintf("%s %s (%s)", v.Name, v.Version, v.Revision)
+}
+
+func (v *GoxBuildInfo) ShortLine() string {
+	return fmt.Sprintf("%s (%s)", v.Version, v.Revision)
+}
+
+func (v *GoxBuildInfo) UserAgent() string {
+	return fmt.Sprintf("%s %s (%s; %s; %s/%s)", v.Name, v.Version, v.Branch, v.GOVersion, v.OS, v.Architecture)
+}
+
+func (v *GoxBuildInfo) Extended() string {
+	version := fmt.Sprintf("Version:      %s\n", v.Version)
+	version += fmt.Sprintf("Git revision: %s\n", v.Revision)
+	version += fmt.Sprintf("Git branch:   %s\n", v.Branch)
+	version += fmt.Sprintf("GO version:   %s\n", v.GOVersion)
+	version += fmt.Sprintf("Built:        %s\n", v.BuiltAt)
+	version += fmt.Sprintf("OS/Arch:      %s/%s\n", v.OS, v.Architecture)
+	return version
+}
+`
+
+// splitTags returns the build tags in a -tags value, which may be comma
+// or, the old way, space separated.
+func splitTags(tags string) []string {
+	result := []string{}
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' }) {
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+// addTag adds tag to a -tags value, keeping its separator.
+func addTag(tags, tag string) string {
+	if tags == "" {
+		return tag
+	}
+	if strings.Contains(tags, " ") && !strings.Contains(tags, ",") {
+		return tags + " " + tag
+	}
+
+	return tags + "," + tag
+}
@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"github.com/mitchellh/gox/pkg/version"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// buildInfoMain prints the generated BuildInfo, declaring its BuiltAt as a
+// string the way version.AppVersionInfo does.
+const buildInfoMain = `package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func main() {
+	var builtAt string = BuildInfo.BuiltAt
+	json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+		"info":      BuildInfo,
+		"built_at":  builtAt,
+		"line":      BuildInfo.Line(),
+		"useragent": BuildInfo.UserAgent(),
+		"extended":  BuildInfo.Extended(),
+	})
+}
+`
+
+// buildInfoFallback is the BuildInfo of builds without gox.
+const buildInfoFallback = `//go:build !gox_buildinfo
+
+package main
+
+import "fmt"
+
+var BuildInfo = struct {
+	Name, Version, Revision, Branch, GOVersion, BuiltAt, OS, Architecture string
+}{}
+
+func init() { fmt.Println("fallback") }
+`
+
+func TestBuildInfoOverlay(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.17\n",
+		"main.go":     buildInfoMain,
+		"fallback.go": buildInfoFallback,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := &stamp.Info{
+		Version:  "v1.2.0-3-g1a2b3c4d-dirty",
+		Commit:   "1a2b3c4d5e6f",
+		Revision: "1a2b3c4d",
+		Branch:   "main",
+		Dirty:    true,
+		Built:    "2024-05-01T12:00:00Z",
+	}
+	cfg := &config.Config{
+		GoCmd:     "go",
+		Output:    filepath.Join(dir, "out", "{{.Dir}}"),
+		Tags:      "netgo",
+		BuildInfo: true,
+		WorkDir:   filepath.Join(dir, "work"),
+		Git:       git,
+	}
+	platform := config.Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	cmd, err := GoBuildCommand(cfg, platform, "_"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.Run(); err != nil {
+		t.Fatalf("%s: %s", cmd.String(), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, BuildInfoFile)); !os.IsNotExist(err) {
+		t.Errorf("%s written to the package directory", BuildInfoFile)
+	}
+
+	output, err := exec.Command(cmd.Output).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Info      map[string]interface{} `json:"info"`
+		BuiltAt   string                 `json:"built_at"`
+		Line      string                 `json:"line"`
+		UserAgent string                 `json:"useragent"`
+		Extended  string                 `json:"extended"`
+	}
+	if err := json.Unmarshal(output, &got); err != nil {
+		t.Fatalf("reading %q: %s", output, err)
+	}
+
+	want := map[string]interface{}{
+		"name":         filepath.Base(dir),
+		"version":      git.Version,
+		"revision":     git.Revision,
+		"branch":       git.Branch,
+		"go_version":   runtime.Version(),
+		"built_at":     git.Built,
+		"os":           runtime.GOOS,
+		"architecture": runtime.GOARCH,
+		"commit":       git.Commit,
+		"dirty":        true,
+		"tags":         []interface{}{"netgo"},
+	}
+	if !reflect.DeepEqual(got.Info, want) {
+		t.Errorf("BuildInfo is\n%v\nwant\n%v", got.Info, want)
+	}
+	if got.BuiltAt != git.Built {
+		t.Errorf("BuiltAt is %q, want %q", got.BuiltAt, git.Built)
+	}
+
+	// The methods are those of version.AppVersionInfo.
+	info := version.AppVersionInfo{
+		Name:         filepath.Base(dir),
+		Version:      git.Version,
+		Revision:     git.Revision,
+		Branch:       git.Branch,
+		GOVersion:    runtime.Version(),
+		BuiltAt:      git.Built,
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+	}
+	if got.Line != info.Line() || got.UserAgent != info.UserAgent() || got.Extended != info.Extended() {
+		t.Errorf("the methods of BuildInfo return %q, %q and %q, want %q, %q and %q",
+			got.Line, got.UserAgent, got.Extended, info.Line(), info.UserAgent(), info.Extended())
+	}
+}
+
+func TestBuildInfoFields(t *testing.T) {
+	source, err := buildInfoSource(&config.Config{Git: stamp.Unknown()}, config.Platform{OS: "linux", Arch: "amd64"}, "main", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), BuildInfoFile, source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != "GoxBuildInfo" {
+			return true
+		}
+		for _, field := range spec.Type.(*ast.StructType).Fields.List {
+			fields = append(fields, fmt.Sprintf("%s %s %s", field.Names[0].Name, types.ExprString(field.Type), field.Tag.Value))
+		}
+		return false
+	})
+
+	// The fields of version.AppVersionInfo come first, in the same order,
+	// with the same types and tags.
+	typ := reflect.TypeOf(version.AppVersionInfo{})
+	if len(fields) < typ.NumField() {
+		t.Fatalf("GoxBuildInfo has the fields %q", fields)
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		want := fmt.Sprintf("%s %s `%s`", typ.Field(i).Name, typ.Field(i).Type, typ.Field(i).Tag)
+		if fields[i] != want {
+			t.Errorf("field %d of GoxBuildInfo is %q, want %q", i, fields[i], want)
+		}
+	}
+}
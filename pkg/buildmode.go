@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"path/filepath"
+	"strings"
+)
+
+// BuildModes are the build modes main packages can be built with, besides
+// the default, "exe".
+var BuildModes = []string{"exe", "pie", "c-shared", "c-archive", "plugin"}
+
+// DistPlatform is a platform as listed by "go tool dist list -json".
+type DistPlatform struct {
+	GOOS         string
+	GOARCH       string
+	CgoSupported bool
+	FirstClass   bool
+}
+
+// GoDistList returns the platforms the go command supports, keyed by
+// os/arch.
+func GoDistList(GoCmd string) (map[string]DistPlatform, error) {
+	output, err := execGo(GoCmd, nil, "", "tool", "dist", "list", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []DistPlatform
+	if err := json.Unmarshal([]byte(output), &platforms); err != nil {
+		return nil, fmt.Errorf("reading go tool dist list: %s", err)
+	}
+
+	result := make(map[string]DistPlatform, len(platforms))
+	for _, p := range platforms {
+		result[p.GOOS+"/"+p.GOARCH] = p
+	}
+	return result, nil
+}
+
+// CheckBuildMode checks that the build mode of cfg can be used for
+// platform, dist being the platforms of the go command. The modes producing
+// C libraries and plugins need cgo.
+func CheckBuildMode(cfg *config.Config, platform config.Platform, dist map[string]DistPlatform) error {
+	mode := cfg.BuildMode
+	if mode == "" || mode == "default" {
+		return nil
+	}
+
+	known := false
+	for _, m := range BuildModes {
+		known = known || m == mode
+	}
+	if !known {
+		return fmt.Errorf("unknown build mode %q, should be one of %s", mode, strings.Join(BuildModes, ", "))
+	}
+
+	p, ok := dist[platform.String()]
+	if !ok {
+		return fmt.Errorf("the go command doesn't support %s", platform.String())
+	}
+	if !buildModeSupported(mode, platform) {
+		return fmt.Errorf("-buildmode=%s is not supported on %s", mode, platform.String())
+	}
+	if Static(cfg, platform) {
+		switch {
+		case mode != "exe" && mode != "pie":
+			return fmt.Errorf("--static only builds executables, not -buildmode=%s", mode)
+		case mode == "pie" && !CgoEnabled(cfg, platform):
+			return fmt.Errorf("--static -buildmode=pie links a static-pie with the C linker, which requires cgo, enable it with --cgo")
+		}
+	}
+	if buildModeNeedsCgo(mode, platform) {
+		if !p.CgoSupported {
+			return fmt.Errorf("-buildmode=%s requires cgo, which %s doesn't support", mode, platform.String())
+		}
+		if !CgoEnabled(cfg, platform) {
+			return fmt.Errorf("-buildmode=%s requires cgo, enable it with --cgo", mode)
+		}
+	}
+
+	return nil
+}
+
+// buildModeSupported reports whether the go command can build for platform
+// with mode, like BuildModeSupported in its internal/platform package.
+func buildModeSupported(mode string, platform config.Platform) bool {
+	switch mode {
+	case "exe":
+		return true
+
+	case "c-archive":
+		switch platform.OS {
+		case "aix", "darwin", "ios", "windows":
+			return true
+		case "linux":
+			switch platform.Arch {
+			case "386", "amd64", "arm", "armbe", "arm64", "arm64be", "loong64", "ppc64", "ppc64le", "riscv64", "s390x":
+				return true
+			}
+		case "freebsd":
+			return platform.Arch == "amd64"
+		}
+		return false
+
+	case "c-shared":
+		switch platform.String() {
+		case "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/386", "linux/ppc64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+			"android/amd64", "android/arm", "android/arm64", "android/386",
+			"freebsd/amd64",
+			"darwin/amd64", "darwin/arm64",
+			"windows/amd64", "windows/386", "windows/arm64",
+			"wasip1/wasm":
+			return true
+		}
+		return false
+
+	case "pie":
+		switch platform.String() {
+		case "linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/loong64", "linux/ppc64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+			"android/amd64", "android/arm", "android/arm64", "android/386",
+			"freebsd/amd64",
+			"darwin/amd64", "darwin/arm64",
+			"ios/amd64", "ios/arm64",
+			"aix/ppc64",
+			"openbsd/arm64",
+			"windows/386", "windows/amd64", "windows/arm64":
+			return true
+		}
+		return false
+
+	case "plugin":
+		switch platform.String() {
+		case "linux/amd64", "linux/arm", "linux/arm64", "linux/386", "linux/loong64", "linux/riscv64", "linux/s390x", "linux/ppc64", "linux/ppc64le",
+			"android/amd64", "android/386",
+			"darwin/amd64", "darwin/arm64",
+			"freebsd/amd64":
+			return true
+		}
+		return false
+	}
+
+	return false
+}
+
+// buildModeNeedsCgo reports whether building for platform with mode links
+// with the C toolchain, which takes cgo. WebAssembly has no C toolchain.
+func buildModeNeedsCgo(mode string, platform config.Platform) bool {
+	switch mode {
+	case "c-shared", "c-archive", "plugin":
+		return platform.Arch != "wasm"
+	}
+
+	return false
+}
+
+// OutputExt returns the extension of the files written for os by builds
+// with mode, empty for the default.
+func OutputExt(mode, os string) string {
+	switch {
+	case os == "js" || os == "wasip1":
+		return ""
+	case mode == "c-archive":
+		return ".a"
+	case mode == "c-shared" && os == "windows":
+		return ".dll"
+	case mode == "c-shared" && (os == "darwin" || os == "ios"):
+		return ".dylib"
+	case mode == "c-shared" || mode == "plugin":
+		return ".so"
+	case os == "windows":
+		return ".exe"
+	}
+
+	return ""
+}
+
+// HeaderPath returns the path of the C header the go command writes next
+// to output, a library built with mode, or empty if it writes none.
+func HeaderPath(mode, output string) string {
+	if mode != "c-shared" && mode != "c-archive" {
+		return ""
+	}
+
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".h"
+}
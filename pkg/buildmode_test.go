@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestCheckBuildMode(t *testing.T) {
+	dist := map[string]DistPlatform{
+		"linux/arm64":   {GOOS: "linux", GOARCH: "arm64", CgoSupported: true, FirstClass: true},
+		"windows/amd64": {GOOS: "windows", GOARCH: "amd64", CgoSupported: true, FirstClass: true},
+		"js/wasm":       {GOOS: "js", GOARCH: "wasm"},
+	}
+
+	cases := []struct {
+		mode     string
+		platform string
+		cgo      bool
+		static   bool
+		err      string
+	}{
+		{"", "linux/arm64", false, true, ""},
+		{"exe", "linux/arm64", false, true, ""},
+		{"pie", "linux/arm64", false, false, ""},
+		{"pie", "linux/arm64", true, true, ""},
+		{"pie", "linux/arm64", false, true, "requires cgo, enable it with --cgo"},
+		{"c-shared", "linux/arm64", true, true, "--static only builds executables, not -buildmode=c-shared"},
+		{"c-shared", "windows/amd64", true, true, ""},
+		{"c-shared", "linux/arm64", false, false, "requires cgo, enable it with --cgo"},
+		{"c-archive", "js/wasm", false, false, "not supported on js/wasm"},
+		{"plugin", "windows/amd64", true, false, "not supported on windows/amd64"},
+		{"shared", "linux/arm64", true, false, "unknown build mode"},
+		{"pie", "linux/riscv64", false, false, "the go command doesn't support linux/riscv64"},
+	}
+
+	for _, tc := range cases {
+		parts := strings.SplitN(tc.platform, "/", 2)
+		platform := config.Platform{OS: parts[0], Arch: parts[1]}
+		cfg := &config.Config{BuildMode: tc.mode, Cgo: tc.cgo, CgoDisabled: !tc.cgo, Static: tc.static}
+
+		err := CheckBuildMode(cfg, platform, dist)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s on %s: %s", tc.mode, tc.platform, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s on %s: got error %v, want %q", tc.mode, tc.platform, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// cCompiler is a C toolchain: the C and C++ compilers and the archiver.
+type cCompiler struct {
+	CC, CXX, AR string
+}
+
+// gnu returns the GCC cross toolchain whose commands start with prefix, a
+// target triplet followed by a dash.
+func gnu(prefix string) cCompiler {
+	return cCompiler{prefix + "gcc", prefix + "g++", prefix + "ar"}
+}
+
+// crossCompilers are the C cross toolchains looked up on the PATH for cgo
+// builds, in order of preference: those of the Debian and Ubuntu
+// packages, musl-cross, mingw-w64, llvm-mingw and osxcross.
+var crossCompilers = map[string][]cCompiler{
+	"linux/386":      {gnu("i686-linux-gnu-"), gnu("i686-linux-musl-")},
+	"linux/amd64":    {gnu("x86_64-linux-gnu-"), gnu("x86_64-linux-musl-")},
+	"linux/arm":      {gnu("arm-linux-gnueabihf-"), gnu("arm-linux-gnueabi-"), gnu("arm-linux-musleabihf-")},
+	"linux/arm64":    {gnu("aarch64-linux-gnu-"), gnu("aarch64-linux-musl-")},
+	"linux/loong64":  {gnu("loongarch64-linux-gnu-")},
+	"linux/mips":     {gnu("mips-linux-gnu-")},
+	"linux/mipsle":   {gnu("mipsel-linux-gnu-")},
+	"linux/mips64":   {gnu("mips64-linux-gnuabi64-")},
+	"linux/mips64le": {gnu("mips64el-linux-gnuabi64-")},
+	"linux/ppc64":    {gnu("powerpc64-linux-gnu-")},
+	"linux/ppc64le":  {gnu("powerpc64le-linux-gnu-")},
+	"linux/riscv64":  {gnu("riscv64-linux-gnu-")},
+	"linux/s390x":    {gnu("s390x-linux-gnu-")},
+	"windows/386":    {gnu("i686-w64-mingw32-")},
+	"windows/amd64":  {gnu("x86_64-w64-mingw32-")},
+	"windows/arm64":  {{"aarch64-w64-mingw32-clang", "aarch64-w64-mingw32-clang++", "aarch64-w64-mingw32-ar"}},
+	"darwin/amd64":   {{"o64-clang", "o64-clang++", ""}},
+	"darwin/arm64":   {{"oa64-clang", "oa64-clang++", ""}},
+}
+
+// CgoToolchain returns the variables selecting the C toolchain of a cgo
+// build for platform, on top of cfg.Env. Unless CC is set in cfg.Env,
+// builds for other platforms than the host use the first cross compiler
+// found on the PATH, and every build uses zig when it is cfg.CgoToolchain.
+// A CC set in the environment of gox is only used for the platforms it
+// builds for, like a host-wide CC for the host. The flags of cfg.Sysroot
+// are added to those of the environment. It fails when there is no C
+// compiler for platform.
+func CgoToolchain(cfg *config.Config, platform config.Platform) ([]string, error) {
+	if cfg.CgoToolchain != "" && cfg.CgoToolchain != "zig" {
+		return nil, fmt.Errorf("unknown cgo toolchain %q, should be zig", cfg.CgoToolchain)
+	}
+
+	var env []string
+	_, ccSet := cfg.LookupEnv("CC")
+	if cfg.CgoToolchain == "zig" && !ccSet {
+		zig, err := zigToolchain(cfg, platform)
+		if err != nil {
+			return nil, err
+		}
+		env = zig
+	} else if cc, ok := cfg.LookupEnv("CC"); ok {
+		if err := lookCompiler(cc); err != nil {
+			return nil, err
+		}
+	} else if cc := cfg.Getenv("CC"); cc != "" && (hostCompiles(platform) || ccBuildsFor(cc, platform)) {
+		if err := lookCompiler(cc); err != nil {
+			return nil, err
+		}
+	} else if !hostCompiles(platform) {
+		// The CXX and AR of the environment go with its CC, so they are
+		// replaced along with it.
+		compiler, ok := findCrossCompiler(cfg, platform)
+		if !ok && !multilib(platform) {
+			return nil, noCompilerError(platform, cfg.Getenv("CC"))
+		}
+		if ok {
+			env = append(env, "CC="+compiler.CC)
+			if _, set := cfg.LookupEnv("CXX"); compiler.CXX != "" && !set {
+				if _, err := exec.LookPath(compiler.CXX); err == nil {
+					env = append(env, "CXX="+compiler.CXX)
+				}
+			}
+			if _, set := cfg.LookupEnv("AR"); compiler.AR != "" && !set {
+				if _, err := exec.LookPath(compiler.AR); err == nil {
+					env = append(env, "AR="+compiler.AR)
+				}
+			}
+		}
+	}
+
+	if root := cfg.Sysroot; root != "" {
+		flag := "--sysroot=" + root
+		for _, key := range []string{"CGO_CFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS"} {
+			env = append(env, key+"="+strings.TrimSpace(cfg.Getenv(key)+" "+flag))
+		}
+
+		// pkg-config finds the packages of the target system, with their
+		// paths prefixed by the sysroot.
+		env = append(env, "PKG_CONFIG_SYSROOT_DIR="+root)
+		if cfg.Getenv("PKG_CONFIG_LIBDIR") == "" {
+			dirs := []string{filepath.Join(root, "usr", "lib", "pkgconfig"), filepath.Join(root, "usr", "share", "pkgconfig")}
+			multiarch, _ := filepath.Glob(filepath.Join(root, "usr", "lib", "*", "pkgconfig"))
+			dirs = append(dirs, multiarch...)
+			env = append(env, "PKG_CONFIG_LIBDIR="+strings.Join(dirs, string(filepath.ListSeparator)))
+		}
+	}
+
+	return env, nil
+}
+
+// hostCompiles reports whether the C compiler of the host builds for
+// platform, which the go command picks with flags like -arch.
+func hostCompiles(platform config.Platform) bool {
+	return platform.OS == runtime.GOOS && (platform.Arch == runtime.GOARCH || platform.OS == "darwin")
+}
+
+// multilib reports whether the C compiler of the host may build for
+// platform with -m32, if the 32-bit libraries are installed. A cross
+// compiler is still preferred.
+func multilib(platform config.Platform) bool {
+	return platform.OS == runtime.GOOS && runtime.GOARCH == "amd64" && platform.Arch == "386"
+}
+
+// findCrossCompiler returns the first cross compiler for platform on the
+// PATH. The soft-float toolchain comes first for GOARM=5.
+func findCrossCompiler(cfg *config.Config, platform config.Platform) (cCompiler, bool) {
+	candidates := crossCompilers[platform.String()]
+	if platform.String() == "linux/arm" && strings.HasPrefix(cfg.Getenv("GOARM"), "5") {
+		candidates = []cCompiler{gnu("arm-linux-gnueabi-"), gnu("arm-linux-musleabi-")}
+	}
+
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c.CC); err == nil {
+			return c, true
+		}
+	}
+
+	return cCompiler{}, false
+}
+
+// ccBuildsFor reports whether the C compiler of a CC value builds for
+// platform, going by the target triplet it prints with -dumpmachine, like
+// "aarch64-linux-gnu". A compiler that doesn't print one isn't trusted.
+func ccBuildsFor(cc string, platform config.Platform) bool {
+	fields := strings.Fields(cc)
+	if len(fields) == 0 {
+		return false
+	}
+	output, err := exec.Command(fields[0], append(fields[1:], "-dumpmachine")...).Output()
+	if err != nil {
+		return false
+	}
+
+	return tripletMatches(strings.TrimSpace(string(output)), platform)
+}
+
+// tripletMatches reports whether the target triplet of a C compiler, like
+// "x86_64-w64-mingw32", is that of platform.
+func tripletMatches(triplet string, platform config.Platform) bool {
+	parts := strings.SplitN(triplet, "-", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	arch, system := parts[0], parts[1]
+
+	var archOK bool
+	switch platform.Arch {
+	case "386":
+		archOK = len(arch) == 4 && arch[0] == 'i' && strings.HasSuffix(arch, "86")
+	case "amd64":
+		archOK = arch == "x86_64" || arch == "amd64"
+	case "arm":
+		archOK = strings.HasPrefix(arch, "arm") && arch != "arm64" && !strings.HasSuffix(arch, "eb")
+	case "arm64":
+		archOK = arch == "aarch64" || arch == "arm64"
+	case "loong64":
+		archOK = arch == "loongarch64"
+	case "mips", "mips64":
+		archOK = arch == platform.Arch
+	case "mipsle", "mips64le":
+		archOK = arch == strings.TrimSuffix(platform.Arch, "le")+"el"
+	case "ppc64", "ppc64le":
+		archOK = arch == strings.Replace(platform.Arch, "ppc", "powerpc", 1)
+	default:
+		archOK = arch == platform.Arch
+	}
+	if !archOK {
+		return false
+	}
+
+	switch platform.OS {
+	case "windows":
+		return strings.Contains(system, "mingw") || strings.Contains(system, "windows")
+	case "darwin", "ios":
+		return strings.Contains(system, "apple") || strings.Contains(system, "darwin")
+	}
+
+	return strings.Contains(system, platform.OS)
+}
+
+// lookCompiler checks that the compiler of a CC value, which may be
+// followed by flags, is installed.
+func lookCompiler(cc string) error {
+	fields := strings.Fields(cc)
+	if len(fields) == 0 {
+		return fmt.Errorf("CC is blank")
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return fmt.Errorf("C compiler %q not found, check CC", fields[0])
+	}
+
+	return nil
+}
+
+// noCompilerError explains how to get a C compiler for platform, cc being
+// the CC of the environment, which builds for another platform, if any.
+func noCompilerError(platform config.Platform, cc string) error {
+	var names []string
+	for _, c := range crossCompilers[platform.String()] {
+		names = append(names, c.CC)
+	}
+
+	problem := "no C compiler for cgo"
+	if cc != "" {
+		problem = fmt.Sprintf("no C compiler for cgo, CC=%s doesn't build for %s", cc, platform.String())
+	}
+	override := fmt.Sprintf("GOX_%s_%s_CC", strings.ToUpper(platform.OS), strings.ToUpper(platform.Arch))
+	if len(names) == 0 {
+		return fmt.Errorf("%s, set one with %s or the cc platform setting", problem, override)
+	}
+	return fmt.Errorf("%s, install %s or set one with %s or the cc platform setting",
+		problem, strings.Join(names, " or "), override)
+}
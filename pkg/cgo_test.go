@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"github.com/mitchellh/gox/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestTripletMatches(t *testing.T) {
+	cases := []struct {
+		triplet  string
+		platform string
+		want     bool
+	}{
+		{"x86_64-linux-gnu", "linux/amd64", true},
+		{"x86_64-pc-linux-gnu", "linux/amd64", true},
+		{"x86_64-linux-gnu", "linux/arm64", false},
+		{"x86_64-linux-gnu", "linux/386", false},
+		{"x86_64-linux-gnu", "windows/amd64", false},
+		{"i686-linux-gnu", "linux/386", true},
+		{"i386-pc-linux-gnu", "linux/386", true},
+		{"aarch64-linux-gnu", "linux/arm64", true},
+		{"aarch64-unknown-linux-musl", "linux/arm64", true},
+		{"arm-linux-gnueabihf", "linux/arm", true},
+		{"armv7l-unknown-linux-gnueabihf", "linux/arm", true},
+		{"aarch64-linux-gnu", "linux/arm", false},
+		{"mips-linux-gnu", "linux/mips", true},
+		{"mipsel-linux-gnu", "linux/mipsle", true},
+		{"mipsel-linux-gnu", "linux/mips", false},
+		{"mips64el-linux-gnuabi64", "linux/mips64le", true},
+		{"powerpc64le-linux-gnu", "linux/ppc64le", true},
+		{"powerpc64le-linux-gnu", "linux/ppc64", false},
+		{"riscv64-linux-gnu", "linux/riscv64", true},
+		{"loongarch64-linux-gnu", "linux/loong64", true},
+		{"x86_64-w64-mingw32", "windows/amd64", true},
+		{"i686-w64-mingw32", "windows/386", true},
+		{"aarch64-w64-windows-gnu", "windows/arm64", true},
+		{"x86_64-apple-darwin23", "darwin/amd64", true},
+		{"arm64-apple-darwin23", "darwin/arm64", true},
+		{"x86_64-unknown-freebsd14.0", "freebsd/amd64", true},
+		{"x86_64", "linux/amd64", false},
+	}
+
+	for _, tc := range cases {
+		parts := strings.SplitN(tc.platform, "/", 2)
+		platform := config.Platform{OS: parts[0], Arch: parts[1]}
+		if got := tripletMatches(tc.triplet, platform); got != tc.want {
+			t.Errorf("tripletMatches(%q, %s) = %v, want %v", tc.triplet, tc.platform, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package checksum computes the checksums of artifacts and writes them in
+// the format of the coreutils tools, like sha256sum, so that they can be
+// checked with "sha256sum -c".
+package checksum
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// The supported algorithms. BLAKE2b is the 512 bits variant of b2sum.
+const (
+	SHA256  = "sha256"
+	SHA512  = "sha512"
+	BLAKE2b = "blake2b"
+)
+
+// Algorithms are the supported algorithms.
+var Algorithms = []string{SHA256, SHA512, BLAKE2b}
+
+// New returns a new hash for the algorithm.
+func New(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case BLAKE2b:
+		return blake2b.New512(nil)
+	}
+
+	return nil, fmt.Errorf("unknown checksum algorithm %q, should be one of %s",
+		algorithm, strings.Join(Algorithms, ", "))
+}
+
+// FileName returns the usual name of the combined checksum file for the
+// algorithm, like SHA256SUMS.
+func FileName(algorithm string) string {
+	if algorithm == BLAKE2b {
+		return "B2SUMS"
+	}
+
+	return strings.ToUpper(algorithm) + "SUMS"
+}
+
+// Extension returns the extension of the checksum file of a single
+// artifact, like ".sha256".
+func Extension(algorithm string) string {
+	if algorithm == BLAKE2b {
+		return ".b2"
+	}
+
+	return "." + algorithm
+}
+
+// Sum is the checksum of a file, along with the name it is listed with.
+type Sum struct {
+	Name string
+	Hex  string
+}
+
+// File returns the checksum of the file at path in hex.
+func File(algorithm, path string) (string, error) {
+	h, err := New(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Write writes the sums in the coreutils format, in the given order.
+func Write(w io.Writer, sums []Sum) error {
+	for _, s := range sums {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", s.Hex, s.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
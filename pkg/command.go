@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Command is a go command run by gox for a job, as it would be typed in a
+// shell.
+type Command struct {
+	// Dir is the directory the command is run in, empty for the current
+	// directory.
+	Dir string
+
+	// Env holds the variables set on top of the inherited environment,
+	// like GOOS and GOARCH, as "KEY=value" pairs.
+	Env []string
+
+	// Args is the command line, Args[0] being the go command.
+	Args []string
+
+	// Output is the absolute path of the file the command writes.
+	Output string
+
+	// Files are generated files the command reads, keyed by path, such as
+	// an -overlay. Run writes them first.
+	Files map[string]string
+
+	// TreeFiles are generated files the command reads from the source
+	// tree, keyed by path, such as .syso objects, which the go command
+	// doesn't take from an -overlay. Run refuses to write over existing
+	// files, and removes the ones it wrote after the command or when gox
+	// is interrupted.
+	TreeFiles map[string]string
+}
+
+// treeFiles are the paths of the tree files written by the commands
+// running, which are removed when gox is interrupted.
+var treeFiles = struct {
+	sync.Mutex
+	paths  map[string]bool
+	notify sync.Once
+}{paths: make(map[string]bool)}
+
+// Run writes the files of the command, runs it and returns what it printed
+// on stdout.
+func (c *Command) Run() (string, error) {
+	for path, data := range c.Files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	if len(c.TreeFiles) > 0 {
+		treeFiles.notify.Do(removeTreeFilesOnSignal)
+	}
+	var written []string
+	defer func() {
+		treeFiles.Lock()
+		defer treeFiles.Unlock()
+		for _, path := range written {
+			os.Remove(path)
+			delete(treeFiles.paths, path)
+		}
+	}()
+	for path, data := range c.TreeFiles {
+		treeFiles.Lock()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			treeFiles.paths[path] = true
+			written = append(written, path)
+		}
+		treeFiles.Unlock()
+		if os.IsExist(err) {
+			return "", fmt.Errorf("%s already exists, remove it if an interrupted gox left it behind", path)
+		} else if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return execGo(c.Args[0], append(os.Environ(), c.Env...), c.Dir, c.Args[1:]...)
+}
+
+// removeTreeFilesOnSignal removes the tree files of the commands running
+// when gox is interrupted or terminated, before dying of the signal.
+func removeTreeFilesOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+
+		// The lock is kept so that no more files are written.
+		treeFiles.Lock()
+		for path := range treeFiles.paths {
+			os.Remove(path)
+		}
+		signal.Stop(c)
+		if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(sig) != nil {
+			os.Exit(1)
+		}
+	}()
+}
+
+// String returns the command line preceded by its environment, quoted for
+// a POSIX shell.
+func (c *Command) String() string {
+	parts := make([]string, 0, len(c.Env)+1)
+	for _, kv := range c.Env {
+		if i := strings.Index(kv, "="); i >= 0 {
+			kv = kv[:i+1] + ShellQuote(kv[i+1:])
+		}
+		parts = append(parts, kv)
+	}
+	parts = append(parts, c.CommandLine())
+
+	return strings.Join(parts, " ")
+}
+
+// CommandLine returns the command line without its environment, quoted
+// for a POSIX shell.
+func (c *Command) CommandLine() string {
+	parts := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		parts = append(parts, ShellQuote(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Trace returns the command the way "go build -x" prints them: a "cd" to
+// its directory, if any, followed by the command line.
+func (c *Command) Trace() string {
+	if c.Dir == "" {
+		return c.String() + "\n"
+	}
+
+	return "cd " + ShellQuote(c.Dir) + "\n" + c.String() + "\n"
+}
+
+// ShellQuote quotes s for a POSIX shell, leaving it as is when it only
+// contains characters that have no special meaning.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-_./=:,+@%^", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
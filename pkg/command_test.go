@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandRunTreeFiles(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not found")
+	}
+
+	// An existing file is neither written over nor removed.
+	path := filepath.Join(t.TempDir(), "gox_resources_windows_amd64.syso")
+	if err := ioutil.WriteFile(path, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Command{
+		Args:      []string{cat, path},
+		TreeFiles: map[string]string{path: "resources"},
+	}
+	if _, err := c.Run(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("got error %v, want the file to exist already", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "stale" {
+		t.Errorf("the existing file was changed: %q, %v", data, err)
+	}
+	if len(treeFiles.paths) != 0 {
+		t.Errorf("tree files registered: %v", treeFiles.paths)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	output, err := c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "resources" {
+		t.Errorf("the command read %q, want %q", output, "resources")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s wasn't removed after the command: %v", path, err)
+	}
+	if len(treeFiles.paths) != 0 {
+		t.Errorf("tree files still registered: %v", treeFiles.paths)
+	}
+
+	// They are removed when the command fails too.
+	c.Args = []string{cat, filepath.Join(filepath.Dir(path), "missing")}
+	if _, err := c.Run(); err == nil {
+		t.Fatal("the command didn't fail")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s wasn't removed after the failed command: %v", path, err)
+	}
+}
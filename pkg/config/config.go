@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"github.com/mitchellh/gox/pkg/quoted"
+	"github.com/mitchellh/gox/pkg/stamp"
 	"github.com/spf13/pflag"
+	"io"
+	"sort"
 	"strings"
+	"text/template"
 )
 
 type Config struct {
@@ -19,7 +24,136 @@ type Config struct {
 	Race           bool
 	GoCmd          string
 	ModMode        string
+	BuildMode      string
 	PlatformFlag   PlatformFlag
+	Shard          Shard
+
+	// Env holds extra "KEY=value" environment variables for the go
+	// commands, applied after GOOS, GOARCH and CGO_ENABLED.
+	Env []string
+
+	// CgoDisabled turns cgo off even for the host platform, which has it
+	// on by default, as a "cgo" override set to false does.
+	CgoDisabled bool
+
+	// Sysroot is the root directory of the target system's headers and
+	// libraries for cgo cross builds, passed to the C toolchain with
+	// --sysroot and to pkg-config.
+	Sysroot string
+
+	// CgoToolchain is "zig" to compile the C code of cgo builds with
+	// "zig cc" for every platform, or empty for the C compilers found on
+	// the PATH. CgoLibc is the C library zig links linux binaries with:
+	// "gnu", the default, "gnu.X.Y" for a glibc version or "musl".
+	CgoToolchain string
+	CgoLibc      string
+
+	// Static links the binaries of linux builds statically, even with
+	// cgo, and checks that they are after building them.
+	Static bool
+
+	// Defines maps qualified variable names, like "main.version", to the
+	// string they are set to with the linker's -X flag. The values are
+	// templates with the same data as Output.
+	Defines map[string]string
+
+	// Stamp is the import path of a package whose VERSION, REVISION,
+	// BRANCH and BUILT variables are set from Git, the version
+	// information of the source tree, which is also available to the
+	// templates. When Git is nil, ReadGit reads it the first time it is
+	// needed, see GitInfo.
+	Stamp   string
+	Git     *stamp.Info
+	ReadGit func() *stamp.Info
+
+	// BuildInfo adds a generated source file with the build information
+	// to the packages being built, through an -overlay written to WorkDir,
+	// a temporary directory for the files generated for the builds.
+	BuildInfo bool
+	WorkDir   string
+
+	// Universal merges the darwin/amd64 and darwin/arm64 binaries of every
+	// package into a universal binary after they are built, handled like
+	// the binary of a darwin/universal build.
+	Universal bool
+
+	// WindowsResources describes the version information, icon and
+	// manifest linked into the binaries of windows builds, or is nil not
+	// to add any. They are written to a .syso object in the package
+	// directory for the duration of the go command.
+	WindowsResources *FileWindowsResources
+
+	// Archive is the format binaries are packaged in after they are
+	// built, "auto" for the default of their OS, or empty not to package
+	// them. ArchiveName is the path template of the archives, without
+	// extension, ArchiveDir the template of a directory wrapping the
+	// files in the archive and ArchiveFiles the globs of extra files.
+	Archive      string
+	ArchiveName  string
+	ArchiveDir   string
+	ArchiveFiles []string
+
+	// Packages are the formats of the Linux packages, like "deb", the
+	// binaries of linux builds are installed by, or empty not to package
+	// them. Package describes the packages.
+	Packages []string
+	Package  *FilePackages
+
+	// OCI is the path of a multi-platform container image, an OCI image
+	// layout directory or a tarball ending with ".tar", assembled from the
+	// binaries of the linux builds, or empty not to assemble one.
+	// OCIBase is the image layout of the base image and Image describes
+	// the image.
+	OCI     string
+	OCIBase string
+	Image   *FileOCI
+
+	// Checksums is the algorithm of the checksum file written for the
+	// binaries and archives of the run, or empty not to write one.
+	// ChecksumsFile is its path, ChecksumsSidecars also writes a checksum
+	// file next to every artifact.
+	Checksums         string
+	ChecksumsFile     string
+	ChecksumsSidecars bool
+
+	// Sign is the kind of detached signatures written for the binaries,
+	// archives and checksum file, or empty not to sign them. SignKey is
+	// the path of the secret key and SignPassphraseFile the path of the
+	// file holding its passphrase. Both can also be given through the
+	// environment, see cmd.
+	Sign               string
+	SignKey            string
+	SignPassphraseFile string
+
+	// Manifests are the kinds of package manager manifests, like
+	// "homebrew", written by publish-manifests to ManifestsDir for the
+	// artifacts of the run. ManifestsURL is the template of the URL of
+	// the directory the artifacts are downloaded from and Manifest
+	// describes the packages.
+	Manifests    []string
+	ManifestsDir string
+	ManifestsURL string
+	Manifest     *FileManifests
+
+	// ConfigFile is the path of the configuration file, Platforms holds
+	// the per-platform rules read from it.
+	ConfigFile string
+	Platforms  []PlatformRule
+
+	// JUnit and TAP are the paths the results are written to in the
+	// respective formats, "-" meaning stdout. Empty disables them.
+	JUnit string
+	TAP   string
+
+	// Quiet hides the progress of the jobs, Verbose shows the go commands
+	// that are run and their output on Stdout. Plain disables the live
+	// progress display even when writing to a terminal. Trace shows the
+	// exact commands with their environment and working directory.
+	Quiet   bool
+	Verbose bool
+	Plain   bool
+	Trace   bool
+	Stdout  io.Writer
 }
 
 type PlatformFlag struct {
@@ -200,7 +334,12 @@ func (p *PlatformFlag) OSArchFlagValue() pflag.Value {
 type appendPlatformValue []Platform
 
 func (s *appendPlatformValue) String() string {
-	return ""
+	values := make([]string, 0, len(*s))
+	for _, v := range *s {
+		values = append(values, v.String())
+	}
+
+	return strings.Join(values, " ")
 }
 
 func (s *appendPlatformValue) Set(value string) error {
@@ -238,3 +377,152 @@ func (s *appendPlatformValue) appendIfMissing(value *Platform) {
 
 	*s = append(*s, *value)
 }
+
+// FlagsValue returns a flag.Value for flags like --ldflags that can be
+// repeated, merging the flags of every occurrence into p.
+func FlagsValue(p *string) pflag.Value {
+	return (*flagsValue)(p)
+}
+
+type flagsValue string
+
+func (s *flagsValue) String() string {
+	return string(*s)
+}
+
+func (s *flagsValue) Set(value string) error {
+	merged, err := quoted.MergeFlags(string(*s), value)
+	if err != nil {
+		return err
+	}
+
+	*s = flagsValue(merged)
+	return nil
+}
+
+func (s *flagsValue) Type() string {
+	return "flags"
+}
+
+// DefineValue returns a flag.Value for --define that adds name=value pairs
+// to m.
+func DefineValue(m *map[string]string) pflag.Value {
+	return &defineValue{m: m}
+}
+
+type defineValue struct {
+	m *map[string]string
+}
+
+func (d *defineValue) String() string {
+	return strings.Join(Defines(*d.m), " ")
+}
+
+func (d *defineValue) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid define syntax: %s should be name=value", value)
+	}
+	if err := CheckDefine(parts[0], parts[1]); err != nil {
+		return err
+	}
+
+	if *d.m == nil {
+		*d.m = make(map[string]string)
+	}
+	(*d.m)[parts[0]] = parts[1]
+	return nil
+}
+
+func (d *defineValue) Type() string {
+	return "name=value"
+}
+
+func (d *defineValue) Append(value string) error {
+	return d.Set(value)
+}
+
+func (d *defineValue) Replace(values []string) error {
+	*d.m = nil
+	for _, v := range values {
+		if err := d.Set(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *defineValue) GetSlice() []string {
+	return Defines(*d.m)
+}
+
+// CheckDefine checks that name is a qualified variable name, as the -X
+// flag of the linker expects, and that value is a valid template.
+func CheckDefine(name, value string) error {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 || strings.ContainsAny(name, " \t=") {
+		return fmt.Errorf("invalid define %q: the name should be importpath.name", name)
+	}
+	if _, err := template.New(name).Parse(value); err != nil {
+		return fmt.Errorf("invalid define %q: %s", name, err)
+	}
+
+	return nil
+}
+
+// Defines returns the defines in m as sorted name=value pairs.
+func Defines(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]string, 0, len(m))
+	for _, name := range names {
+		result = append(result, name+"="+m[name])
+	}
+
+	return result
+}
+
+// stampVariables maps the variables of the Stamp package to the templates
+// of their values.
+var stampVariables = map[string]string{
+	"VERSION":  "{{.Version}}",
+	"REVISION": "{{.Revision}}",
+	"BRANCH":   "{{.Branch}}",
+	"BUILT":    "{{.Built}}",
+}
+
+// GitInfo returns the version information of the source tree: Git, or
+// else what ReadGit reads, or else the defaults.
+func (c *Config) GitInfo() *stamp.Info {
+	switch {
+	case c.Git != nil:
+		return c.Git
+	case c.ReadGit != nil:
+		return c.ReadGit()
+	default:
+		return stamp.Unknown()
+	}
+}
+
+// JobDefines returns the defines of the jobs: those of the Stamp package
+// followed by Defines, which win over them.
+func (c *Config) JobDefines() map[string]string {
+	if c.Stamp == "" {
+		return c.Defines
+	}
+
+	result := make(map[string]string)
+	for name, value := range stampVariables {
+		result[c.Stamp+"."+name] = value
+	}
+	for name, value := range c.Defines {
+		result[name] = value
+	}
+
+	return result
+}
@@ -0,0 +1,427 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultFile is the configuration file read from the working directory
+// when none is given.
+const DefaultFile = ".gox.yml"
+
+// File is the contents of a gox configuration file. The top-level
+// settings are the same as the command line flags, which take precedence
+// over them.
+type File struct {
+	Path string `yaml:"-"`
+
+	Ldflags          *string               `yaml:"ldflags"`
+	Gcflags          *string               `yaml:"gcflags"`
+	Asmflags         *string               `yaml:"asmflags"`
+	Tags             *string               `yaml:"tags"`
+	Output           *string               `yaml:"output"`
+	Cgo              *bool                 `yaml:"cgo"`
+	CgoToolchain     *string               `yaml:"cgo_toolchain"`
+	CgoLibc          *string               `yaml:"cgo_libc"`
+	Static           *bool                 `yaml:"static"`
+	Mod              *string               `yaml:"mod"`
+	BuildMode        *string               `yaml:"buildmode"`
+	Parallel         *int                  `yaml:"parallel"`
+	Env              map[string]string     `yaml:"env"`
+	Define           map[string]string     `yaml:"define"`
+	Stamp            *string               `yaml:"stamp"`
+	BuildInfo        *bool                 `yaml:"buildinfo"`
+	Universal        *bool                 `yaml:"universal"`
+	WindowsResources *FileWindowsResources `yaml:"windows_resources"`
+	Archive          *FileArchive          `yaml:"archive"`
+	Packages         *FilePackages         `yaml:"packages"`
+	OCI              *FileOCI              `yaml:"oci"`
+	Checksums        *FileChecksums        `yaml:"checksums"`
+	Sign             *FileSign             `yaml:"sign"`
+	Manifests        *FileManifests        `yaml:"manifests"`
+
+	// Platforms holds the per-platform rules, in the order of the file.
+	Platforms []PlatformRule `yaml:"-"`
+}
+
+// FileWindowsResources is the "windows_resources" section of the
+// configuration file, describing the resources of the windows binaries.
+// Icon and Manifest are paths, the other settings templates, with the same
+// data as the output path.
+type FileWindowsResources struct {
+	Icon     string `yaml:"icon"`
+	Manifest string `yaml:"manifest"`
+
+	// Version is the file and product version, "{{.Version}}" by default.
+	// Product and Description default to the name of the binary.
+	Version     string `yaml:"version"`
+	Company     string `yaml:"company"`
+	Product     string `yaml:"product"`
+	Description string `yaml:"description"`
+	Copyright   string `yaml:"copyright"`
+	Trademarks  string `yaml:"trademarks"`
+	Comments    string `yaml:"comments"`
+}
+
+// FileArchive is the "archive" section of the configuration file.
+type FileArchive struct {
+	Format *string  `yaml:"format"`
+	Name   *string  `yaml:"name"`
+	Dir    *string  `yaml:"dir"`
+	Files  []string `yaml:"files"`
+}
+
+// FilePackages is the "packages" section of the configuration file,
+// describing the Linux packages. Name and Version are templates, with the
+// same data as the output path.
+type FilePackages struct {
+	Formats     []string `yaml:"formats"`
+	Name        string   `yaml:"name"`
+	Version     string   `yaml:"version"`
+	Maintainer  string   `yaml:"maintainer"`
+	Description string   `yaml:"description"`
+	Homepage    string   `yaml:"homepage"`
+	License     string   `yaml:"license"`
+	Vendor      string   `yaml:"vendor"`
+
+	// Depends are the dependencies of the packages, replaced by those of
+	// Deb, RPM or APK for the respective format when they have some, as
+	// packages are often named differently.
+	Depends []string           `yaml:"depends"`
+	Deb     *FilePackageFormat `yaml:"deb"`
+	RPM     *FilePackageFormat `yaml:"rpm"`
+	APK     *FilePackageFormat `yaml:"apk"`
+
+	// BinDir is the directory the binaries are installed in. Files are
+	// installed as is, ConfigFiles as configuration files kept on
+	// upgrades and SystemdUnits in the systemd unit directory.
+	BinDir       string            `yaml:"bindir"`
+	Files        []FilePackageFile `yaml:"files"`
+	ConfigFiles  []FilePackageFile `yaml:"config_files"`
+	SystemdUnits []string          `yaml:"systemd_units"`
+
+	// Scripts are the paths of the shell scripts run by the package
+	// manager.
+	Scripts FilePackageScripts `yaml:"scripts"`
+}
+
+// FilePackageFormat holds the settings of FilePackages for one format.
+type FilePackageFormat struct {
+	Depends []string `yaml:"depends"`
+}
+
+// FilePackageFile is a file installed by the packages: Src is installed at
+// Dst, an absolute path, or in it when it ends with a slash.
+type FilePackageFile struct {
+	Src string `yaml:"src"`
+	Dst string `yaml:"dst"`
+}
+
+// FilePackageScripts are the scripts of FilePackages.
+type FilePackageScripts struct {
+	PreInstall  string `yaml:"preinstall"`
+	PostInstall string `yaml:"postinstall"`
+	PreRemove   string `yaml:"preremove"`
+	PostRemove  string `yaml:"postremove"`
+}
+
+// FileOCI is the "oci" section of the configuration file, describing the
+// container image. Tag and the values of Labels are templates, with the
+// same data as the output path.
+type FileOCI struct {
+	Path *string `yaml:"path"`
+	Base *string `yaml:"base"`
+	Tag  string  `yaml:"tag"`
+
+	Entrypoint []string          `yaml:"entrypoint"`
+	Cmd        []string          `yaml:"cmd"`
+	Env        map[string]string `yaml:"env"`
+	User       string            `yaml:"user"`
+	WorkingDir string            `yaml:"workdir"`
+	Labels     map[string]string `yaml:"labels"`
+
+	// BinDir is the directory the binaries are added in, Files are extra
+	// files added as is.
+	BinDir string            `yaml:"bindir"`
+	Files  []FilePackageFile `yaml:"files"`
+}
+
+// FileChecksums is the "checksums" section of the configuration file.
+type FileChecksums struct {
+	Algorithm *string `yaml:"algorithm"`
+	File      *string `yaml:"file"`
+	Sidecars  *bool   `yaml:"sidecars"`
+}
+
+// FileSign is the "sign" section of the configuration file. Secrets don't
+// belong in it, only the paths of the files holding them.
+type FileSign struct {
+	Kind           *string `yaml:"kind"`
+	Key            *string `yaml:"key"`
+	PassphraseFile *string `yaml:"passphrase_file"`
+}
+
+// FileManifests is the "manifests" section of the configuration file, read
+// by publish-manifests. Name and Version are templates, with the same
+// data as the output path.
+type FileManifests struct {
+	Kinds   []string `yaml:"kinds"`
+	Dir     *string  `yaml:"dir"`
+	BaseURL *string  `yaml:"base_url"`
+
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+	Homepage    string `yaml:"homepage"`
+	License     string `yaml:"license"`
+
+	// Publisher and Identifier, like "Publisher.Name", are used by
+	// winget.
+	Publisher  string `yaml:"publisher"`
+	Identifier string `yaml:"identifier"`
+}
+
+// fileYAML is the layout of the file, leaving the platform rules to be
+// decoded in order.
+type fileYAML struct {
+	File      `yaml:",inline"`
+	Platforms yaml.Node `yaml:"platforms"`
+}
+
+// PlatformRule holds the settings of the "platforms" section of the
+// configuration file for the platforms matching Pattern.
+type PlatformRule struct {
+	// Pattern is an os/arch pair where either part may use the wildcards
+	// of path.Match, like "windows/*" or "linux/mips*".
+	Pattern string
+
+	Settings RuleSettings
+	Source   string
+}
+
+// RuleSettings are the settings a platform rule can override. The
+// "_append" variants add to the flags or tags instead of replacing them.
+type RuleSettings struct {
+	Ldflags        *string           `yaml:"ldflags"`
+	LdflagsAppend  *string           `yaml:"ldflags_append"`
+	Gcflags        *string           `yaml:"gcflags"`
+	GcflagsAppend  *string           `yaml:"gcflags_append"`
+	Asmflags       *string           `yaml:"asmflags"`
+	AsmflagsAppend *string           `yaml:"asmflags_append"`
+	Tags           *string           `yaml:"tags"`
+	TagsAppend     *string           `yaml:"tags_append"`
+	Output         *string           `yaml:"output"`
+	Cgo            *bool             `yaml:"cgo"`
+	CC             *string           `yaml:"cc"`
+	CXX            *string           `yaml:"cxx"`
+	AR             *string           `yaml:"ar"`
+	PkgConfigPath  *string           `yaml:"pkg_config_path"`
+	CgoCflags      *string           `yaml:"cgo_cflags"`
+	CgoCxxflags    *string           `yaml:"cgo_cxxflags"`
+	CgoLdflags     *string           `yaml:"cgo_ldflags"`
+	Sysroot        *string           `yaml:"sysroot"`
+	CgoToolchain   *string           `yaml:"cgo_toolchain"`
+	CgoLibc        *string           `yaml:"cgo_libc"`
+	Mod            *string           `yaml:"mod"`
+	BuildMode      *string           `yaml:"buildmode"`
+	Env            map[string]string `yaml:"env"`
+}
+
+// ReadFile reads and validates the configuration file at path. Unknown
+// settings are errors, so that typos don't go unnoticed.
+func ReadFile(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw fileYAML
+	if err := decodeStrict(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	f := raw.File
+	f.Path = path
+	for name, value := range f.Define {
+		if err := CheckDefine(name, value); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	// The rules are decoded one by one to keep them in the file's order.
+	platforms := &raw.Platforms
+	if platforms.Kind != 0 && platforms.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: platforms must be a mapping of os/arch patterns to settings",
+			path, platforms.Line)
+	}
+	for i := 0; i+1 < len(platforms.Content); i += 2 {
+		key, value := platforms.Content[i], platforms.Content[i+1]
+		rule := PlatformRule{
+			Pattern: key.Value,
+			Source:  fmt.Sprintf("%s platforms %s", path, key.Value),
+		}
+		if err := validatePattern(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, key.Line, err)
+		}
+
+		if err := checkRuleKeys(value); err != nil {
+			return nil, fmt.Errorf("%s:%s", path, err)
+		}
+		if err := value.Decode(&rule.Settings); err != nil {
+			return nil, fmt.Errorf("%s: platforms %s: %s", path, rule.Pattern, err)
+		}
+
+		f.Platforms = append(f.Platforms, rule)
+	}
+
+	return &f, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// checkRuleKeys returns an error for the first key of the rule that isn't
+// a setting, with its line in the file.
+func checkRuleKeys(rule *yaml.Node) error {
+	if rule.Kind != yaml.MappingNode {
+		return fmt.Errorf("%d: platform settings must be a mapping", rule.Line)
+	}
+
+	known := make(map[string]bool)
+	t := reflect.TypeOf(RuleSettings{})
+	for i := 0; i < t.NumField(); i++ {
+		known[t.Field(i).Tag.Get("yaml")] = true
+	}
+
+	for i := 0; i < len(rule.Content); i += 2 {
+		key := rule.Content[i]
+		if !known[key.Value] {
+			return fmt.Errorf("%d: unknown platform setting %q", key.Line, key.Value)
+		}
+	}
+
+	return nil
+}
+
+func validatePattern(pattern string) error {
+	parts := strings.Split(pattern, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid platform pattern %q, should be os/arch", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid platform pattern %q: %s", pattern, err)
+	}
+
+	return nil
+}
+
+// Matches reports whether the rule applies to platform.
+func (r *PlatformRule) Matches(platform Platform) bool {
+	ok, _ := path.Match(r.Pattern, platform.String())
+	return ok
+}
+
+// specificity is the number of parts of the pattern without wildcards.
+func (r *PlatformRule) specificity() int {
+	n := 0
+	for _, part := range strings.Split(r.Pattern, "/") {
+		if !strings.ContainsAny(part, "*?[") {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Overrides returns the settings of the rule as overrides.
+func (r *PlatformRule) Overrides() []Override {
+	var overrides []Override
+	add := func(key string, value *string, appendValue bool) {
+		if value != nil {
+			overrides = append(overrides, Override{
+				Source: r.Source,
+				Key:    key,
+				Value:  *value,
+				Append: appendValue,
+			})
+		}
+	}
+
+	s := &r.Settings
+	add("LDFLAGS", s.Ldflags, false)
+	add("LDFLAGS", s.LdflagsAppend, true)
+	add("GCFLAGS", s.Gcflags, false)
+	add("GCFLAGS", s.GcflagsAppend, true)
+	add("ASMFLAGS", s.Asmflags, false)
+	add("ASMFLAGS", s.AsmflagsAppend, true)
+	add("TAGS", s.Tags, false)
+	add("TAGS", s.TagsAppend, true)
+	add("OUTPUT", s.Output, false)
+	add("CC", s.CC, false)
+	add("CXX", s.CXX, false)
+	add("AR", s.AR, false)
+	add("PKG_CONFIG_PATH", s.PkgConfigPath, false)
+	add("CGO_CFLAGS", s.CgoCflags, false)
+	add("CGO_CXXFLAGS", s.CgoCxxflags, false)
+	add("CGO_LDFLAGS", s.CgoLdflags, false)
+	add("SYSROOT", s.Sysroot, false)
+	add("CGO_TOOLCHAIN", s.CgoToolchain, false)
+	add("CGO_LIBC", s.CgoLibc, false)
+	add("MOD", s.Mod, false)
+	add("BUILDMODE", s.BuildMode, false)
+	if s.Cgo != nil {
+		cgo := strconv.FormatBool(*s.Cgo)
+		add("CGO", &cgo, false)
+	}
+
+	names := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := s.Env[name]
+		add("ENV_"+name, &value, false)
+	}
+
+	return overrides
+}
+
+// RuleOverrides returns the overrides of the rules matching platform. The
+// rules are applied from the least to the most specific pattern, so that
+// "linux/arm" wins over "linux/*" which wins over "*/*", and in the order
+// of the file for patterns that are as specific.
+func RuleOverrides(rules []PlatformRule, platform Platform) []Override {
+	matching := make([]PlatformRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Matches(platform) {
+			matching = append(matching, rule)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].specificity() < matching[j].specificity()
+	})
+
+	var overrides []Override
+	for _, rule := range matching {
+		overrides = append(overrides, rule.Overrides()...)
+	}
+
+	return overrides
+}
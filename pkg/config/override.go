@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/quoted"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Override is a per-platform setting applied on top of the configuration
+// for the jobs of that platform.
+type Override struct {
+	// Source describes where the override comes from, such as the name of
+	// the environment variable.
+	Source string
+
+	// Key is the setting, e.g. "LDFLAGS", or "ENV_" followed by the name
+	// of an environment variable to set.
+	Key   string
+	Value string
+
+	// Append adds Value to the flags or tags instead of replacing them.
+	Append bool
+}
+
+// appendSuffix marks overrides that append to the setting instead of
+// replacing it.
+const appendSuffix = "_APPEND"
+
+// overrideKeys are the settings that can be overridden, mapped to whether
+// they can be appended to.
+var overrideKeys = map[string]bool{
+	"LDFLAGS":   true,
+	"GCFLAGS":   true,
+	"ASMFLAGS":  true,
+	"TAGS":      true,
+	"OUTPUT":    false,
+	"CGO":       false,
+	"CC":        false,
+	"CXX":       false,
+	"MOD":       false,
+	"BUILDMODE": false,
+
+	// The C toolchain of cgo builds.
+	"AR":              false,
+	"PKG_CONFIG_PATH": false,
+	"CGO_CFLAGS":      false,
+	"CGO_CXXFLAGS":    false,
+	"CGO_LDFLAGS":     false,
+	"SYSROOT":         false,
+	"CGO_TOOLCHAIN":   false,
+	"CGO_LIBC":        false,
+}
+
+// EnvOverrides returns the overrides for platform set in environ, a list
+// of "KEY=value" pairs like os.Environ returns, by GOX_[OS]_[ARCH]_[KEY]
+// variables. An unknown key is an error so that typos don't go unnoticed.
+func EnvOverrides(environ []string, platform Platform) ([]Override, error) {
+	prefix := strings.ToUpper(fmt.Sprintf("GOX_%s_%s_", platform.OS, platform.Arch))
+
+	var overrides []Override
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) || parts[1] == "" {
+			continue
+		}
+
+		o := Override{Source: parts[0], Key: parts[0][len(prefix):], Value: parts[1]}
+		if !strings.HasPrefix(o.Key, "ENV_") && strings.HasSuffix(o.Key, appendSuffix) {
+			o.Key = strings.TrimSuffix(o.Key, appendSuffix)
+			o.Append = true
+		}
+
+		if err := o.validate(); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+
+	sortOverrides(overrides)
+	return overrides, nil
+}
+
+// SetsEnv reports whether the override sets an environment variable of
+// the go command, like "ENV_" overrides and the C toolchain settings but
+// the sysroot and the zig settings.
+func (o *Override) SetsEnv() bool {
+	switch o.Key {
+	case "CC", "CXX", "AR", "PKG_CONFIG_PATH", "CGO_CFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS":
+		return true
+	}
+
+	return strings.HasPrefix(o.Key, "ENV_")
+}
+
+func (o *Override) validate() error {
+	if strings.HasPrefix(o.Key, "ENV_") {
+		if len(o.Key) == len("ENV_") {
+			return fmt.Errorf("%s: missing variable name", o.Source)
+		}
+		return nil
+	}
+
+	appendable, ok := overrideKeys[o.Key]
+	if !ok {
+		return fmt.Errorf("%s: unknown setting %s", o.Source, o.Key)
+	}
+	if o.Append && !appendable {
+		return fmt.Errorf("%s: %s can't be appended to", o.Source, o.Key)
+	}
+	if o.Key == "CGO" {
+		if _, err := strconv.ParseBool(o.Value); err != nil {
+			return fmt.Errorf("%s: %q isn't a boolean", o.Source, o.Value)
+		}
+	}
+
+	return nil
+}
+
+// sortOverrides orders overrides by key, replacements before appends, so
+// that they are applied the same way whatever order they were found in.
+func sortOverrides(overrides []Override) {
+	sort.SliceStable(overrides, func(i, j int) bool {
+		if overrides[i].Key != overrides[j].Key {
+			return overrides[i].Key < overrides[j].Key
+		}
+		return !overrides[i].Append && overrides[j].Append
+	})
+}
+
+// WithOverrides returns a copy of c with the overrides applied, leaving c
+// untouched so that it can be shared by concurrent jobs.
+func (c *Config) WithOverrides(overrides []Override) (*Config, error) {
+	result := *c
+	result.Env = append([]string(nil), c.Env...)
+
+	for _, o := range overrides {
+		err := o.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		switch o.Key {
+		case "LDFLAGS":
+			err = applyFlags(&result.Ldflags, o)
+		case "GCFLAGS":
+			err = applyFlags(&result.Gcflags, o)
+		case "ASMFLAGS":
+			err = applyFlags(&result.Asmflags, o)
+		case "TAGS":
+			// Stick to spaces for tags that were given the old way.
+			sep := ","
+			if strings.Contains(result.Tags, " ") && !strings.Contains(result.Tags, ",") {
+				sep = " "
+			}
+			result.Tags = apply(result.Tags, o, sep)
+		case "OUTPUT":
+			result.Output = o.Value
+		case "CGO":
+			// Disabling cgo has to win over enabling it automatically for
+			// the host platform, and a later override over both.
+			result.Cgo, _ = strconv.ParseBool(o.Value)
+			result.CgoDisabled = !result.Cgo
+		case "SYSROOT":
+			result.Sysroot = o.Value
+		case "CGO_TOOLCHAIN":
+			result.CgoToolchain = o.Value
+		case "CGO_LIBC":
+			result.CgoLibc = o.Value
+		case "MOD":
+			result.ModMode = o.Value
+		case "BUILDMODE":
+			result.BuildMode = o.Value
+		default:
+			result.Env = append(result.Env, strings.TrimPrefix(o.Key, "ENV_")+"="+o.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", o.Source, err)
+		}
+	}
+
+	// Flags that weren't overridden may still come straight from the
+	// command line or the configuration file.
+	if err := result.NormalizeFlags(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// applyFlags applies the override of a flags setting, merging the flags
+// when appending.
+func applyFlags(current *string, o Override) error {
+	values := []string{o.Value}
+	if o.Append {
+		values = []string{*current, o.Value}
+	}
+
+	merged, err := quoted.MergeFlags(values...)
+	if err != nil {
+		return err
+	}
+	*current = merged
+	return nil
+}
+
+// NormalizeFlags checks the quoting of the ldflags, gcflags and asmflags
+// and rewrites them in the format the go command parses.
+func (c *Config) NormalizeFlags() error {
+	for _, flag := range []struct {
+		name  string
+		value *string
+	}{
+		{"ldflags", &c.Ldflags},
+		{"gcflags", &c.Gcflags},
+		{"asmflags", &c.Asmflags},
+	} {
+		normalized, err := quoted.Normalize(*flag.value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", flag.name, err)
+		}
+		*flag.value = normalized
+	}
+
+	return nil
+}
+
+func apply(current string, o Override, sep string) string {
+	if !o.Append || current == "" {
+		return o.Value
+	}
+
+	return current + sep + o.Value
+}
+
+// Getenv returns the value of the variable in c.Env, falling back to the
+// environment gox runs in.
+func (c *Config) Getenv(key string) string {
+	if value, ok := c.LookupEnv(key); ok {
+		return value
+	}
+
+	return os.Getenv(key)
+}
+
+// LookupEnv returns the value of the variable in c.Env and whether it is
+// set there, leaving out the environment gox runs in.
+func (c *Config) LookupEnv(key string) (string, bool) {
+	for i := len(c.Env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(c.Env[i], key+"=") {
+			return c.Env[i][len(key)+1:], true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestWithOverridesCgo(t *testing.T) {
+	cases := []struct {
+		name     string
+		values   []string
+		cgo      bool
+		disabled bool
+	}{
+		{"enable", []string{"true"}, true, false},
+		{"disable", []string{"false"}, false, true},
+		{"disable then enable", []string{"false", "true"}, true, false},
+		{"enable then disable", []string{"true", "false"}, false, true},
+	}
+
+	for _, tc := range cases {
+		var overrides []Override
+		for _, v := range tc.values {
+			overrides = append(overrides, Override{Source: "test", Key: "CGO", Value: v})
+		}
+
+		cfg, err := (&Config{}).WithOverrides(overrides)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if cfg.Cgo != tc.cgo || cfg.CgoDisabled != tc.disabled {
+			t.Errorf("%s: got Cgo %v, CgoDisabled %v, want %v, %v",
+				tc.name, cfg.Cgo, cfg.CgoDisabled, tc.cgo, tc.disabled)
+		}
+		for _, kv := range cfg.Env {
+			t.Errorf("%s: unexpected variable %s", tc.name, kv)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Shard selects a deterministic slice of the build jobs so that they can
+// be split across machines: every Count-th job, starting with the
+// Index-th one. Index is 1-based, the zero Shard selects every job.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// Includes reports whether the job at index i, 0-based, of the sorted job
+// list is part of the shard.
+func (s *Shard) Includes(i int) bool {
+	if s.Count == 0 {
+		return true
+	}
+
+	return i%s.Count == s.Index-1
+}
+
+func (s *Shard) String() string {
+	if s.Count == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+func (s *Shard) Set(value string) error {
+	var index, count int
+	if _, err := fmt.Sscanf(value, "%d/%d", &index, &count); err != nil {
+		return fmt.Errorf("invalid shard syntax: %s should be i/n", value)
+	}
+	if count < 1 || index < 1 || index > count {
+		return fmt.Errorf("invalid shard %s: i must be between 1 and n", value)
+	}
+
+	s.Index = index
+	s.Count = count
+	return nil
+}
+
+func (s *Shard) Type() string {
+	return "shard"
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/quoted"
+	"github.com/mitchellh/gox/pkg/stamp"
+	"io"
 	"log"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -15,52 +17,95 @@ import (
 )
 
 type OutputTemplateData struct {
-	Dir  string
-	OS   string
-	Arch string
+	Dir     string
+	OS      string
+	Arch    string
+	Package string
+
+	// git returns the version information of the source tree, which the
+	// methods below return. It is only read when a template uses it.
+	git func() *stamp.Info
 }
 
+// The version information of the source tree, see stamp.Info.
+func (d *OutputTemplateData) Version() string  { return d.git().Version }
+func (d *OutputTemplateData) Commit() string   { return d.git().Commit }
+func (d *OutputTemplateData) Revision() string { return d.git().Revision }
+func (d *OutputTemplateData) Branch() string   { return d.git().Branch }
+func (d *OutputTemplateData) Dirty() bool      { return d.git().Dirty }
+func (d *OutputTemplateData) Built() string    { return d.git().Built }
+
+// GoCrossCompile builds the package at packagePath for the given platform
+// using `go build`.
 func GoCrossCompile(cfg *config.Config, platform config.Platform, packagePath string) error {
-	env := append(os.Environ(), "GOOS="+platform.OS, "GOARCH="+platform.Arch)
+	cmd, err := GoBuildCommand(cfg, platform, packagePath)
+	if err != nil {
+		return err
+	}
 
-	// If we're building for our own platform, then enable cgo always. We
-	// respect the CGO_ENABLED flag if that is explicitly set on the platform.
-	cgo := cfg.Cgo
-	if !cfg.Cgo && os.Getenv("CGO_ENABLED") != "0" {
-		cgo = runtime.GOOS == platform.OS && runtime.GOARCH == platform.Arch
+	return runCommand(cfg, cmd)
+}
+
+// GoCrossCompileTest compiles the test binary of the package at packagePath
+// for the given platform using `go test -c`. The binary is not run.
+func GoCrossCompileTest(cfg *config.Config, platform config.Platform, packagePath string) error {
+	cmd, err := GoTestCommand(cfg, platform, packagePath)
+	if err != nil {
+		return err
 	}
 
+	return runCommand(cfg, cmd)
+}
+
+// GoBuildCommand returns the `go build` command that GoCrossCompile runs.
+func GoBuildCommand(cfg *config.Config, platform config.Platform, packagePath string) (*Command, error) {
+	return goCommand(cfg, platform, packagePath, "build")
+}
+
+// GoTestCommand returns the `go test -c` command that GoCrossCompileTest
+// runs.
+func GoTestCommand(cfg *config.Config, platform config.Platform, packagePath string) (*Command, error) {
+	return goCommand(cfg, platform, packagePath, "test", "-c")
+}
+
+func goCommand(cfg *config.Config, platform config.Platform, packagePath string, command ...string) (*Command, error) {
+	env := []string{"GOOS=" + platform.OS, "GOARCH=" + platform.Arch}
+
 	// If cgo is enabled then set that env var
-	if cgo {
+	if CgoEnabled(cfg, platform) {
 		env = append(env, "CGO_ENABLED=1")
 	} else {
 		env = append(env, "CGO_ENABLED=0")
 	}
-
-	var outputPath bytes.Buffer
-	tpl, err := template.New("output").Parse(cfg.Output)
-	if err != nil {
-		return err
+	for _, kv := range cfg.Env {
+		env = setEnv(env, kv)
 	}
-	tplData := OutputTemplateData{
-		Dir:  filepath.Base(packagePath),
-		OS:   platform.OS,
-		Arch: platform.Arch,
-	}
-	if err := tpl.Execute(&outputPath, &tplData); err != nil {
-		return err
+	if CgoEnabled(cfg, platform) {
+		toolchain, err := CgoToolchain(cfg, platform)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range toolchain {
+			env = setEnv(env, kv)
+		}
 	}
 
-	if platform.OS == "windows" {
-		outputPath.WriteString(".exe")
+	outputPathReal, err := OutputPath(cfg, platform, packagePath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Determine the full path to the output so that we can change our
-	// working directory when executing go build.
-	outputPathReal := outputPath.String()
-	outputPathReal, err = filepath.Abs(outputPathReal)
+	ldflags, err := Ldflags(cfg, platform, packagePath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var resources []byte
+	if platform.OS == "windows" && cfg.WindowsResources != nil && command[0] == "build" && cfg.BuildMode != "c-archive" {
+		resources, err = windowsResources(cfg, platform, packagePath, outputPathReal)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Go prefixes the import directory with '_' when it is outside
@@ -79,7 +124,7 @@ func GoCrossCompile(cfg *config.Config, platform config.Platform, packagePath st
 		packagePath = ""
 	}
 
-	args := []string{"build"}
+	args := append([]string{cfg.GoCmd}, command...)
 	if cfg.Rebuild {
 		args = append(args, "-a")
 	}
@@ -89,18 +134,168 @@ func GoCrossCompile(cfg *config.Config, platform config.Platform, packagePath st
 	if cfg.Race {
 		args = append(args, "-race")
 	}
+	if cfg.BuildMode != "" {
+		args = append(args, "-buildmode", cfg.BuildMode)
+	}
+	tags := cfg.Tags
+	var files, treeFiles map[string]string
+	if cfg.BuildInfo || resources != nil {
+		name, dir, err := goPackage(cfg, chdir, packagePath)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.BuildInfo {
+			var overlay string
+			overlay, files, err = buildInfoOverlay(cfg, platform, name, dir)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "-overlay", overlay)
+			tags = addTag(tags, BuildInfoTag)
+		}
+		if resources != nil {
+			path := filepath.Join(dir, fmt.Sprintf(ResourcesFile, platform.Arch))
+			treeFiles = map[string]string{path: string(resources)}
+		}
+	}
+	if Static(cfg, platform) && CgoEnabled(cfg, platform) {
+		for _, tag := range StaticTags {
+			tags = addTag(tags, tag)
+		}
+	}
 	args = append(args,
 		"-gcflags", cfg.Gcflags,
-		"-ldflags", cfg.Ldflags,
+		"-ldflags", ldflags,
 		"-asmflags", cfg.Asmflags,
-		"-tags", cfg.Tags,
+		"-tags", tags,
 		"-o", outputPathReal,
 		packagePath)
 
-	_, err = execGo(cfg.GoCmd, env, chdir, args...)
+	return &Command{
+		Dir:       chdir,
+		Env:       env,
+		Args:      args,
+		Output:    outputPathReal,
+		Files:     files,
+		TreeFiles: treeFiles,
+	}, nil
+}
+
+// CgoEnabled reports whether cgo is enabled when building for platform.
+func CgoEnabled(cfg *config.Config, platform config.Platform) bool {
+	// If we're building for our own platform, then enable cgo always. We
+	// respect the CGO_ENABLED flag if that is explicitly set on the platform.
+	if cfg.CgoDisabled {
+		return false
+	}
+	cgo := cfg.Cgo
+	if !cfg.Cgo && cfg.Getenv("CGO_ENABLED") != "0" {
+		cgo = runtime.GOOS == platform.OS && runtime.GOARCH == platform.Arch
+	}
+
+	return cgo
+}
+
+// setEnv sets the "KEY=value" pair kv in env, replacing any previous value
+// of KEY.
+func setEnv(env []string, kv string) []string {
+	key := kv
+	if i := strings.Index(kv, "="); i >= 0 {
+		key = kv[:i]
+	}
+
+	for i, existing := range env {
+		if strings.HasPrefix(existing, key+"=") {
+			env[i] = kv
+			return env
+		}
+	}
+
+	return append(env, kv)
+}
+
+// runCommand runs cmd, tracing it and showing its output as requested
+// in cfg.
+func runCommand(cfg *config.Config, cmd *Command) error {
+	if cfg.Trace {
+		io.WriteString(cfg.Stdout, cmd.Trace())
+	} else if cfg.Verbose {
+		fmt.Fprintln(cfg.Stdout, cmd.CommandLine())
+	}
+
+	stdout, err := cmd.Run()
+	if cfg.Verbose && stdout != "" {
+		io.WriteString(cfg.Stdout, stdout)
+	}
 	return err
 }
 
+// OutputPath renders the output template of cfg for the given platform and
+// package, returning the absolute path the compiled binary is written to.
+func OutputPath(cfg *config.Config, platform config.Platform, packagePath string) (string, error) {
+	outputPath, err := RenderTemplate(cfg, platform, packagePath, "output", cfg.Output)
+	if err != nil {
+		return "", err
+	}
+
+	outputPath += OutputExt(cfg.BuildMode, platform.OS)
+
+	// Determine the full path to the output so that we can change our
+	// working directory when executing go build.
+	return filepath.Abs(outputPath)
+}
+
+// Ldflags returns the linker flags of cfg followed by a -X flag for each
+// of its defines, including the variables of the stamp package, with the
+// values rendered for the given platform and package.
+func Ldflags(cfg *config.Config, platform config.Platform, packagePath string) (string, error) {
+	flags, err := quoted.ParseFlags(cfg.Ldflags)
+	if err != nil {
+		return "", fmt.Errorf("ldflags: %s", err)
+	}
+
+	for _, define := range config.Defines(cfg.JobDefines()) {
+		parts := strings.SplitN(define, "=", 2)
+		value, err := RenderTemplate(cfg, platform, packagePath, parts[0], parts[1])
+		if err != nil {
+			return "", err
+		}
+
+		flags.Fields = append(flags.Fields, "-X", parts[0]+"="+value)
+	}
+	if Static(cfg, platform) && CgoEnabled(cfg, platform) {
+		flags.Fields = staticLdflags(flags.Fields, cfg.BuildMode == "pie")
+	}
+
+	return flags.String()
+}
+
+// RenderTemplate renders text, a template like the output path, for the
+// given platform and package.
+func RenderTemplate(cfg *config.Config, platform config.Platform, packagePath, name, text string) (string, error) {
+	var result bytes.Buffer
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	tplData := templateData(cfg, platform, packagePath)
+	if err := tpl.Execute(&result, &tplData); err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+func templateData(cfg *config.Config, platform config.Platform, packagePath string) OutputTemplateData {
+	return OutputTemplateData{
+		Dir:     filepath.Base(packagePath),
+		OS:      platform.OS,
+		Arch:    platform.Arch,
+		Package: packagePath,
+		git:     cfg.GitInfo,
+	}
+}
+
 // GoMainDirs returns the file paths to the packages that are "main"
 // packages, from the list of packages given. The list of packages can
 // include relative paths, the special "..." Go keyword, etc.
@@ -134,6 +329,62 @@ func GoMainDirs(packages []string, GoCmd string) ([]string, error) {
 	return results, nil
 }
 
+// GoTestDirs returns the import paths of the packages that have test files,
+// from the list of packages given. Unlike GoMainDirs, the packages don't
+// need to be "main" packages.
+func GoTestDirs(packages []string, GoCmd string) ([]string, error) {
+	args := make([]string, 0, len(packages)+3)
+	args = append(args, "list", "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.ImportPath}}{{end}}")
+	args = append(args, packages...)
+
+	output, err := execGo(GoCmd, nil, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		results = append(results, line)
+	}
+
+	return results, nil
+}
+
+// GoPackageDirs returns the source directory of each of the given
+// packages, keyed by import path.
+func GoPackageDirs(packages []string, GoCmd string) (map[string]string, error) {
+	args := make([]string, 0, len(packages)+3)
+	args = append(args, "list", "-f", "{{.ImportPath}}|{{.Dir}}")
+	args = append(args, packages...)
+
+	output, err := execGo(GoCmd, nil, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 {
+			log.Printf("Bad line reading packages: %s", line)
+			continue
+		}
+
+		results[parts[0]] = parts[1]
+	}
+
+	return results, nil
+}
+
 // GoRoot returns the GOROOT value for the compiled `go` binary.
 func GoRoot() (string, error) {
 	output, err := execGo("go", nil, "", "env", "GOROOT")
@@ -154,6 +405,17 @@ func GoVersionParts() (result [2]int, err error) {
 	return
 }
 
+// ExecError is returned when a go command fails. It carries what the
+// command printed on stderr, usually the compiler errors.
+type ExecError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("%s\nStderr: %s", e.Err, e.Stderr)
+}
+
 func execGo(GoCmd string, env []string, dir string, args ...string) (string, error) {
 	var stderr, stdout bytes.Buffer
 	cmd := exec.Command(GoCmd, args...)
@@ -166,8 +428,7 @@ func execGo(GoCmd string, env []string, dir string, args ...string) (string, err
 		cmd.Dir = dir
 	}
 	if err := cmd.Run(); err != nil {
-		err = fmt.Errorf("%s\nStderr: %s", err, stderr.String())
-		return "", err
+		return "", &ExecError{Err: err, Stderr: stderr.String()}
 	}
 
 	return stdout.String(), nil
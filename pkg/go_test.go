@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/mitchellh/gox/pkg/config"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunCommandVerbose(t *testing.T) {
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true not found")
+	}
+
+	var stdout bytes.Buffer
+	cfg := &config.Config{Verbose: true, Stdout: &stdout}
+	args := []string{truePath, "-ldflags", "", "-X", "main.motd=hello world", "it's"}
+	if err := runCommand(cfg, &Command{Args: args}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The echoed command can be copied and run as it is.
+	line := strings.TrimSuffix(stdout.String(), "\n")
+	want := truePath + ` -ldflags '' -X 'main.motd=hello world' 'it'\''s'`
+	if line != want {
+		t.Errorf("echoed %q, want %q", line, want)
+	}
+}
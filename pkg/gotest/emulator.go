@@ -0,0 +1,87 @@
+package gotest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+)
+
+// qemuArch maps GOARCH values to the architecture names used by qemu-user
+// for its binaries (qemu-<arch>) and binfmt_misc entries.
+var qemuArch = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// binfmtDir is where the kernel exposes the registered binfmt_misc handlers.
+const binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// Exec describes how a binary built for a platform is run on this host.
+type Exec struct {
+	// Prefix is prepended to the command line of the binary, for example
+	// the path to qemu-aarch64. It is empty if the binary runs directly.
+	Prefix []string
+
+	// Via is a short description of how the binary is run: "native",
+	// "binfmt_misc" or the name of the emulator.
+	Via string
+}
+
+// Lookup determines how binaries for the given platform can be run on
+// this host. If they can't be run at all, nil is returned along with the
+// reason, and the platform is compile-only.
+func Lookup(platform config.Platform) (*Exec, string) {
+	if platform.OS == runtime.GOOS && platform.Arch == runtime.GOARCH {
+		return &Exec{Via: "native"}, ""
+	}
+
+	if platform.OS != "linux" {
+		return nil, fmt.Sprintf("%s binaries can't be emulated", platform.OS)
+	}
+	if runtime.GOOS != "linux" {
+		return nil, "qemu user-mode emulation requires a linux host"
+	}
+
+	arch, ok := qemuArch[platform.Arch]
+	if !ok {
+		return nil, fmt.Sprintf("qemu doesn't support %s", platform.Arch)
+	}
+
+	// A registered binfmt_misc handler lets the kernel start the emulator
+	// for us, so the binary is executed as is.
+	status, err := ioutil.ReadFile(binfmtDir + "/qemu-" + arch)
+	if err == nil && bytes.HasPrefix(status, []byte("enabled")) {
+		return &Exec{Via: "binfmt_misc"}, ""
+	}
+
+	for _, name := range []string{"qemu-" + arch, "qemu-" + arch + "-static"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &Exec{Prefix: []string{path}, Via: name}, ""
+		}
+	}
+
+	return nil, fmt.Sprintf("qemu-%s not found on the PATH or in binfmt_misc", arch)
+}
+
+// Command returns the command line that runs the test binary with
+// -test.v and the given args.
+func (e *Exec) Command(binary string, args ...string) []string {
+	argv := make([]string, 0, len(e.Prefix)+len(args)+2)
+	argv = append(argv, e.Prefix...)
+	argv = append(argv, binary, "-test.v")
+	return append(argv, args...)
+}
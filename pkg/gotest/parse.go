@@ -0,0 +1,89 @@
+package gotest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Test statuses as printed by the testing package.
+const (
+	StatusPass = "PASS"
+	StatusFail = "FAIL"
+	StatusSkip = "SKIP"
+)
+
+// Test is the result of a single test function or subtest.
+type Test struct {
+	Name    string
+	Status  string
+	Elapsed time.Duration
+	Output  string
+}
+
+var (
+	eventLine  = regexp.MustCompile(`^=== (RUN|PAUSE|CONT|NAME)\s+(\S+)`)
+	resultLine = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s\)`)
+)
+
+// Parse reads the output of a test binary run with -test.v and returns the
+// tests in the order they started. Tests that were started but never
+// reported a result, for example because the binary panicked, are
+// reported as failed.
+func Parse(output string) []Test {
+	var order []string
+	outputs := make(map[string]*strings.Builder)
+	results := make(map[string]*Test)
+	current := ""
+
+	started := func(name string) {
+		if _, ok := outputs[name]; !ok {
+			outputs[name] = &strings.Builder{}
+			order = append(order, name)
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := eventLine.FindStringSubmatch(line); m != nil {
+			current = m[2]
+			started(current)
+			continue
+		}
+
+		if m := resultLine.FindStringSubmatch(line); m != nil {
+			current = m[2]
+			started(current)
+			seconds, _ := strconv.ParseFloat(m[3], 64)
+			results[current] = &Test{
+				Name:    current,
+				Status:  m[1],
+				Elapsed: time.Duration(seconds * float64(time.Second)),
+			}
+			continue
+		}
+
+		// The final verdict ends the output of the last test.
+		if line == "PASS" || line == "FAIL" {
+			current = ""
+		}
+		if current == "" {
+			continue
+		}
+
+		outputs[current].WriteString(line)
+		outputs[current].WriteString("\n")
+	}
+
+	tests := make([]Test, 0, len(order))
+	for _, name := range order {
+		test, ok := results[name]
+		if !ok {
+			test = &Test{Name: name, Status: StatusFail}
+		}
+		test.Output = outputs[name].String()
+		tests = append(tests, *test)
+	}
+
+	return tests
+}
@@ -0,0 +1,53 @@
+package gotest
+
+import (
+	"bytes"
+	"os/exec"
+	"time"
+)
+
+// Result is the outcome of running one test binary.
+type Result struct {
+	Tests   []Test
+	Output  string
+	Elapsed time.Duration
+
+	// Err is set if the binary couldn't be started or exited with a
+	// non-zero status.
+	Err error
+}
+
+// Run executes the test binary with -test.v in dir, the way "go test" runs
+// it from the package directory, and collects its results. Any args are
+// passed to the binary after -test.v.
+func Run(e *Exec, binary, dir string, args ...string) *Result {
+	argv := e.Command(binary, args...)
+
+	var output bytes.Buffer
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &Result{
+		Output:  output.String(),
+		Elapsed: time.Since(start),
+		Err:     err,
+	}
+	result.Tests = Parse(result.Output)
+	return result
+}
+
+// Count returns the number of tests with the given status.
+func (r *Result) Count(status string) int {
+	n := 0
+	for _, test := range r.Tests {
+		if test.Status == status {
+			n++
+		}
+	}
+
+	return n
+}
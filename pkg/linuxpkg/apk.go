@@ -0,0 +1,75 @@
+package linuxpkg
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// buildAPK returns an Alpine package: the concatenated gzip streams of a
+// control tarball, without end-of-archive blocks, and of a data tarball,
+// so that together they read as one tarball.
+func buildAPK(info *Info, files []file) ([]byte, error) {
+	arch, err := Arch(APK, info.Arch, info.ARM)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := dataEntries(files, "")
+	for i, e := range entries {
+		if e.data != nil {
+			entries[i].pax = map[string]string{
+				"APK-TOOLS.checksum.SHA1": fmt.Sprintf("%x", sha1.Sum(e.data)),
+			}
+		}
+	}
+	data, err := tarGz(entries, info.Time, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkginfo bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&pkginfo, "%s = %s\n", name, value)
+		}
+	}
+	summary, _ := splitDescription(info)
+	pkginfo.WriteString("# Generated by gox\n")
+	field("pkgname", info.Name)
+	field("pkgver", Version(APK, info.Version)+"-r0")
+	field("pkgdesc", summary)
+	field("url", info.Homepage)
+	field("builddate", fmt.Sprint(info.Time.Unix()))
+	field("packager", info.Maintainer)
+	field("size", fmt.Sprint(installedSize(files)))
+	field("arch", arch)
+	field("origin", info.Name)
+	field("maintainer", info.Maintainer)
+	field("license", info.License)
+	for _, dep := range info.Depends {
+		field("depend", strings.Replace(dep, " ", "", -1))
+	}
+	field("datahash", fmt.Sprintf("%x", sha256.Sum256(data)))
+
+	control := []tarEntry{{name: ".PKGINFO", mode: 0644, data: pkginfo.Bytes()}}
+	scripts := []struct{ name, text string }{
+		{".pre-install", info.Scripts.PreInstall},
+		{".post-install", info.Scripts.PostInstall},
+		{".pre-deinstall", info.Scripts.PreRemove},
+		{".post-deinstall", info.Scripts.PostRemove},
+	}
+	for _, s := range scripts {
+		if s.text != "" {
+			control = append(control, tarEntry{name: s.name, mode: 0755, data: []byte(s.text)})
+		}
+	}
+	controlGz, err := tarGz(control, info.Time, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(controlGz, data...), nil
+}
@@ -0,0 +1,120 @@
+package linuxpkg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"strings"
+)
+
+// buildDeb returns a Debian binary package: an ar archive containing the
+// format version, the control files and the installed files.
+func buildDeb(info *Info, files []file) ([]byte, error) {
+	if info.Maintainer == "" {
+		return nil, fmt.Errorf("a deb needs a maintainer")
+	}
+	arch, err := Arch(Deb, info.Arch, info.ARM)
+	if err != nil {
+		return nil, err
+	}
+
+	dataFiles := append([]tarEntry{{name: "./", mode: 0755}}, dataEntries(files, "./")...)
+	data, err := tarGz(dataFiles, info.Time, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var md5sums, conffiles bytes.Buffer
+	for _, f := range files {
+		fmt.Fprintf(&md5sums, "%x  %s\n", md5.Sum(f.data), f.Dst[1:])
+		if f.Config {
+			fmt.Fprintf(&conffiles, "%s\n", f.Dst)
+		}
+	}
+
+	entries := []tarEntry{
+		{name: "./", mode: 0755},
+		{name: "./control", mode: 0644, data: debControl(info, arch, files)},
+		{name: "./md5sums", mode: 0644, data: md5sums.Bytes()},
+	}
+	if conffiles.Len() > 0 {
+		entries = append(entries, tarEntry{name: "./conffiles", mode: 0644, data: conffiles.Bytes()})
+	}
+	scripts := []struct{ name, text string }{
+		{"preinst", info.Scripts.PreInstall},
+		{"postinst", info.Scripts.PostInstall},
+		{"prerm", info.Scripts.PreRemove},
+		{"postrm", info.Scripts.PostRemove},
+	}
+	for _, s := range scripts {
+		if s.text != "" {
+			entries = append(entries, tarEntry{name: "./" + s.name, mode: 0755, data: []byte(s.text)})
+		}
+	}
+	control, err := tarGz(entries, info.Time, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", control},
+		{"data.tar.gz", data},
+	}
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n",
+			m.name, info.Time.Unix(), 0, 0, "100644", len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// debControl returns the control file of the package.
+func debControl(info *Info, arch string, files []file) []byte {
+	var buf bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\n", name, value)
+		}
+	}
+
+	field("Package", info.Name)
+	field("Version", Version(Deb, info.Version))
+	field("Architecture", arch)
+	field("Maintainer", info.Maintainer)
+	field("Installed-Size", fmt.Sprint((installedSize(files)+1023)/1024))
+	field("Depends", strings.Join(info.Depends, ", "))
+	field("Priority", "optional")
+	field("Homepage", info.Homepage)
+
+	summary, rest := splitDescription(info)
+	field("Description", summary)
+	for _, line := range rest {
+		if strings.TrimSpace(line) == "" {
+			line = "."
+		}
+		fmt.Fprintf(&buf, " %s\n", line)
+	}
+
+	return buf.Bytes()
+}
+
+// splitDescription returns the first line of the description of the
+// package, or its name, and the other lines.
+func splitDescription(info *Info) (string, []string) {
+	lines := strings.Split(strings.TrimSpace(info.Description), "\n")
+	if lines[0] == "" {
+		return info.Name, nil
+	}
+
+	return strings.TrimSpace(lines[0]), lines[1:]
+}
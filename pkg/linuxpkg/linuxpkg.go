@@ -0,0 +1,300 @@
+// Package linuxpkg builds .deb, .rpm and Alpine .apk packages installing
+// binaries built by gox along with extra files. Like archives, packages
+// are reproducible: files are sorted, owned by root and have fixed times.
+package linuxpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The supported formats, also used as the extension of the packages.
+const (
+	Deb = "deb"
+	RPM = "rpm"
+	APK = "apk"
+)
+
+// Formats are the supported formats.
+var Formats = []string{Deb, RPM, APK}
+
+// ValidFormat reports whether format is supported.
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Info describes a package.
+type Info struct {
+	Name        string
+	Version     string
+	Maintainer  string
+	Description string
+	Homepage    string
+	License     string
+	Vendor      string
+
+	// Arch and ARM are the GOARCH and GOARM the binaries are built for.
+	Arch string
+	ARM  string
+
+	// Depends are the names of the packages this one depends on, in the
+	// syntax of the format, like "libc6 (>= 2.28)" for a deb.
+	Depends []string
+
+	Files   []File
+	Scripts Scripts
+
+	// Time is the time of the files and of the build.
+	Time time.Time
+}
+
+// File is a file installed by a package.
+type File struct {
+	// Src is the file to read, Dst the absolute path it is installed at.
+	Src string
+	Dst string
+
+	// Mode is the permissions of the installed file, 0644 or 0755 for
+	// executables if zero.
+	Mode os.FileMode
+
+	// Config marks configuration files, which are kept on upgrades when
+	// they were changed.
+	Config bool
+}
+
+// Scripts are the shell scripts run by the package manager.
+type Scripts struct {
+	PreInstall  string
+	PostInstall string
+	PreRemove   string
+	PostRemove  string
+}
+
+// file is a File read into memory.
+type file struct {
+	File
+	data []byte
+}
+
+func (f *file) mode() int64 {
+	return int64(f.Mode.Perm())
+}
+
+// readFiles reads the files of the package, sorted by destination.
+func readFiles(files []File) ([]file, error) {
+	result := make([]file, 0, len(files))
+	for _, f := range files {
+		if !path.IsAbs(f.Dst) {
+			return nil, fmt.Errorf("the destination of %s must be an absolute path, not %q", f.Src, f.Dst)
+		}
+
+		info, err := os.Stat(f.Src)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(f.Src)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Mode == 0 {
+			f.Mode = 0644
+			if info.Mode()&0111 != 0 {
+				f.Mode = 0755
+			}
+		}
+		f.Dst = path.Clean(f.Dst)
+		result = append(result, file{File: f, data: data})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Dst < result[j].Dst })
+	for i := 1; i < len(result); i++ {
+		if result[i].Dst == result[i-1].Dst {
+			return nil, fmt.Errorf("%s is installed twice", result[i].Dst)
+		}
+	}
+
+	return result, nil
+}
+
+// dirs returns the parent directories of the files, sorted.
+func dirs(files []file) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, f := range files {
+		for dir := path.Dir(f.Dst); dir != "/"; dir = path.Dir(dir) {
+			if seen[dir] {
+				break
+			}
+			seen[dir] = true
+			result = append(result, dir)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// installedSize returns the size of the files.
+func installedSize(files []file) int64 {
+	var size int64
+	for _, f := range files {
+		size += int64(len(f.data))
+	}
+
+	return size
+}
+
+// Write writes the package in the given format to path.
+func Write(format, path string, info *Info) error {
+	files, err := readFiles(info.Files)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch format {
+	case Deb:
+		data, err = buildDeb(info, files)
+	case RPM:
+		data, err = buildRPM(info, files)
+	case APK:
+		data, err = buildAPK(info, files)
+	default:
+		err = fmt.Errorf("unknown package format %q, should be one of %s",
+			format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// FileName returns the conventional file name of the package.
+func FileName(format string, info *Info) (string, error) {
+	arch, err := Arch(format, info.Arch, info.ARM)
+	if err != nil {
+		return "", err
+	}
+	version := Version(format, info.Version)
+
+	switch format {
+	case RPM:
+		return fmt.Sprintf("%s-%s-1.%s.rpm", info.Name, version, arch), nil
+	case APK:
+		return fmt.Sprintf("%s_%s-r0_%s.apk", info.Name, version, arch), nil
+	}
+
+	return fmt.Sprintf("%s_%s_%s.deb", info.Name, version, arch), nil
+}
+
+// arches maps GOARCH to the architecture names of the formats. GOARCH arm
+// is handled by Arch, as it depends on GOARM.
+var arches = map[string]map[string]string{
+	Deb: {
+		"386":      "i386",
+		"amd64":    "amd64",
+		"arm64":    "arm64",
+		"loong64":  "loong64",
+		"mips":     "mips",
+		"mipsle":   "mipsel",
+		"mips64le": "mips64el",
+		"ppc64le":  "ppc64el",
+		"riscv64":  "riscv64",
+		"s390x":    "s390x",
+	},
+	RPM: {
+		"386":      "i386",
+		"amd64":    "x86_64",
+		"arm64":    "aarch64",
+		"loong64":  "loongarch64",
+		"mips":     "mips",
+		"mipsle":   "mipsel",
+		"mips64":   "mips64",
+		"mips64le": "mips64el",
+		"ppc64":    "ppc64",
+		"ppc64le":  "ppc64le",
+		"riscv64":  "riscv64",
+		"s390x":    "s390x",
+	},
+	APK: {
+		"386":     "x86",
+		"amd64":   "x86_64",
+		"arm64":   "aarch64",
+		"loong64": "loongarch64",
+		"ppc64le": "ppc64le",
+		"riscv64": "riscv64",
+		"s390x":   "s390x",
+	},
+}
+
+// armArches maps GOARM to the architecture names of the formats.
+var armArches = map[string]map[string]string{
+	Deb: {"5": "armel", "6": "armel", "7": "armhf"},
+	RPM: {"5": "armv5tel", "6": "armv6hl", "7": "armv7hl"},
+	APK: {"6": "armhf", "7": "armv7"},
+}
+
+// Arch returns the architecture name of the format for GOARCH goarch and,
+// for arm, GOARM goarm, which defaults to 7.
+func Arch(format, goarch, goarm string) (string, error) {
+	var arch string
+	if goarch == "arm" {
+		if goarm == "" {
+			goarm = "7"
+		}
+		arch = armArches[format][strings.SplitN(goarm, ",", 2)[0]]
+	} else {
+		arch = arches[format][goarch]
+	}
+
+	if arch == "" {
+		return "", fmt.Errorf("%s packages don't support the %s architecture", format, goarch)
+	}
+	return arch, nil
+}
+
+var (
+	numericVersion = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*`)
+	describeCount  = regexp.MustCompile(`^-([0-9]+)-g[0-9a-f]+`)
+	invalidChars   = regexp.MustCompile(`[^A-Za-z0-9.+~]+`)
+)
+
+// Version turns a version like the output of git describe, such as
+// "v1.2.0-3-g1a2b3c4d", into a version the format accepts that sorts
+// after the tagged version.
+func Version(format, version string) string {
+	version = strings.TrimPrefix(version, "v")
+	base := numericVersion.FindString(version)
+	rest := version[len(base):]
+	if base == "" {
+		base = "0.0.0"
+	}
+
+	if format == APK {
+		// apk only allows a few suffixes, like _p for patch levels.
+		if m := describeCount.FindStringSubmatch(rest); m != nil {
+			return base + "_p" + m[1]
+		}
+		return base
+	}
+
+	if rest == "" {
+		return base
+	}
+	return base + "+" + strings.Trim(invalidChars.ReplaceAllString(rest, "+"), "+")
+}
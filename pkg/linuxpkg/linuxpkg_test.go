@@ -0,0 +1,468 @@
+package linuxpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testInfo returns a package installing an executable and a configuration
+// file written to a temporary directory.
+func testInfo(t *testing.T) *Info {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "app")
+	if err := ioutil.WriteFile(bin, []byte("\x7fELF binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "app.yml")
+	if err := ioutil.WriteFile(conf, []byte("listen: :8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Info{
+		Name:        "app",
+		Version:     "v1.2.0-3-g1a2b3c4d",
+		Maintainer:  "Jane Doe <jane@example.com>",
+		Description: "An app\n\nThat does things.",
+		Homepage:    "https://example.com",
+		License:     "MIT",
+		Arch:        "amd64",
+		Depends:     []string{"ca-certificates"},
+		Files: []File{
+			{Src: bin, Dst: "/usr/bin/app"},
+			{Src: conf, Dst: "/etc/app/app.yml", Config: true},
+		},
+		Scripts: Scripts{PostInstall: "#!/bin/sh\necho installed\n"},
+		Time:    time.Unix(1700000000, 0),
+	}
+}
+
+// testFiles are the contents of the files of testInfo by path.
+var testFiles = map[string]string{
+	"usr/bin/app":     "\x7fELF binary",
+	"etc/app/app.yml": "listen: :8080\n",
+}
+
+func writePackage(t *testing.T, format string, info *Info) []byte {
+	out := filepath.Join(t.TempDir(), "app."+format)
+	if err := Write(format, out, info); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// readTar returns the headers and contents of the regular files of a
+// tarball, keyed by name without the leading "./".
+func readTar(t *testing.T, r io.Reader) (map[string]*tar.Header, map[string]string) {
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+		headers[name] = h
+		if h.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents[name] = string(data)
+		}
+	}
+	return headers, contents
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func checkFiles(t *testing.T, headers map[string]*tar.Header, contents map[string]string) {
+	for name, want := range testFiles {
+		if contents[name] != want {
+			t.Errorf("%s: got %q, want %q", name, contents[name], want)
+		}
+		if h := headers[name]; h != nil && (h.Uname != "root" || h.Gname != "root") {
+			t.Errorf("%s: owned by %s:%s", name, h.Uname, h.Gname)
+		}
+	}
+	if h := headers["usr/bin/app"]; h == nil || h.Mode != 0755 {
+		t.Errorf("usr/bin/app: bad header %+v", h)
+	}
+	if h := headers["etc/app/app.yml"]; h == nil || h.Mode != 0644 {
+		t.Errorf("etc/app/app.yml: bad header %+v", h)
+	}
+	if h := headers["usr/bin/"]; h == nil || h.Typeflag != tar.TypeDir {
+		t.Errorf("usr/bin/: missing directory")
+	}
+}
+
+func TestDeb(t *testing.T) {
+	data := writePackage(t, Deb, testInfo(t))
+
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		t.Fatalf("missing ar magic")
+	}
+	members := make(map[string][]byte)
+	var names []string
+	for rest := data[8:]; len(rest) > 0; {
+		if len(rest) < 60 || string(rest[58:60]) != "`\n" {
+			t.Fatalf("bad ar header %q", rest[:60])
+		}
+		name := strings.TrimSpace(string(rest[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(rest[48:58])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mtime := strings.TrimSpace(string(rest[16:28])); mtime != "1700000000" {
+			t.Errorf("%s: mtime %s", name, mtime)
+		}
+		members[name] = rest[60 : 60+size]
+		names = append(names, name)
+		rest = rest[60+size+size%2:]
+	}
+	if got := strings.Join(names, " "); got != "debian-binary control.tar.gz data.tar.gz" {
+		t.Fatalf("members: %s", got)
+	}
+	if string(members["debian-binary"]) != "2.0\n" {
+		t.Errorf("debian-binary: %q", members["debian-binary"])
+	}
+
+	_, control := readTar(t, bytes.NewReader(gunzip(t, members["control.tar.gz"])))
+	for _, want := range []string{
+		"Package: app\n",
+		"Version: 1.2.0+3+g1a2b3c4d\n",
+		"Architecture: amd64\n",
+		"Maintainer: Jane Doe <jane@example.com>\n",
+		"Depends: ca-certificates\n",
+		"Description: An app\n .\n That does things.\n",
+	} {
+		if !strings.Contains(control["control"], want) {
+			t.Errorf("control lacks %q:\n%s", want, control["control"])
+		}
+	}
+	if control["conffiles"] != "/etc/app/app.yml\n" {
+		t.Errorf("conffiles: %q", control["conffiles"])
+	}
+	if control["postinst"] == "" {
+		t.Errorf("missing postinst")
+	}
+
+	headers, contents := readTar(t, bytes.NewReader(gunzip(t, members["data.tar.gz"])))
+	checkFiles(t, headers, contents)
+
+	var md5sums []string
+	for _, name := range []string{"etc/app/app.yml", "usr/bin/app"} {
+		md5sums = append(md5sums, fmt.Sprintf("%x  %s\n", md5.Sum([]byte(contents[name])), name))
+	}
+	if got := control["md5sums"]; got != strings.Join(md5sums, "") {
+		t.Errorf("md5sums:\n%s", got)
+	}
+}
+
+func TestDebMaintainer(t *testing.T) {
+	info := testInfo(t)
+	info.Maintainer = ""
+
+	// dpkg-deb refuses a control file without a maintainer.
+	err := Write(Deb, filepath.Join(t.TempDir(), "app.deb"), info)
+	if err == nil || !strings.Contains(err.Error(), "maintainer") {
+		t.Errorf("got error %v, want a missing maintainer", err)
+	}
+
+	// The other formats don't need one.
+	for _, format := range []string{RPM, APK} {
+		writePackage(t, format, info)
+	}
+}
+
+// rpmParsed is a header read back from a package.
+type rpmParsed struct {
+	tags map[int32]rpmEntry
+	size int
+}
+
+// parseRPMHeader reads a header, checking its region entry and trailer.
+func parseRPMHeader(t *testing.T, data []byte, region int32) *rpmParsed {
+	if !bytes.HasPrefix(data, []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}) {
+		t.Fatalf("bad header magic % x", data[:8])
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	storeSize := int(binary.BigEndian.Uint32(data[12:]))
+	index := data[16 : 16+16*count]
+	store := data[16+16*count : 16+16*count+storeSize]
+
+	entry := func(i int) (int32, int32, int32, int32) {
+		e := index[16*i:]
+		return int32(binary.BigEndian.Uint32(e)), int32(binary.BigEndian.Uint32(e[4:])),
+			int32(binary.BigEndian.Uint32(e[8:])), int32(binary.BigEndian.Uint32(e[12:]))
+	}
+	tag, typ, offset, n := entry(0)
+	if tag != region || typ != rpmTypeBin || n != 16 || int(offset) != storeSize-16 {
+		t.Fatalf("bad region entry %d %d %d %d", tag, typ, offset, n)
+	}
+	trailer := store[offset:]
+	if int32(binary.BigEndian.Uint32(trailer)) != region ||
+		int32(binary.BigEndian.Uint32(trailer[8:])) != int32(-16*count) {
+		t.Fatalf("bad region trailer % x", trailer)
+	}
+
+	p := &rpmParsed{tags: make(map[int32]rpmEntry), size: 16 + 16*count + storeSize}
+	last := int32(0)
+	for i := 1; i < count; i++ {
+		tag, typ, offset, n := entry(i)
+		if tag <= last {
+			t.Errorf("tag %d after %d", tag, last)
+		}
+		last = tag
+
+		var size int
+		switch typ {
+		case rpmTypeInt16:
+			size = 2 * int(n)
+			if offset%2 != 0 {
+				t.Errorf("tag %d: misaligned int16", tag)
+			}
+		case rpmTypeInt32:
+			size = 4 * int(n)
+			if offset%4 != 0 {
+				t.Errorf("tag %d: misaligned int32", tag)
+			}
+		case rpmTypeBin:
+			size = int(n)
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			end := int(offset)
+			for j := int32(0); j < n; j++ {
+				end += bytes.IndexByte(store[end:], 0) + 1
+			}
+			size = end - int(offset)
+			if typ == rpmTypeString && n != 1 {
+				t.Errorf("tag %d: string with count %d", tag, n)
+			}
+		default:
+			t.Fatalf("tag %d: unknown type %d", tag, typ)
+		}
+		p.tags[tag] = rpmEntry{tag: tag, typ: typ, count: n, data: store[offset : int(offset)+size]}
+	}
+	return p
+}
+
+func (p *rpmParsed) strings(t *testing.T, tag int32) []string {
+	e, ok := p.tags[tag]
+	if !ok {
+		t.Fatalf("missing tag %d", tag)
+	}
+	return strings.Split(strings.TrimSuffix(string(e.data), "\x00"), "\x00")
+}
+
+func (p *rpmParsed) int32s(t *testing.T, tag int32) []int32 {
+	e, ok := p.tags[tag]
+	if !ok || e.typ != rpmTypeInt32 {
+		t.Fatalf("missing int32 tag %d", tag)
+	}
+	var values []int32
+	for i := 0; i < int(e.count); i++ {
+		values = append(values, int32(binary.BigEndian.Uint32(e.data[4*i:])))
+	}
+	return values
+}
+
+func TestRPM(t *testing.T) {
+	data := writePackage(t, RPM, testInfo(t))
+
+	if !bytes.HasPrefix(data, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0}) {
+		t.Fatalf("bad lead magic % x", data[:6])
+	}
+	if name := string(bytes.TrimRight(data[10:76], "\x00")); name != "app-1.2.0+3+g1a2b3c4d-1" {
+		t.Errorf("lead name %q", name)
+	}
+	if binary.BigEndian.Uint16(data[78:]) != 5 {
+		t.Errorf("lead signature type %d", binary.BigEndian.Uint16(data[78:]))
+	}
+
+	sig := parseRPMHeader(t, data[96:], rpmRegionSignatures)
+	headerStart := 96 + sig.size + (8-sig.size%8)%8
+	main := parseRPMHeader(t, data[headerStart:], rpmRegionImmutable)
+	header := data[headerStart : headerStart+main.size]
+	payload := data[headerStart+main.size:]
+
+	if got := sig.strings(t, rpmSigSHA256)[0]; got != fmt.Sprintf("%x", sha256.Sum256(header)) {
+		t.Errorf("header sha256 %s", got)
+	}
+	if got := sig.strings(t, rpmSigSHA1)[0]; got != fmt.Sprintf("%x", sha1.Sum(header)) {
+		t.Errorf("header sha1 %s", got)
+	}
+	if got := sig.int32s(t, rpmSigSize)[0]; int(got) != len(header)+len(payload) {
+		t.Errorf("size %d, want %d", got, len(header)+len(payload))
+	}
+	sum := md5.Sum(append(append([]byte(nil), header...), payload...))
+	if got := sig.tags[rpmSigMD5].data; !bytes.Equal(got, sum[:]) {
+		t.Errorf("md5 % x", got)
+	}
+
+	for tag, want := range map[int32]string{
+		rpmName:              "app",
+		rpmVersion:           "1.2.0+3+g1a2b3c4d",
+		rpmRelease:           "1",
+		rpmArch:              "x86_64",
+		rpmOS:                "linux",
+		rpmSummary:           "An app",
+		rpmLicense:           "MIT",
+		rpmPayloadFormat:     "cpio",
+		rpmPayloadCompressor: "gzip",
+		rpmPostInProg:        "/bin/sh",
+	} {
+		if got := main.strings(t, tag)[0]; got != want {
+			t.Errorf("tag %d: %q, want %q", tag, got, want)
+		}
+	}
+	if got := strings.Join(main.strings(t, rpmBaseNames), " "); got != "app.yml app" {
+		t.Errorf("basenames %s", got)
+	}
+	if got := strings.Join(main.strings(t, rpmDirNames), " "); got != "/etc/app/ /usr/bin/" {
+		t.Errorf("dirnames %s", got)
+	}
+	if got := main.int32s(t, rpmFileFlags); got[0] != rpmFileConfig|rpmFileNoReplace || got[1] != 0 {
+		t.Errorf("file flags %v", got)
+	}
+	if got := main.strings(t, rpmRequireName)[0]; got != "ca-certificates" {
+		t.Errorf("requires %s", got)
+	}
+
+	// The payload is a newc cpio archive of the files.
+	cpio := gunzip(t, payload)
+	if got := sig.int32s(t, rpmSigPayloadSize)[0]; int(got) != len(cpio) {
+		t.Errorf("payload size %d, want %d", got, len(cpio))
+	}
+	contents := make(map[string]string)
+	modes := make(map[string]int64)
+	digests := main.strings(t, rpmFileDigests)
+	for off := 0; ; {
+		h := string(cpio[off : off+110])
+		if h[:6] != "070701" {
+			t.Fatalf("bad cpio magic %q", h[:6])
+		}
+		field := func(i int) int64 {
+			v, err := strconv.ParseInt(h[6+8*i:14+8*i], 16, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		mode, size, nameSize := field(1), int(field(6)), int(field(11))
+		name := string(cpio[off+110 : off+110+nameSize-1])
+		off = align4(off + 110 + nameSize)
+		if name == "TRAILER!!!" {
+			break
+		}
+		contents[strings.TrimPrefix(name, "./")] = string(cpio[off : off+size])
+		modes[name] = mode
+		off = align4(off + size)
+	}
+	for name, want := range testFiles {
+		if contents[name] != want {
+			t.Errorf("%s: got %q, want %q", name, contents[name], want)
+		}
+	}
+	if modes["./usr/bin/app"] != 0100755 {
+		t.Errorf("./usr/bin/app mode %o", modes["./usr/bin/app"])
+	}
+	if digests[1] != fmt.Sprintf("%x", sha256.Sum256([]byte(testFiles["usr/bin/app"]))) {
+		t.Errorf("file digests %v", digests)
+	}
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func TestAPK(t *testing.T) {
+	data := writePackage(t, APK, testInfo(t))
+
+	// The control stream comes first: reading it from a bytes.Reader
+	// leaves the reader at the start of the data stream.
+	r := bytes.NewReader(data)
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Multistream(false)
+	controlTar, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataStream := data[len(data)-r.Len():]
+
+	// The control tarball has no end-of-archive blocks, so that the
+	// streams read as a single tarball.
+	if bytes.HasSuffix(controlTar, make([]byte, 1024)) {
+		t.Errorf("control tarball has a trailer")
+	}
+	_, control := readTar(t, bytes.NewReader(controlTar))
+	pkginfo := control[".PKGINFO"]
+	for _, want := range []string{
+		"pkgname = app\n",
+		"pkgver = 1.2.0_p3-r0\n",
+		"arch = x86_64\n",
+		"depend = ca-certificates\n",
+		fmt.Sprintf("datahash = %x\n", sha256.Sum256(dataStream)),
+	} {
+		if !strings.Contains(pkginfo, want) {
+			t.Errorf(".PKGINFO lacks %q:\n%s", want, pkginfo)
+		}
+	}
+	if control[".post-install"] == "" {
+		t.Errorf("missing .post-install")
+	}
+
+	headers, contents := readTar(t, bytes.NewReader(gunzip(t, dataStream)))
+	checkFiles(t, headers, contents)
+	for name, content := range contents {
+		want := fmt.Sprintf("%x", sha1.Sum([]byte(content)))
+		if got := headers[name].PAXRecords["APK-TOOLS.checksum.SHA1"]; got != want {
+			t.Errorf("%s: checksum %q, want %q", name, got, want)
+		}
+	}
+
+	all, _ := readTar(t, gunzipAll(t, data))
+	if all[".PKGINFO"] == nil || all["usr/bin/app"] == nil {
+		t.Errorf("the streams don't read as one tarball")
+	}
+}
+
+func gunzipAll(t *testing.T, data []byte) io.Reader {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gz
+}
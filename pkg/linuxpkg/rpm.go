@@ -0,0 +1,400 @@
+package linuxpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Header tags, types and flags, see rpmtag.h and rpmds.h in rpm.
+const (
+	rpmRegionSignatures = 62
+	rpmRegionImmutable  = 63
+	rpmI18NTable        = 100
+
+	rpmSigSHA1        = 269
+	rpmSigSHA256      = 273
+	rpmSigSize        = 1000
+	rpmSigMD5         = 1004
+	rpmSigPayloadSize = 1007
+
+	rpmName              = 1000
+	rpmVersion           = 1001
+	rpmRelease           = 1002
+	rpmSummary           = 1004
+	rpmDescription       = 1005
+	rpmBuildTime         = 1006
+	rpmSize              = 1009
+	rpmVendor            = 1011
+	rpmLicense           = 1014
+	rpmPackager          = 1015
+	rpmGroup             = 1016
+	rpmURL               = 1020
+	rpmOS                = 1021
+	rpmArch              = 1022
+	rpmPreIn             = 1023
+	rpmPostIn            = 1024
+	rpmPreUn             = 1025
+	rpmPostUn            = 1026
+	rpmFileSizes         = 1028
+	rpmFileModes         = 1030
+	rpmFileRdevs         = 1033
+	rpmFileMtimes        = 1034
+	rpmFileDigests       = 1035
+	rpmFileLinkTos       = 1036
+	rpmFileFlags         = 1037
+	rpmFileUserName      = 1039
+	rpmFileGroupName     = 1040
+	rpmSourceRPM         = 1044
+	rpmProvideName       = 1047
+	rpmRequireFlags      = 1048
+	rpmRequireName       = 1049
+	rpmRequireVersion    = 1050
+	rpmPreInProg         = 1085
+	rpmPostInProg        = 1086
+	rpmPreUnProg         = 1087
+	rpmPostUnProg        = 1088
+	rpmFileDevices       = 1095
+	rpmFileInodes        = 1096
+	rpmFileLangs         = 1097
+	rpmProvideFlags      = 1112
+	rpmProvideVersion    = 1113
+	rpmDirIndexes        = 1116
+	rpmBaseNames         = 1117
+	rpmDirNames          = 1118
+	rpmPayloadFormat     = 1124
+	rpmPayloadCompressor = 1125
+	rpmPayloadFlags      = 1126
+	rpmFileDigestAlgo    = 5011
+
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+
+	rpmSenseLess    = 0x2
+	rpmSenseGreater = 0x4
+	rpmSenseEqual   = 0x8
+	rpmSenseRPMLib  = 0x1000000
+
+	rpmFileConfig    = 0x1
+	rpmFileNoReplace = 0x10
+
+	rpmDigestSHA256 = 8
+)
+
+// rpmReleaseNumber is the release of the packages, as gox builds each version
+// only once.
+const rpmReleaseNumber = "1"
+
+// buildRPM returns an RPM package: a lead, a signature header with the
+// digests of the main header and payload, the main header and a gzipped
+// cpio archive of the files.
+func buildRPM(info *Info, files []file) ([]byte, error) {
+	arch, err := Arch(RPM, info.Arch, info.ARM)
+	if err != nil {
+		return nil, err
+	}
+	version := Version(RPM, info.Version)
+
+	cpio := rpmCpio(info, files)
+	var payload bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&payload, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gz.Write(cpio); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	h := &rpmHeader{}
+	h.addStrings(rpmI18NTable, rpmTypeStringArray, "C")
+	h.addStrings(rpmName, rpmTypeString, info.Name)
+	h.addStrings(rpmVersion, rpmTypeString, version)
+	h.addStrings(rpmRelease, rpmTypeString, rpmReleaseNumber)
+	summary, rest := splitDescription(info)
+	h.addStrings(rpmSummary, rpmTypeI18NString, summary)
+	h.addStrings(rpmDescription, rpmTypeI18NString, strings.TrimSpace(summary+"\n"+strings.Join(rest, "\n")))
+	h.addInt32(rpmBuildTime, int32(info.Time.Unix()))
+	h.addInt32(rpmSize, int32(installedSize(files)))
+	h.addOptional(rpmVendor, info.Vendor)
+	h.addOptional(rpmLicense, info.License)
+	h.addOptional(rpmPackager, info.Maintainer)
+	h.addStrings(rpmGroup, rpmTypeI18NString, "Unspecified")
+	h.addOptional(rpmURL, info.Homepage)
+	h.addStrings(rpmOS, rpmTypeString, "linux")
+	h.addStrings(rpmArch, rpmTypeString, arch)
+	h.addStrings(rpmSourceRPM, rpmTypeString, fmt.Sprintf("%s-%s-%s.src.rpm", info.Name, version, rpmReleaseNumber))
+
+	scripts := []struct {
+		tag, prog int32
+		text      string
+	}{
+		{rpmPreIn, rpmPreInProg, info.Scripts.PreInstall},
+		{rpmPostIn, rpmPostInProg, info.Scripts.PostInstall},
+		{rpmPreUn, rpmPreUnProg, info.Scripts.PreRemove},
+		{rpmPostUn, rpmPostUnProg, info.Scripts.PostRemove},
+	}
+	for _, s := range scripts {
+		if s.text != "" {
+			h.addStrings(s.tag, rpmTypeString, s.text)
+			h.addStrings(s.prog, rpmTypeString, "/bin/sh")
+		}
+	}
+
+	h.addStrings(rpmProvideName, rpmTypeStringArray, info.Name)
+	h.addInt32(rpmProvideFlags, rpmSenseEqual)
+	h.addStrings(rpmProvideVersion, rpmTypeStringArray, version+"-"+rpmReleaseNumber)
+
+	var reqNames, reqVersions []string
+	var reqFlags []int32
+	for _, dep := range info.Depends {
+		name, flags, version, err := rpmDependency(dep)
+		if err != nil {
+			return nil, err
+		}
+		reqNames = append(reqNames, name)
+		reqFlags = append(reqFlags, flags)
+		reqVersions = append(reqVersions, version)
+	}
+	rpmlib := []struct{ name, version string }{
+		{"rpmlib(CompressedFileNames)", "3.0.4-1"},
+		{"rpmlib(FileDigests)", "4.6.0-1"},
+		{"rpmlib(PayloadFilesHavePrefix)", "4.0-1"},
+	}
+	for _, r := range rpmlib {
+		reqNames = append(reqNames, r.name)
+		reqFlags = append(reqFlags, rpmSenseRPMLib|rpmSenseLess|rpmSenseEqual)
+		reqVersions = append(reqVersions, r.version)
+	}
+	h.addStrings(rpmRequireName, rpmTypeStringArray, reqNames...)
+	h.addInt32(rpmRequireFlags, reqFlags...)
+	h.addStrings(rpmRequireVersion, rpmTypeStringArray, reqVersions...)
+
+	if len(files) > 0 {
+		var dirNames []string
+		dirIndex := make(map[string]int32)
+		var (
+			sizes, mtimes, flags, devices, inodes, indexes []int32
+			modes, rdevs                                   []int16
+			digests, linkTos, users, groups, langs, bases  []string
+		)
+		for i, f := range files {
+			dir := path.Dir(f.Dst) + "/"
+			if _, ok := dirIndex[dir]; !ok {
+				dirIndex[dir] = int32(len(dirNames))
+				dirNames = append(dirNames, dir)
+			}
+
+			sizes = append(sizes, int32(len(f.data)))
+			mtimes = append(mtimes, int32(info.Time.Unix()))
+			var flag int32
+			if f.Config {
+				flag = rpmFileConfig | rpmFileNoReplace
+			}
+			flags = append(flags, flag)
+			devices = append(devices, 1)
+			inodes = append(inodes, int32(i+1))
+			indexes = append(indexes, dirIndex[dir])
+			modes = append(modes, int16(0100000|f.mode()))
+			rdevs = append(rdevs, 0)
+			digests = append(digests, fmt.Sprintf("%x", sha256.Sum256(f.data)))
+			linkTos = append(linkTos, "")
+			users = append(users, "root")
+			groups = append(groups, "root")
+			langs = append(langs, "")
+			bases = append(bases, path.Base(f.Dst))
+		}
+
+		h.addInt32(rpmFileSizes, sizes...)
+		h.addInt16(rpmFileModes, modes...)
+		h.addInt16(rpmFileRdevs, rdevs...)
+		h.addInt32(rpmFileMtimes, mtimes...)
+		h.addStrings(rpmFileDigests, rpmTypeStringArray, digests...)
+		h.addStrings(rpmFileLinkTos, rpmTypeStringArray, linkTos...)
+		h.addInt32(rpmFileFlags, flags...)
+		h.addStrings(rpmFileUserName, rpmTypeStringArray, users...)
+		h.addStrings(rpmFileGroupName, rpmTypeStringArray, groups...)
+		h.addInt32(rpmFileDevices, devices...)
+		h.addInt32(rpmFileInodes, inodes...)
+		h.addStrings(rpmFileLangs, rpmTypeStringArray, langs...)
+		h.addInt32(rpmDirIndexes, indexes...)
+		h.addStrings(rpmBaseNames, rpmTypeStringArray, bases...)
+		h.addStrings(rpmDirNames, rpmTypeStringArray, dirNames...)
+		h.addInt32(rpmFileDigestAlgo, rpmDigestSHA256)
+	}
+
+	h.addStrings(rpmPayloadFormat, rpmTypeString, "cpio")
+	h.addStrings(rpmPayloadCompressor, rpmTypeString, "gzip")
+	h.addStrings(rpmPayloadFlags, rpmTypeString, "9")
+	header := h.bytes(rpmRegionImmutable)
+
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(payload.Bytes())
+	sig := &rpmHeader{}
+	sig.addStrings(rpmSigSHA1, rpmTypeString, fmt.Sprintf("%x", sha1.Sum(header)))
+	sig.addStrings(rpmSigSHA256, rpmTypeString, fmt.Sprintf("%x", sha256.Sum256(header)))
+	sig.addInt32(rpmSigSize, int32(len(header)+payload.Len()))
+	sig.add(rpmSigMD5, rpmTypeBin, md5.Size, md5sum.Sum(nil))
+	sig.addInt32(rpmSigPayloadSize, int32(len(cpio)))
+	signature := sig.bytes(rpmRegionSignatures)
+
+	var buf bytes.Buffer
+	buf.Write(rpmLead(fmt.Sprintf("%s-%s-%s", info.Name, version, rpmReleaseNumber)))
+	buf.Write(signature)
+	buf.Write(make([]byte, (8-len(signature)%8)%8))
+	buf.Write(header)
+	buf.Write(payload.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+// rpmLead returns the obsolete lead of the package, still checked by rpm.
+func rpmLead(name string) []byte {
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	binary.BigEndian.PutUint16(lead[6:], 0) // binary package
+	binary.BigEndian.PutUint16(lead[8:], 0) // architecture, unused
+	copy(lead[10:75], name)
+	binary.BigEndian.PutUint16(lead[76:], 1) // linux
+	binary.BigEndian.PutUint16(lead[78:], 5) // header-style signature
+
+	return lead
+}
+
+// rpmDependency parses a dependency like "name" or "name >= version".
+func rpmDependency(dep string) (string, int32, string, error) {
+	fields := strings.Fields(dep)
+	if len(fields) == 1 {
+		return fields[0], 0, "", nil
+	}
+
+	operators := map[string]int32{
+		"<":  rpmSenseLess,
+		"<=": rpmSenseLess | rpmSenseEqual,
+		"=":  rpmSenseEqual,
+		">=": rpmSenseGreater | rpmSenseEqual,
+		">":  rpmSenseGreater,
+	}
+	if len(fields) == 3 {
+		if flags, ok := operators[fields[1]]; ok {
+			return fields[0], flags, fields[2], nil
+		}
+	}
+
+	return "", 0, "", fmt.Errorf("invalid rpm dependency %q, should be like \"name\" or \"name >= version\"", dep)
+}
+
+// rpmCpio returns the payload: a cpio archive in the SVR4 "newc" format
+// of the files, with paths starting with "./".
+func rpmCpio(info *Info, files []file) []byte {
+	var buf bytes.Buffer
+	entry := func(ino int, name string, mode int64, data []byte) {
+		fmt.Fprintf(&buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			ino, mode, 0, 0, 1, info.Time.Unix(), len(data), 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		buf.Write(make([]byte, (4-buf.Len()%4)%4))
+		buf.Write(data)
+		buf.Write(make([]byte, (4-buf.Len()%4)%4))
+	}
+
+	for i, f := range files {
+		entry(i+1, "."+f.Dst, 0100000|f.mode(), f.data)
+	}
+	entry(0, "TRAILER!!!", 0, nil)
+
+	return buf.Bytes()
+}
+
+// rpmHeader is a header of an RPM package, a sorted list of tags.
+type rpmHeader struct {
+	entries []rpmEntry
+}
+
+type rpmEntry struct {
+	tag, typ, count int32
+	data            []byte
+}
+
+func (h *rpmHeader) add(tag, typ int32, count int, data []byte) {
+	h.entries = append(h.entries, rpmEntry{tag: tag, typ: typ, count: int32(count), data: data})
+}
+
+func (h *rpmHeader) addStrings(tag, typ int32, values ...string) {
+	var data []byte
+	for _, v := range values {
+		data = append(data, v...)
+		data = append(data, 0)
+	}
+	h.add(tag, typ, len(values), data)
+}
+
+// addOptional adds a string unless it's empty.
+func (h *rpmHeader) addOptional(tag int32, value string) {
+	if value != "" {
+		h.addStrings(tag, rpmTypeString, value)
+	}
+}
+
+func (h *rpmHeader) addInt32(tag int32, values ...int32) {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(v))
+	}
+	h.add(tag, rpmTypeInt32, len(values), data)
+}
+
+func (h *rpmHeader) addInt16(tag int32, values ...int16) {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	h.add(tag, rpmTypeInt16, len(values), data)
+}
+
+// bytes returns the header, with its entries in an immutable region.
+func (h *rpmHeader) bytes(region int32) []byte {
+	entries := append([]rpmEntry(nil), h.entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	alignment := map[int32]int{rpmTypeInt16: 2, rpmTypeInt32: 4}
+	var store bytes.Buffer
+	var index bytes.Buffer
+	for _, e := range entries {
+		if a := alignment[e.typ]; a > 0 {
+			store.Write(make([]byte, (a-store.Len()%a)%a))
+		}
+		binary.Write(&index, binary.BigEndian, []int32{e.tag, e.typ, int32(store.Len()), e.count})
+		store.Write(e.data)
+	}
+
+	// The region tag is the first entry, pointing at a trailer at the end
+	// of the data holding the (negative) size of the index of the region.
+	count := int32(len(entries) + 1)
+	var regionEntry bytes.Buffer
+	binary.Write(&regionEntry, binary.BigEndian, []int32{region, rpmTypeBin, int32(store.Len()), 16})
+	binary.Write(&store, binary.BigEndian, []int32{region, rpmTypeBin, -16 * count, 16})
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(&buf, binary.BigEndian, []int32{count, int32(store.Len())})
+	buf.Write(regionEntry.Bytes())
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+
+	return buf.Bytes()
+}
@@ -0,0 +1,90 @@
+package linuxpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"time"
+)
+
+// tarEntry is a file or, when data is nil, a directory in a tarball.
+type tarEntry struct {
+	name string
+	mode int64
+	data []byte
+	pax  map[string]string
+}
+
+// tarGz returns a gzipped tarball of the entries, owned by root. Without
+// trailer the end-of-archive blocks are left out, for tarballs that are
+// concatenated with another one.
+func tarGz(entries []tarEntry, mtime time.Time, trailer bool) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:       e.name,
+			Mode:       e.mode,
+			Size:       int64(len(e.data)),
+			ModTime:    mtime,
+			Typeflag:   tar.TypeReg,
+			Uname:      "root",
+			Gname:      "root",
+			PAXRecords: e.pax,
+		}
+		if e.data == nil {
+			header.Typeflag = tar.TypeDir
+		}
+		if e.pax != nil {
+			header.Format = tar.FormatPAX
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if trailer {
+		if err := tw.Close(); err != nil {
+			return nil, err
+		}
+	} else if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := gz.Write(tarBuf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// dataEntries returns the entries of the directories and files, with the
+// paths relative to the root directory under prefix.
+func dataEntries(files []file, prefix string) []tarEntry {
+	var entries []tarEntry
+	for _, dir := range dirs(files) {
+		entries = append(entries, tarEntry{name: prefix + dir[1:] + "/", mode: 0755})
+	}
+	for _, f := range files {
+		data := f.data
+		if data == nil {
+			data = []byte{}
+		}
+		entries = append(entries, tarEntry{name: prefix + f.Dst[1:], mode: f.mode(), data: data})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
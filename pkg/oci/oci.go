@@ -0,0 +1,632 @@
+// Package oci assembles multi-platform container images in the OCI image
+// layout, a directory or tarball that tools like skopeo, podman and crane
+// load, without a container daemon or network access. The binaries and
+// extra files are added as a single layer on top of an optional base
+// image read from an image layout on disk.
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Media types of the OCI image specification.
+const (
+	MediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// refNameAnnotation names the images of the index of a layout.
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// Image describes the image to assemble.
+type Image struct {
+	// Base is the path of the image layout of the base image, optionally
+	// followed by ":" and the name of the image in it, or empty to start
+	// from scratch.
+	Base string
+
+	// Tag names the image in the layout.
+	Tag string
+
+	// The settings of the containers, on top of those of the base image.
+	Entrypoint []string
+	Cmd        []string
+	Env        []string
+	User       string
+	WorkingDir string
+	Labels     map[string]string
+
+	// Created is the creation time of the image and the time of the files.
+	Created time.Time
+}
+
+// Platform is a platform of the image with the files added for it.
+type Platform struct {
+	OS      string
+	Arch    string
+	Variant string
+
+	Files []File
+}
+
+// File is a file added to the image.
+type File struct {
+	// Src is the file to read, Dst the absolute path in the image.
+	Src string
+	Dst string
+}
+
+// Descriptor points at a blob of the layout.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *DescPlatform     `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// DescPlatform is the platform of a manifest in an index.
+type DescPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Index is an image index, listing manifests.
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest is the manifest of an image for one platform.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Config is the configuration of an image for one platform, with the
+// fields of the OCI image specification.
+type Config struct {
+	Created      string          `json:"created,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Variant      string          `json:"variant,omitempty"`
+	Config       ContainerConfig `json:"config"`
+	RootFS       RootFS          `json:"rootfs"`
+	History      []History       `json:"history,omitempty"`
+}
+
+// ContainerConfig holds the settings of the containers run from an image.
+type ContainerConfig struct {
+	User         string                     `json:"User,omitempty"`
+	ExposedPorts map[string]json.RawMessage `json:"ExposedPorts,omitempty"`
+	Env          []string                   `json:"Env,omitempty"`
+	Entrypoint   []string                   `json:"Entrypoint,omitempty"`
+	Cmd          []string                   `json:"Cmd,omitempty"`
+	Volumes      map[string]json.RawMessage `json:"Volumes,omitempty"`
+	WorkingDir   string                     `json:"WorkingDir,omitempty"`
+	Labels       map[string]string          `json:"Labels,omitempty"`
+	StopSignal   string                     `json:"StopSignal,omitempty"`
+}
+
+// RootFS lists the digests of the uncompressed layers.
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// History describes how a layer was made.
+type History struct {
+	Created    string `json:"created,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	EmptyLayer bool   `json:"empty_layer,omitempty"`
+}
+
+// defaultPath is the PATH of images built from scratch.
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Write writes the image for the platforms to an image layout at path,
+// a directory, or a tarball if path ends with ".tar". An existing layout
+// at path is replaced.
+func Write(path string, image *Image, platforms []Platform) error {
+	l := newLayout()
+
+	var base *layout
+	baseRef := ""
+	if image.Base != "" {
+		var err error
+		var basePath string
+		basePath, baseRef = SplitRef(image.Base)
+		if base, err = readLayout(basePath); err != nil {
+			return fmt.Errorf("base image: %s", err)
+		}
+	}
+
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeIndex}
+	for _, p := range platforms {
+		desc, err := l.addImage(image, &p, base, baseRef)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %s", p.OS, p.Arch, err)
+		}
+		index.Manifests = append(index.Manifests, *desc)
+	}
+
+	desc, err := l.addJSON(MediaTypeIndex, index)
+	if err != nil {
+		return err
+	}
+	desc.Annotations = map[string]string{refNameAnnotation: image.Tag}
+	top := Index{SchemaVersion: 2, MediaType: MediaTypeIndex, Manifests: []Descriptor{*desc}}
+	data, err := json.Marshal(top)
+	if err != nil {
+		return err
+	}
+	l.files["index.json"] = data
+	l.files["oci-layout"] = []byte(`{"imageLayoutVersion":"1.0.0"}`)
+
+	return l.write(path, image.Created)
+}
+
+// SplitRef splits the path of a layout, like in Image.Base, from the name
+// of an image in it.
+func SplitRef(s string) (string, string) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 || strings.ContainsAny(s[i:], `/\`) {
+		return s, ""
+	}
+
+	return s[:i], s[i+1:]
+}
+
+// addImage adds the image of the platform, returning the descriptor of
+// its manifest.
+func (l *layout) addImage(image *Image, p *Platform, base *layout, baseRef string) (*Descriptor, error) {
+	created := image.Created.UTC().Format(time.RFC3339)
+	config := Config{
+		Created:      created,
+		Architecture: p.Arch,
+		OS:           p.OS,
+		Variant:      p.Variant,
+		Config:       ContainerConfig{Env: []string{defaultPath}},
+		RootFS:       RootFS{Type: "layers"},
+	}
+	manifest := Manifest{SchemaVersion: 2, MediaType: MediaTypeManifest}
+
+	if base != nil {
+		baseManifest, baseConfig, err := base.find(baseRef, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range baseManifest.Layers {
+			data, err := base.blob(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			l.files[blobPath(layer.Digest)] = data
+			manifest.Layers = append(manifest.Layers, Descriptor{
+				MediaType: layer.MediaType, Digest: layer.Digest, Size: layer.Size,
+			})
+		}
+		config.Config = baseConfig.Config
+		config.RootFS = baseConfig.RootFS
+		config.History = baseConfig.History
+	}
+
+	layer, diffID, err := buildLayer(p.Files, image.Created)
+	if err != nil {
+		return nil, err
+	}
+	desc := l.addBlob(MediaTypeLayer, layer)
+	manifest.Layers = append(manifest.Layers, *desc)
+	config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	config.History = append(config.History, History{Created: created, CreatedBy: "gox"})
+
+	c := &config.Config
+	c.Env = mergeEnv(c.Env, image.Env)
+	if len(image.Entrypoint) > 0 {
+		// The arguments of the base image's entrypoint don't apply to
+		// this one.
+		c.Entrypoint = image.Entrypoint
+		c.Cmd = nil
+	}
+	if len(image.Cmd) > 0 {
+		c.Cmd = image.Cmd
+	}
+	if image.User != "" {
+		c.User = image.User
+	}
+	if image.WorkingDir != "" {
+		c.WorkingDir = image.WorkingDir
+	}
+	for name, value := range image.Labels {
+		if c.Labels == nil {
+			c.Labels = make(map[string]string)
+		}
+		c.Labels[name] = value
+	}
+
+	configDesc, err := l.addJSON(MediaTypeConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Config = *configDesc
+
+	desc, err = l.addJSON(MediaTypeManifest, manifest)
+	if err != nil {
+		return nil, err
+	}
+	desc.Platform = &DescPlatform{Architecture: p.Arch, OS: p.OS, Variant: p.Variant}
+	return desc, nil
+}
+
+// mergeEnv returns the variables of env overridden by those of overrides.
+func mergeEnv(env, overrides []string) []string {
+	result := append([]string(nil), env...)
+	for _, o := range overrides {
+		name := strings.SplitN(o, "=", 2)[0]
+		replaced := false
+		for i, e := range result {
+			if strings.SplitN(e, "=", 2)[0] == name {
+				result[i] = o
+				replaced = true
+			}
+		}
+		if !replaced {
+			result = append(result, o)
+		}
+	}
+
+	return result
+}
+
+// buildLayer returns a gzipped tarball of the files, with their parent
+// directories, and the digest of the uncompressed tarball.
+func buildLayer(files []File, mtime time.Time) ([]byte, string, error) {
+	type entry struct {
+		name string
+		src  string
+	}
+	var entries []entry
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if !path.IsAbs(f.Dst) {
+			return nil, "", fmt.Errorf("the destination of %s must be an absolute path, not %q", f.Src, f.Dst)
+		}
+		name := path.Clean(f.Dst)[1:]
+		if seen[name] {
+			return nil, "", fmt.Errorf("/%s is added twice", name)
+		}
+		seen[name] = true
+		entries = append(entries, entry{name: name, src: f.Src})
+
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if !seen[dir+"/"] {
+				seen[dir+"/"] = true
+				entries = append(entries, entry{name: dir + "/"})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	var uncompressed bytes.Buffer
+	tw := tar.NewWriter(&uncompressed)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Mode:     0755,
+			ModTime:  mtime,
+			Typeflag: tar.TypeDir,
+			Format:   tar.FormatPAX,
+		}
+		var data []byte
+		if e.src != "" {
+			info, err := os.Stat(e.src)
+			if err != nil {
+				return nil, "", err
+			}
+			if data, err = ioutil.ReadFile(e.src); err != nil {
+				return nil, "", err
+			}
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(data))
+			if info.Mode()&0111 == 0 {
+				header.Mode = 0644
+			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, "", err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(uncompressed.Bytes()); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return compressed.Bytes(), digest(uncompressed.Bytes()), nil
+}
+
+// digest returns the digest of data, as used in descriptors.
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// blobPath returns the path of a blob in a layout.
+func blobPath(digest string) string {
+	return path.Join("blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+// layout is an image layout, its files held in memory.
+type layout struct {
+	dir   string
+	files map[string][]byte
+}
+
+func newLayout() *layout {
+	return &layout{files: make(map[string][]byte)}
+}
+
+// addBlob adds a blob, returning its descriptor.
+func (l *layout) addBlob(mediaType string, data []byte) *Descriptor {
+	desc := &Descriptor{MediaType: mediaType, Digest: digest(data), Size: int64(len(data))}
+	l.files[blobPath(desc.Digest)] = data
+
+	return desc
+}
+
+// addJSON adds v as a JSON blob, returning its descriptor.
+func (l *layout) addJSON(mediaType string, v interface{}) (*Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.addBlob(mediaType, data), nil
+}
+
+// write writes the layout to path, a directory, or a tarball if path ends
+// with ".tar", replacing the layout that may be there.
+func (l *layout) write(path string, mtime time.Time) error {
+	if err := CheckPath(path); err != nil {
+		return err
+	}
+	tarball := strings.HasSuffix(path, ".tar")
+	if !tarball {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(l.files))
+	for name := range l.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !tarball {
+		for _, name := range names {
+			file := filepath.Join(path, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(file, l.files[name], 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(f)
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		header := &tar.Header{Name: dir, Mode: 0755, ModTime: mtime, Typeflag: tar.TypeDir}
+		if err := tw.WriteHeader(header); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(l.files[name])), ModTime: mtime}
+		if err := tw.WriteHeader(header); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := tw.Write(l.files[name]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// CheckPath checks that an image layout can be written to path, replacing
+// what is there only if it's a layout directory or, for a tarball, a file.
+func CheckPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	_, err = os.Stat(filepath.Join(path, "oci-layout"))
+	if strings.HasSuffix(path, ".tar") && !info.Mode().IsRegular() ||
+		!strings.HasSuffix(path, ".tar") && (!info.IsDir() || err != nil) {
+		return fmt.Errorf("%s exists and isn't an image layout, not replacing it", path)
+	}
+
+	return nil
+}
+
+// readLayout opens the image layout at dir, a directory or tarball.
+func readLayout(dir string) (*layout, error) {
+	l := newLayout()
+	l.dir = dir
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		f, err := os.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		tr := tar.NewReader(f)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", dir, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			l.files[path.Clean(header.Name)] = data
+		}
+	}
+
+	if _, err := l.file("oci-layout"); err != nil {
+		return nil, fmt.Errorf("%s is not an image layout: %s", dir, err)
+	}
+	return l, nil
+}
+
+// file returns the contents of a file of a layout being read.
+func (l *layout) file(name string) ([]byte, error) {
+	if data, ok := l.files[name]; ok {
+		return data, nil
+	}
+	if info, err := os.Stat(l.dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%s not found in %s", name, l.dir)
+	}
+
+	return ioutil.ReadFile(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+// blob returns a blob of a layout being read, checking its digest.
+func (l *layout) blob(d string) ([]byte, error) {
+	data, err := l.file(blobPath(d))
+	if err != nil {
+		return nil, err
+	}
+	if digest(data) != d {
+		return nil, fmt.Errorf("blob %s has the wrong digest", d)
+	}
+
+	return data, nil
+}
+
+// find returns the manifest and configuration of the image named ref, or
+// of the only image, of a layout being read for the platform.
+func (l *layout) find(ref string, p *Platform) (*Manifest, *Config, error) {
+	data, err := l.file("index.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, nil, fmt.Errorf("index.json: %s", err)
+	}
+
+	var images []Descriptor
+	for _, desc := range index.Manifests {
+		if ref == "" || desc.Annotations[refNameAnnotation] == ref {
+			images = append(images, desc)
+		}
+	}
+	if len(images) != 1 {
+		return nil, nil, fmt.Errorf("%d images named %q in %s, expected one", len(images), ref, l.dir)
+	}
+
+	return l.findPlatform(images[0], p)
+}
+
+// findPlatform returns the image for the platform in desc, a manifest or
+// an index.
+func (l *layout) findPlatform(desc Descriptor, p *Platform) (*Manifest, *Config, error) {
+	data, err := l.blob(desc.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch desc.MediaType {
+	case MediaTypeIndex, "application/vnd.docker.distribution.manifest.list.v2+json":
+		var index Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, nil, err
+		}
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == p.OS && m.Platform.Architecture == p.Arch &&
+				(m.Platform.Variant == "" || p.Variant == "" || m.Platform.Variant == p.Variant) {
+				return l.findPlatform(m, p)
+			}
+		}
+		return nil, nil, fmt.Errorf("the base image has no %s/%s image", p.OS, p.Arch)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, err
+	}
+	data, err = l.blob(manifest.Config.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+	if config.OS != p.OS || config.Architecture != p.Arch {
+		return nil, nil, fmt.Errorf("the base image is for %s/%s, not %s/%s",
+			config.OS, config.Architecture, p.OS, p.Arch)
+	}
+
+	return &manifest, &config, nil
+}
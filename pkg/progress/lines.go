@@ -0,0 +1,47 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// lines prints a line per job when it starts, which is all that can be
+// done when the output isn't a terminal.
+type lines struct {
+	mu   sync.Mutex
+	w    io.Writer
+	jobs []Job
+}
+
+// NewLines returns a reporter that prints "--> os/arch: name" as each job
+// starts.
+func NewLines(w io.Writer, jobs []Job) Reporter {
+	return &lines{w: w, jobs: jobs}
+}
+
+// NewQuiet returns a reporter that doesn't print anything about the jobs.
+// What is written to it still goes to w.
+func NewQuiet(w io.Writer) Reporter {
+	return &lines{w: w}
+}
+
+func (l *lines) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func (l *lines) Start(job int) {
+	if l.jobs == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "--> %15s: %s\n", l.jobs[job].Platform, l.jobs[job].Name)
+}
+
+func (l *lines) Finish(job int, err error) {}
+
+func (l *lines) Close() {}
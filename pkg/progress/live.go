@@ -0,0 +1,228 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type state int
+
+const (
+	queued state = iota
+	running
+	succeeded
+	failed
+)
+
+// refreshInterval is how often the elapsed times and ETA are redrawn.
+const refreshInterval = 200 * time.Millisecond
+
+// live redraws a table of the running jobs, with the number of queued,
+// succeeded and failed ones and an estimate of the time left, in place at
+// the bottom of a terminal. Finished jobs and anything written to the
+// reporter scroll by above the table.
+type live struct {
+	mu       sync.Mutex
+	w        io.Writer
+	jobs     []Job
+	state    []state
+	started  []time.Time
+	elapsed  []time.Duration
+	parallel int
+	width    int
+	begin    time.Time
+
+	// drawn is the number of lines of the table currently on screen.
+	drawn int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewLive returns a reporter drawing a live table on w, which should be a
+// terminal. parallel is the number of jobs run at once, used to estimate
+// the time left.
+func NewLive(w io.Writer, jobs []Job, parallel int) Reporter {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	width := 80
+	if v, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && v > 0 {
+		width = v
+	}
+
+	l := &live{
+		w:        w,
+		jobs:     jobs,
+		state:    make([]state, len(jobs)),
+		started:  make([]time.Time, len(jobs)),
+		elapsed:  make([]time.Duration, len(jobs)),
+		parallel: parallel,
+		width:    width,
+		begin:    time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.refresh()
+	return l
+}
+
+func (l *live) refresh() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			l.clear()
+			l.draw()
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *live) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clear()
+	n, err := l.w.Write(p)
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		io.WriteString(l.w, "\n")
+	}
+	l.draw()
+	return n, err
+}
+
+func (l *live) Start(job int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state[job] = running
+	l.started[job] = time.Now()
+	l.clear()
+	l.draw()
+}
+
+func (l *live) Finish(job int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.elapsed[job] = time.Since(l.started[job])
+	status := ""
+	l.state[job] = succeeded
+	if err != nil {
+		l.state[job] = failed
+		status = " FAILED"
+	}
+
+	l.clear()
+	fmt.Fprintf(l.w, "--> %15s: %s%s (%s)\n", l.jobs[job].Platform, l.jobs[job].Name,
+		status, round(l.elapsed[job]))
+	l.draw()
+}
+
+func (l *live) Close() {
+	close(l.done)
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clear()
+	counts := l.counts()
+	fmt.Fprintf(l.w, "%d succeeded, %d failed in %s\n",
+		counts[succeeded], counts[failed], round(time.Since(l.begin)))
+}
+
+// clear erases the table, leaving the cursor where it started.
+func (l *live) clear() {
+	if l.drawn > 0 {
+		fmt.Fprintf(l.w, "\r\x1b[%dA\x1b[J", l.drawn)
+		l.drawn = 0
+	}
+}
+
+// draw writes the table below the cursor.
+func (l *live) draw() {
+	now := time.Now()
+	counts := l.counts()
+
+	var buf bytes.Buffer
+	lines := []string{fmt.Sprintf("%d queued, %d running, %d succeeded, %d failed, ETA %s",
+		counts[queued], counts[running], counts[succeeded], counts[failed], l.eta(now))}
+	for i, job := range l.jobs {
+		if l.state[i] == running {
+			lines = append(lines, fmt.Sprintf("    %15s: %s (%s)",
+				job.Platform, job.Name, round(now.Sub(l.started[i]))))
+		}
+	}
+
+	for _, line := range lines {
+		// Lines wrapping around would throw off the count used to clear
+		// the table.
+		if len(line) >= l.width {
+			line = line[:l.width-1]
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+
+	l.w.Write(buf.Bytes())
+	l.drawn = len(lines)
+}
+
+func (l *live) counts() map[state]int {
+	counts := make(map[state]int)
+	for _, s := range l.state {
+		counts[s]++
+	}
+
+	return counts
+}
+
+// eta estimates the time left from the average duration of the finished
+// jobs.
+func (l *live) eta(now time.Time) string {
+	var total time.Duration
+	finished := 0
+	for i, s := range l.state {
+		if s == succeeded || s == failed {
+			total += l.elapsed[i]
+			finished++
+		}
+	}
+	if finished == 0 {
+		return "unknown"
+	}
+
+	average := total / time.Duration(finished)
+	var left time.Duration
+	for i, s := range l.state {
+		switch s {
+		case queued:
+			left += average
+		case running:
+			if d := average - now.Sub(l.started[i]); d > 0 {
+				left += d
+			}
+		}
+	}
+
+	return round(left / time.Duration(l.parallel)).String()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
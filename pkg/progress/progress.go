@@ -0,0 +1,43 @@
+package progress
+
+import (
+	"io"
+	"os"
+)
+
+// Job is a unit of work whose progress is reported, such as building one
+// package for one platform.
+type Job struct {
+	Platform string
+	Name     string
+}
+
+// Reporter displays the progress of a set of jobs. Jobs are identified by
+// their index in the list the reporter was created with. Reporters are
+// safe for concurrent use.
+//
+// Reporters are also writers: anything written to them is shown to the
+// user without garbling the progress display.
+type Reporter interface {
+	io.Writer
+
+	// Start marks the job as running.
+	Start(job int)
+
+	// Finish marks the job as done, failed if err is non-nil.
+	Finish(job int, err error)
+
+	// Close stops the reporter, leaving the final state on screen.
+	Close()
+}
+
+// IsTerminal reports whether f is a character device, like a terminal,
+// rather than a file or a pipe.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
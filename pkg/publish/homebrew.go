@@ -0,0 +1,114 @@
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// brewCPUs are the blocks of the formula selecting the CPU of the
+// supported architectures.
+var brewCPUs = map[string]string{
+	"amd64": "Hardware::CPU.intel?",
+	"arm64": "Hardware::CPU.arm? && Hardware::CPU.is_64_bit?",
+}
+
+// renderHomebrew renders a formula installing the darwin and linux
+// artifacts, at Formula/<name>.rb as in a tap.
+func renderHomebrew(p *Package) ([]File, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by gox, do not edit.\n")
+	fmt.Fprintf(&buf, "class %s < Formula\n", brewClass(p.Name))
+	fmt.Fprintf(&buf, "  desc %s\n", rubyString(p.Description))
+	if p.Homepage != "" {
+		fmt.Fprintf(&buf, "  homepage %s\n", rubyString(p.Homepage))
+	}
+	fmt.Fprintf(&buf, "  version %s\n", rubyString(p.Version))
+	if p.License != "" {
+		fmt.Fprintf(&buf, "  license %s\n", rubyString(p.License))
+	}
+
+	var install bytes.Buffer
+	found := false
+	for _, os := range []string{"darwin", "linux"} {
+		block := map[string]string{"darwin": "on_macos", "linux": "on_linux"}[os]
+		check := map[string]string{"darwin": "OS.mac?", "linux": "OS.linux?"}[os]
+		artifacts, _ := artifacts(p, os, brewCPUs)
+		if len(artifacts) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "\n  %s do\n", block)
+		for i, a := range artifacts {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "    if %s\n", brewCPUs[a.Arch])
+			fmt.Fprintf(&buf, "      url %s\n", rubyString(a.URL))
+			fmt.Fprintf(&buf, "      sha256 %s\n", rubyString(a.SHA256))
+			fmt.Fprintf(&buf, "    end\n")
+
+			keyword := "elsif"
+			if !found {
+				keyword = "if"
+			}
+			found = true
+			fmt.Fprintf(&install, "    %s %s && %s\n", keyword, check, brewCPUs[a.Arch])
+			fmt.Fprintf(&install, "      bin.install %s => %s\n", rubyString(brewPath(a)), rubyString(p.Command))
+		}
+		fmt.Fprintf(&buf, "  end\n")
+	}
+	if !found {
+		return nil, nil
+	}
+
+	fmt.Fprintf(&buf, "\n  def install\n%s    end\n  end\n", install.String())
+	fmt.Fprintf(&buf, "\n  test do\n    assert_predicate bin/%s, :executable?\n  end\nend\n", rubyString(p.Command))
+
+	return []File{{Path: "Formula/" + p.Name + ".rb", Data: buf.Bytes()}}, nil
+}
+
+// brewPath returns the path of the binary in the staging directory of
+// the formula. Homebrew enters the single top-level directory of archives.
+func brewPath(a Artifact) string {
+	if a.Archive == "" {
+		return a.Binary
+	}
+
+	parts := strings.SplitN(a.Binary, "/", 2)
+	if len(parts) == 2 {
+		return parts[1]
+	}
+	return path.Base(a.Binary)
+}
+
+// brewClass returns the class name Homebrew expects for a formula, as in
+// Formulary.class_s.
+func brewClass(name string) string {
+	name = strings.Replace(name, "+", "x", -1)
+	name = strings.Replace(name, "@", "AT", -1)
+
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range name {
+		if r == '-' || r == '_' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+// rubyString quotes s as a Ruby string literal.
+func rubyString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "#{", `\#{`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
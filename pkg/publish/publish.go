@@ -0,0 +1,116 @@
+// Package publish renders the manifests of package managers installing
+// the artifacts of a release: Homebrew formulae, Scoop manifests and
+// winget manifests. The files are written in the layout of the
+// repositories they are committed to.
+package publish
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The supported kinds of manifests.
+const (
+	Homebrew = "homebrew"
+	Scoop    = "scoop"
+	Winget   = "winget"
+)
+
+// Kinds are the supported kinds of manifests.
+var Kinds = []string{Homebrew, Scoop, Winget}
+
+// ValidKind reports whether kind is supported.
+func ValidKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Package describes a package and its artifacts.
+type Package struct {
+	// Name is the name of the package and Command the name of the
+	// installed binary.
+	Name    string
+	Command string
+	Version string
+
+	Description string
+	Homepage    string
+	License     string
+
+	// Publisher and Identifier are used by winget, where packages are
+	// identified like "Publisher.Name".
+	Publisher  string
+	Identifier string
+
+	Artifacts []Artifact
+}
+
+// Artifact is a downloadable file of a package.
+type Artifact struct {
+	OS   string
+	Arch string
+
+	URL    string
+	SHA256 string
+
+	// Archive is the format of the file when it's an archive, Binary the
+	// slash separated path of the binary in the archive or, when it isn't
+	// one, the name of the file.
+	Archive string
+	Binary  string
+}
+
+// File is a rendered manifest, at a slash separated path relative to the
+// root of the repository it belongs to.
+type File struct {
+	Path string
+	Data []byte
+}
+
+// Render renders the manifests of the kind for the package. A kind for
+// which the package has no suitable artifacts renders no files.
+func Render(kind string, p *Package) ([]File, error) {
+	artifacts := append([]Artifact(nil), p.Artifacts...)
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].OS != artifacts[j].OS {
+			return artifacts[i].OS < artifacts[j].OS
+		}
+		return artifacts[i].Arch < artifacts[j].Arch
+	})
+	sorted := *p
+	sorted.Artifacts = artifacts
+	sorted.Version = strings.TrimPrefix(p.Version, "v")
+
+	switch kind {
+	case Homebrew:
+		return renderHomebrew(&sorted)
+	case Scoop:
+		return renderScoop(&sorted)
+	case Winget:
+		return renderWinget(&sorted)
+	}
+
+	return nil, fmt.Errorf("unknown manifest kind %q, should be one of %s",
+		kind, strings.Join(Kinds, ", "))
+}
+
+// artifacts returns the artifacts of p for goos whose architecture has a
+// name in arches, with that name.
+func artifacts(p *Package, goos string, arches map[string]string) ([]Artifact, []string) {
+	var result []Artifact
+	var names []string
+	for _, a := range p.Artifacts {
+		if name, ok := arches[a.Arch]; ok && a.OS == goos {
+			result = append(result, a)
+			names = append(names, name)
+		}
+	}
+
+	return result, names
+}
@@ -0,0 +1,69 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// scoopArches are the names of the architectures in Scoop manifests.
+var scoopArches = map[string]string{
+	"386":   "32bit",
+	"amd64": "64bit",
+	"arm64": "arm64",
+}
+
+// scoopManifest is the layout of a Scoop manifest.
+type scoopManifest struct {
+	Version      string                       `json:"version"`
+	Description  string                       `json:"description"`
+	Homepage     string                       `json:"homepage,omitempty"`
+	License      string                       `json:"license,omitempty"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+}
+
+type scoopArchitecture struct {
+	URL        string     `json:"url"`
+	Hash       string     `json:"hash"`
+	ExtractDir string     `json:"extract_dir,omitempty"`
+	Bin        [][]string `json:"bin"`
+}
+
+// renderScoop renders a manifest installing the windows artifacts, at
+// bucket/<name>.json as in a bucket.
+func renderScoop(p *Package) ([]File, error) {
+	artifacts, names := artifacts(p, "windows", scoopArches)
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+
+	manifest := scoopManifest{
+		Version:      p.Version,
+		Description:  p.Description,
+		Homepage:     p.Homepage,
+		License:      p.License,
+		Architecture: make(map[string]scoopArchitecture),
+	}
+	for i, a := range artifacts {
+		arch := scoopArchitecture{URL: a.URL, Hash: a.SHA256}
+		binary := a.Binary
+		if a.Archive != "" {
+			if parts := strings.SplitN(binary, "/", 2); len(parts) == 2 {
+				arch.ExtractDir = parts[0]
+				binary = parts[1]
+			}
+		}
+		arch.Bin = [][]string{{strings.Replace(binary, "/", `\`, -1), p.Command}}
+		manifest.Architecture[names[i]] = arch
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	return []File{{Path: "bucket/" + p.Name + ".json", Data: buf.Bytes()}}, nil
+}
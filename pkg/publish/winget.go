@@ -0,0 +1,167 @@
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path"
+	"strings"
+)
+
+// wingetManifestVersion is the version of the schema of the manifests.
+const wingetManifestVersion = "1.6.0"
+
+// wingetLocale is the default locale of the packages.
+const wingetLocale = "en-US"
+
+// wingetArches are the names of the architectures in winget manifests.
+var wingetArches = map[string]string{
+	"386":   "x86",
+	"amd64": "x64",
+	"arm":   "arm",
+	"arm64": "arm64",
+}
+
+type wingetVersion struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	DefaultLocale     string `yaml:"DefaultLocale"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+type wingetInstaller struct {
+	PackageIdentifier string           `yaml:"PackageIdentifier"`
+	PackageVersion    string           `yaml:"PackageVersion"`
+	Commands          []string         `yaml:"Commands,omitempty"`
+	Installers        []wingetArtifact `yaml:"Installers"`
+	ManifestType      string           `yaml:"ManifestType"`
+	ManifestVersion   string           `yaml:"ManifestVersion"`
+}
+
+type wingetArtifact struct {
+	Architecture         string             `yaml:"Architecture"`
+	InstallerType        string             `yaml:"InstallerType"`
+	NestedInstallerType  string             `yaml:"NestedInstallerType,omitempty"`
+	NestedInstallerFiles []wingetNestedFile `yaml:"NestedInstallerFiles,omitempty"`
+	InstallerURL         string             `yaml:"InstallerUrl"`
+	InstallerSha256      string             `yaml:"InstallerSha256"`
+}
+
+type wingetNestedFile struct {
+	RelativeFilePath     string `yaml:"RelativeFilePath"`
+	PortableCommandAlias string `yaml:"PortableCommandAlias"`
+}
+
+type wingetLocaleManifest struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	PackageLocale     string `yaml:"PackageLocale"`
+	Publisher         string `yaml:"Publisher"`
+	PackageName       string `yaml:"PackageName"`
+	PackageURL        string `yaml:"PackageUrl,omitempty"`
+	License           string `yaml:"License"`
+	ShortDescription  string `yaml:"ShortDescription"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+// renderWinget renders the version, installer and default locale
+// manifests of the windows artifacts, at
+// manifests/<p>/<Publisher>/<Name>/<version>/ as in winget-pkgs.
+func renderWinget(p *Package) ([]File, error) {
+	artifacts, names := artifacts(p, "windows", wingetArches)
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+
+	id := p.Identifier
+	if id == "" {
+		id = p.Publisher + "." + p.Name
+	}
+	parts := strings.Split(id, ".")
+	if p.Publisher == "" || p.License == "" {
+		return nil, fmt.Errorf("winget manifests need a publisher and a license")
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid winget package identifier %q, should be like Publisher.Name", id)
+	}
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, `/\ `) {
+			return nil, fmt.Errorf("invalid winget package identifier %q", id)
+		}
+	}
+
+	installer := wingetInstaller{
+		PackageIdentifier: id,
+		PackageVersion:    p.Version,
+		ManifestType:      "installer",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	for i, a := range artifacts {
+		artifact := wingetArtifact{
+			Architecture:    names[i],
+			InstallerType:   "portable",
+			InstallerURL:    a.URL,
+			InstallerSha256: strings.ToUpper(a.SHA256),
+		}
+		switch a.Archive {
+		case "":
+			installer.Commands = []string{p.Command}
+		case "zip":
+			artifact.InstallerType = "zip"
+			artifact.NestedInstallerType = "portable"
+			artifact.NestedInstallerFiles = []wingetNestedFile{{
+				RelativeFilePath:     strings.Replace(a.Binary, "/", `\`, -1),
+				PortableCommandAlias: p.Command,
+			}}
+		default:
+			return nil, fmt.Errorf("winget only installs zip archives, not %s", a.Archive)
+		}
+		installer.Installers = append(installer.Installers, artifact)
+	}
+
+	manifests := []struct {
+		suffix string
+		value  interface{}
+	}{
+		{"", wingetVersion{
+			PackageIdentifier: id,
+			PackageVersion:    p.Version,
+			DefaultLocale:     wingetLocale,
+			ManifestType:      "version",
+			ManifestVersion:   wingetManifestVersion,
+		}},
+		{".installer", installer},
+		{".locale." + wingetLocale, wingetLocaleManifest{
+			PackageIdentifier: id,
+			PackageVersion:    p.Version,
+			PackageLocale:     wingetLocale,
+			Publisher:         p.Publisher,
+			PackageName:       p.Name,
+			PackageURL:        p.Homepage,
+			License:           p.License,
+			ShortDescription:  p.Description,
+			ManifestType:      "defaultLocale",
+			ManifestVersion:   wingetManifestVersion,
+		}},
+	}
+
+	dir := path.Join(append([]string{"manifests", strings.ToLower(id[:1])}, append(parts, p.Version)...)...)
+	var files []File
+	for _, m := range manifests {
+		var buf bytes.Buffer
+		buf.WriteString("# Generated by gox, do not edit.\n")
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(m.value); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: path.Join(dir, id+m.suffix+".yaml"), Data: buf.Bytes()})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,171 @@
+// Package quoted splits and joins the flag strings given to gox and to the
+// go command, such as "-ldflags".
+//
+// Split follows the quoting rules of a POSIX shell, minus the backslash
+// escapes, so that values can be written the way they would be on a
+// command line while Windows paths keep their backslashes, as with the go
+// command. Join produces the simpler format the go command parses: fields
+// separated by spaces, quoted with single or double quotes when they
+// contain spaces or quotes.
+package quoted
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Split splits s into fields using the quoting rules of a POSIX shell
+// without escapes: fields are separated by whitespace, and single and
+// double quotes preserve everything up to the next quote of the same kind,
+// so that a quoted part can be followed by more of the field as in
+// main.motd='hello world'. Backslashes are kept as they are. Unterminated
+// quotes are an error.
+func Split(s string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case r == '\'' || r == '"':
+			end := indexRune(runes, i+1, r)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c quote in %q", r, s)
+			}
+			field.WriteString(string(runes[i+1 : end]))
+			i = end
+			inField = true
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Join joins the fields so that both the go command and Split split them
+// back into the same fields. Neither has escapes, so a field can't
+// contain both kinds of quotes.
+func Join(fields []string) (string, error) {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		switch {
+		case f != "" && !strings.ContainsAny(f, " \t\n\r'\""):
+			parts = append(parts, f)
+		case !strings.Contains(f, "'"):
+			parts = append(parts, "'"+f+"'")
+		case !strings.Contains(f, `"`):
+			parts = append(parts, `"`+f+`"`)
+		default:
+			return "", fmt.Errorf("%q can't be quoted for the go command", f)
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// Flags is the value of a flag like "-ldflags" or "-gcflags": an optional
+// package pattern, as in "all=-N -l", followed by the flags themselves.
+type Flags struct {
+	Pattern string
+	Fields  []string
+}
+
+// ParseFlags parses the value of a flag like the go command does, except
+// that the flags are split with Split.
+func ParseFlags(s string) (*Flags, error) {
+	s = strings.TrimSpace(s)
+	f := &Flags{}
+	if s != "" && s[0] != '-' && s[0] != '\'' && s[0] != '"' {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("missing =<flags> in <pattern>=<flags>: %q", s)
+		}
+		f.Pattern, s = s[:i], s[i+1:]
+	}
+
+	fields, err := Split(s)
+	if err != nil {
+		return nil, err
+	}
+	f.Fields = fields
+	return f, nil
+}
+
+// Merge adds the fields of other after those of f. Flags for different
+// package patterns can't be merged.
+func (f *Flags) Merge(other *Flags) error {
+	if len(f.Fields) == 0 && f.Pattern == "" {
+		f.Pattern = other.Pattern
+	}
+	if len(other.Fields) > 0 && other.Pattern != f.Pattern {
+		return fmt.Errorf("can't merge flags for package pattern %q with flags for %q",
+			other.Pattern, f.Pattern)
+	}
+
+	f.Fields = append(f.Fields, other.Fields...)
+	return nil
+}
+
+// String returns the value in the format of the go command.
+func (f *Flags) String() (string, error) {
+	s, err := Join(f.Fields)
+	if err != nil {
+		return "", err
+	}
+	if f.Pattern != "" {
+		s = f.Pattern + "=" + s
+	}
+
+	return s, nil
+}
+
+// Normalize parses a flag value written with shell quoting and returns
+// it in the format of the go command.
+func Normalize(s string) (string, error) {
+	f, err := ParseFlags(s)
+	if err != nil {
+		return "", err
+	}
+
+	return f.String()
+}
+
+// MergeFlags returns the flags of all the values, in order, as a single
+// value in the format of the go command. Empty values are ignored.
+func MergeFlags(values ...string) (string, error) {
+	merged := &Flags{}
+	for _, v := range values {
+		f, err := ParseFlags(v)
+		if err != nil {
+			return "", err
+		}
+		if err := merged.Merge(f); err != nil {
+			return "", err
+		}
+	}
+
+	return merged.String()
+}
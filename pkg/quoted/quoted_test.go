@@ -0,0 +1,176 @@
+package quoted
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+		err  string
+	}{
+		{"", nil, ""},
+		{"   ", nil, ""},
+		{"-s -w", []string{"-s", "-w"}, ""},
+		{" -s\t-w\n", []string{"-s", "-w"}, ""},
+		{"-X 'main.motd=hello world'", []string{"-X", "main.motd=hello world"}, ""},
+		{`-X "main.motd=hello world"`, []string{"-X", "main.motd=hello world"}, ""},
+		{"-X main.motd='hello world'", []string{"-X", "main.motd=hello world"}, ""},
+		{`-X "main.q=it's"`, []string{"-X", "main.q=it's"}, ""},
+		{`-X 'main.q=say "hi"'`, []string{"-X", `main.q=say "hi"`}, ""},
+		{"''", []string{""}, ""},
+		{`""`, []string{""}, ""},
+		{`-trimpath=C:\Users\me\go`, []string{`-trimpath=C:\Users\me\go`}, ""},
+		{`'C:\Program Files\app'`, []string{`C:\Program Files\app`}, ""},
+		{`"\\server\share\dir"`, []string{`\\server\share\dir`}, ""},
+		{`trailing\`, []string{`trailing\`}, ""},
+		{"'unterminated", nil, "unterminated ' quote"},
+		{`"unterminated`, nil, `unterminated " quote`},
+	}
+
+	for _, tc := range cases {
+		got, err := Split(tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Split(%q): got error %v, want %q", tc.in, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Split(%q): %s", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Split(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want string
+		err  bool
+	}{
+		{nil, "", false},
+		{[]string{"-s", "-w"}, "-s -w", false},
+		{[]string{"-X", "main.motd=hello world"}, "-X 'main.motd=hello world'", false},
+		{[]string{""}, "''", false},
+		{[]string{"it's"}, `"it's"`, false},
+		{[]string{`C:\Users\me`}, `C:\Users\me`, false},
+		{[]string{`C:\Program Files`}, `'C:\Program Files'`, false},
+		{[]string{`it's "quoted"`}, "", true},
+	}
+
+	for _, tc := range cases {
+		got, err := Join(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Join(%q) = %q, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Join(%q): %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Join(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestJoinSplitRoundTrip(t *testing.T) {
+	for _, fields := range [][]string{
+		{"-s", "-w"},
+		{"-X", "main.motd=hello world", "-X", "main.q=it's"},
+		{"-X", `main.q=say "hi"`},
+		{`-trimpath=C:\Users\me\go`, `C:\Program Files\app`, `\\server\share`},
+		{"", "tab\there", "new\nline"},
+	} {
+		joined, err := Join(fields)
+		if err != nil {
+			t.Errorf("Join(%q): %s", fields, err)
+			continue
+		}
+		split, err := Split(joined)
+		if err != nil {
+			t.Errorf("Split(%q): %s", joined, err)
+			continue
+		}
+		if !reflect.DeepEqual(split, fields) {
+			t.Errorf("Split(Join(%q)) = %q", fields, split)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in, want string
+		err      bool
+	}{
+		{"", "", false},
+		{"-s  -w", "-s -w", false},
+		{`-X "main.motd=hello world"`, "-X 'main.motd=hello world'", false},
+		{"all=-N -l", "all=-N -l", false},
+		{`all=-trimpath=C:\go`, `all=-trimpath=C:\go`, false},
+		{"std=-B", "std=-B", false},
+		{"all", "", true},
+		{"-X 'main.motd", "", true},
+	}
+
+	for _, tc := range cases {
+		got, err := Normalize(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Normalize(%q) = %q, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Normalize(%q): %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMergeFlags(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want string
+		err  bool
+	}{
+		{nil, "", false},
+		{[]string{"-s -w", "", "-X main.a=1"}, "-s -w -X main.a=1", false},
+		{[]string{"-X 'main.motd=hello world'", "-X main.b=2"}, "-X 'main.motd=hello world' -X main.b=2", false},
+		{[]string{"all=-N", "all=-l"}, "all=-N -l", false},
+		{[]string{"", "all=-N -l"}, "all=-N -l", false},
+		{[]string{"all=-N", ""}, "all=-N", false},
+		{[]string{"all=-N", "std=-B"}, "", true},
+		{[]string{"-N", "all=-l"}, "", true},
+		{[]string{"all=-N", "-l"}, "", true},
+	}
+
+	for _, tc := range cases {
+		got, err := MergeFlags(tc.in...)
+		if tc.err {
+			if err == nil {
+				t.Errorf("MergeFlags(%q) = %q, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MergeFlags(%q): %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("MergeFlags(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+type junitTestcase struct {
+	Classname  string           `xml:"classname,attr"`
+	Name       string           `xml:"name,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  *junitOutput     `xml:"system-out,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, with a testsuite per suite
+// and a testcase per case.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	var all []Case
+	doc := junitTestsuites{Name: "gox"}
+	for _, s := range r.Suites() {
+		suite := junitTestsuite{Name: s.Name}
+		var elapsed time.Duration
+		suite.Tests, suite.Failures, suite.Skipped, elapsed = counts(s.Cases)
+		suite.Time = junitTime(elapsed)
+
+		for _, c := range s.Cases {
+			tc := junitTestcase{
+				Classname: c.Class,
+				Name:      c.Name,
+				Time:      junitTime(c.Elapsed),
+			}
+			if len(c.Properties) > 0 {
+				tc.Properties = &junitProperties{}
+				for _, p := range c.Properties {
+					tc.Properties.Properties = append(tc.Properties.Properties, junitProperty{Name: p[0], Value: p[1]})
+				}
+			}
+			if c.Output != "" {
+				tc.SystemOut = &junitOutput{Text: c.Output}
+			}
+			if c.Failed() {
+				tc.Failure = &junitMessage{Message: c.Failure, Text: c.Details}
+			}
+			if c.Skipped != "" {
+				tc.Skipped = &junitMessage{Message: c.Skipped}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		all = append(all, s.Cases...)
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	var elapsed time.Duration
+	doc.Tests, doc.Failures, doc.Skipped, elapsed = counts(all)
+	doc.Time = junitTime(elapsed)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
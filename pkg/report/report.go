@@ -0,0 +1,94 @@
+package report
+
+import (
+	"sort"
+	"time"
+)
+
+// Report collects the results of a gox run so that they can be written in
+// the formats understood by CI systems. Results are grouped in suites,
+// one per platform.
+type Report struct {
+	suites map[string]*Suite
+}
+
+// Suite is the group of cases for one platform.
+type Suite struct {
+	Name  string
+	Cases []Case
+}
+
+// Case is a single result: a build job or a single Go test.
+type Case struct {
+	// Class groups related cases within a suite, usually the import path
+	// of the package.
+	Class string
+	Name  string
+
+	Elapsed time.Duration
+
+	// Failure is a short message describing why the case failed, empty if
+	// it didn't. Details holds the full explanation, like compiler stderr.
+	Failure string
+	Details string
+
+	// Skipped is the reason the case was skipped, empty if it wasn't.
+	Skipped string
+
+	// Output is anything the case printed.
+	Output string
+
+	// Properties are name and value pairs describing the result, like
+	// the attributes of a built binary.
+	Properties [][2]string
+}
+
+// Failed reports whether the case failed.
+func (c *Case) Failed() bool {
+	return c.Failure != ""
+}
+
+func New() *Report {
+	return &Report{suites: make(map[string]*Suite)}
+}
+
+// Add appends a case to the named suite, creating it if needed.
+func (r *Report) Add(suite string, c Case) {
+	s, ok := r.suites[suite]
+	if !ok {
+		s = &Suite{Name: suite}
+		r.suites[suite] = s
+	}
+
+	s.Cases = append(s.Cases, c)
+}
+
+// Suites returns the suites sorted by name. Cases keep the order they
+// were added in.
+func (r *Report) Suites() []*Suite {
+	suites := make([]*Suite, 0, len(r.suites))
+	for _, s := range r.suites {
+		suites = append(suites, s)
+	}
+
+	sort.Slice(suites, func(i, j int) bool {
+		return suites[i].Name < suites[j].Name
+	})
+	return suites
+}
+
+// counts returns the number of cases, failures and skipped cases.
+func counts(cases []Case) (tests, failures, skipped int, elapsed time.Duration) {
+	for _, c := range cases {
+		tests++
+		if c.Failed() {
+			failures++
+		}
+		if c.Skipped != "" {
+			skipped++
+		}
+		elapsed += c.Elapsed
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTAP writes the report as a TAP version 13 stream, one test point
+// per case. Failure details and properties are attached as a YAML
+// diagnostic block.
+func (r *Report) WriteTAP(w io.Writer) error {
+	suites := r.Suites()
+	total := 0
+	for _, s := range suites {
+		total += len(s.Cases)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "TAP version 13\n1..%d\n", total)
+
+	n := 0
+	for _, s := range suites {
+		for _, c := range s.Cases {
+			n++
+			status := "ok"
+			if c.Failed() {
+				status = "not ok"
+			}
+
+			desc := tapEscape(fmt.Sprintf("%s %s %s", s.Name, c.Class, c.Name))
+			if c.Skipped != "" {
+				fmt.Fprintf(bw, "%s %d - %s # SKIP %s\n", status, n, desc, tapEscape(c.Skipped))
+			} else {
+				fmt.Fprintf(bw, "%s %d - %s\n", status, n, desc)
+			}
+
+			if !c.Failed() && len(c.Properties) == 0 {
+				continue
+			}
+			fmt.Fprintf(bw, "  ---\n")
+			if c.Failed() {
+				fmt.Fprintf(bw, "  message: %q\n", c.Failure)
+				if c.Details != "" {
+					fmt.Fprintf(bw, "  details: |\n")
+					for _, line := range strings.Split(strings.TrimRight(c.Details, "\n"), "\n") {
+						fmt.Fprintf(bw, "    %s\n", line)
+					}
+				}
+			}
+			for _, p := range c.Properties {
+				fmt.Fprintf(bw, "  %s: %q\n", p[0], p[1])
+			}
+			fmt.Fprintf(bw, "  ...\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// tapEscape escapes the characters that have a meaning in a TAP test line.
+func tapEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "#", "\\#", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"github.com/mitchellh/gox/pkg/winres"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// ResourcesFile is the name of the resource object added to the package
+// being built for windows when cfg.WindowsResources is set, %s being the
+// architecture, as the go command leaves the .syso files named after a
+// platform out of the builds for the others.
+const ResourcesFile = "gox_resources_windows_%s.syso"
+
+// windowsResources returns the resource object of the binary written to
+// output by a windows build of the package at packagePath.
+func windowsResources(cfg *config.Config, platform config.Platform, packagePath, output string) ([]byte, error) {
+	r := cfg.WindowsResources
+	render := func(name, text, fallback string) (string, error) {
+		if text == "" {
+			text = fallback
+		}
+		value, err := RenderTemplate(cfg, platform, packagePath, name, text)
+		if err != nil {
+			return "", fmt.Errorf("windows_resources: %s", err)
+		}
+		return value, nil
+	}
+
+	var res winres.Resources
+	name := templateData(cfg, platform, packagePath).Dir
+	fields := []struct {
+		name, text, fallback string
+		value                *string
+	}{
+		{"version", r.Version, "{{.Version}}", &res.Version.FileVersion},
+		{"company", r.Company, "", &res.Version.CompanyName},
+		{"product", r.Product, name, &res.Version.ProductName},
+		{"description", r.Description, name, &res.Version.FileDescription},
+		{"copyright", r.Copyright, "", &res.Version.LegalCopyright},
+		{"trademarks", r.Trademarks, "", &res.Version.LegalTrademarks},
+		{"comments", r.Comments, "", &res.Version.Comments},
+	}
+	for _, f := range fields {
+		value, err := render(f.name, f.text, f.fallback)
+		if err != nil {
+			return nil, err
+		}
+		*f.value = value
+	}
+	res.Version.ProductVersion = res.Version.FileVersion
+	res.Version.InternalName = name
+	res.Version.OriginalFilename = filepath.Base(output)
+
+	var err error
+	if r.Icon != "" {
+		if res.Icon, err = ioutil.ReadFile(r.Icon); err != nil {
+			return nil, fmt.Errorf("windows_resources: %s", err)
+		}
+	}
+	if r.Manifest != "" {
+		if res.Manifest, err = ioutil.ReadFile(r.Manifest); err != nil {
+			return nil, fmt.Errorf("windows_resources: %s", err)
+		}
+	}
+
+	object, err := winres.Object(platform.Arch, &res)
+	if err != nil {
+		return nil, fmt.Errorf("windows_resources: %s", err)
+	}
+	return object, nil
+}
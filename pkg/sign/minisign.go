@@ -0,0 +1,135 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// minisignSigner writes prehashed minisign signatures, the default since
+// minisign 0.8.
+type minisignSigner struct {
+	keyID [8]byte
+	key   ed25519.PrivateKey
+}
+
+// minisign secret key layout, after the comment line and base64 decoding.
+const (
+	minisignKeyLen  = 2 + 2 + 2 + 32 + 8 + 8 + 104
+	minisignSaltOff = 6
+	minisignOpsOff  = minisignSaltOff + 32
+	minisignMemOff  = minisignOpsOff + 8
+	minisignKeynum  = minisignMemOff + 8
+)
+
+// loadMinisign reads a minisign secret key file, decrypting it with the
+// passphrase if it is encrypted.
+func loadMinisign(key, passphrase []byte) (*minisignSigner, error) {
+	lines := strings.Split(strings.TrimSpace(string(key)), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return nil, fmt.Errorf("reading minisign key: not a minisign secret key file")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("reading minisign key: %s", err)
+	}
+	if len(data) != minisignKeyLen || string(data[:2]) != "Ed" || string(data[4:6]) != "B2" {
+		return nil, fmt.Errorf("reading minisign key: unsupported key format")
+	}
+
+	keynum := data[minisignKeynum:]
+	switch string(data[2:4]) {
+	case "\x00\x00":
+	case "Sc":
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("the minisign key is encrypted and no passphrase was given")
+		}
+		ops := binary.LittleEndian.Uint64(data[minisignOpsOff:])
+		mem := binary.LittleEndian.Uint64(data[minisignMemOff:])
+		logN, r, p := scryptParams(ops, mem)
+		stream, err := scrypt.Key(passphrase, data[minisignSaltOff:minisignOpsOff], 1<<logN, r, p, len(keynum))
+		if err != nil {
+			return nil, fmt.Errorf("decrypting minisign key: %s", err)
+		}
+		for i := range keynum {
+			keynum[i] ^= stream[i]
+		}
+	default:
+		return nil, fmt.Errorf("reading minisign key: unsupported key derivation")
+	}
+
+	s := &minisignSigner{key: ed25519.PrivateKey(append([]byte(nil), keynum[8:72]...))}
+	copy(s.keyID[:], keynum[:8])
+
+	checksum := blake2b.Sum256(append(append(append([]byte(nil), data[:2]...), keynum[:8]...), keynum[8:72]...))
+	if !bytes.Equal(checksum[:], keynum[72:104]) {
+		return nil, fmt.Errorf("decrypting minisign key: wrong passphrase")
+	}
+
+	return s, nil
+}
+
+// scryptParams derives the scrypt parameters from the limits stored in the
+// key the way libsodium does.
+func scryptParams(ops, mem uint64) (logN uint, r, p int) {
+	if ops < 32768 {
+		ops = 32768
+	}
+	r = 8
+
+	var maxN uint64
+	if ops < mem/32 {
+		p = 1
+		maxN = ops / uint64(r*4)
+	} else {
+		maxN = mem / uint64(r*128)
+	}
+	for logN = 1; logN < 63; logN++ {
+		if uint64(1)<<logN > maxN/2 {
+			break
+		}
+	}
+	if ops >= mem/32 {
+		maxrp := (ops / 4) / (uint64(1) << logN)
+		if maxrp > 0x3fffffff {
+			maxrp = 0x3fffffff
+		}
+		p = int(maxrp) / r
+	}
+
+	return logN, r, p
+}
+
+func (s *minisignSigner) Sign(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	sig := ed25519.Sign(s.key, h.Sum(nil))
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), filepath.Base(path))
+	global := ed25519.Sign(s.key, append(append([]byte(nil), sig...), trusted...))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "untrusted comment: signature from gox\n")
+	fmt.Fprintf(&out, "%s\n", base64.StdEncoding.EncodeToString(append(append([]byte("ED"), s.keyID[:]...), sig...)))
+	fmt.Fprintf(&out, "trusted comment: %s\n", trusted)
+	fmt.Fprintf(&out, "%s\n", base64.StdEncoding.EncodeToString(global))
+
+	return path + ".minisig", writeFile(path+".minisig", out.Bytes())
+}
@@ -0,0 +1,160 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// testMinisignKey generates a throwaway minisign secret key file, encrypted
+// with passphrase unless it is empty, and returns the public key, the key
+// ID and the file.
+func testMinisignKey(t *testing.T, passphrase string) (ed25519.PublicKey, []byte, []byte) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID := make([]byte, 8)
+	rand.Read(keyID)
+	checksum := blake2b.Sum256(append(append([]byte("Ed"), keyID...), private...))
+	keynum := append(append(append([]byte(nil), keyID...), private...), checksum[:]...)
+
+	data := make([]byte, minisignKeyLen)
+	copy(data, "Ed\x00\x00B2")
+	rand.Read(data[minisignSaltOff:minisignOpsOff])
+	if passphrase != "" {
+		// Limits far below those of minisign, to keep the test fast.
+		ops, mem := uint64(32768), uint64(1<<24)
+		copy(data[2:4], "Sc")
+		binary.LittleEndian.PutUint64(data[minisignOpsOff:], ops)
+		binary.LittleEndian.PutUint64(data[minisignMemOff:], mem)
+		logN, r, p := scryptParams(ops, mem)
+		stream, err := scrypt.Key([]byte(passphrase), data[minisignSaltOff:minisignOpsOff], 1<<logN, r, p, len(keynum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range keynum {
+			keynum[i] ^= stream[i]
+		}
+	}
+	copy(data[minisignKeynum:], keynum)
+
+	key := "untrusted comment: minisign encrypted secret key\n" +
+		base64.StdEncoding.EncodeToString(data) + "\n"
+	return public, keyID, []byte(key)
+}
+
+func TestMinisignSign(t *testing.T) {
+	for _, passphrase := range []string{"", "secret"} {
+		public, keyID, key := testMinisignKey(t, passphrase)
+		path, data := testFile(t)
+
+		signer, err := Load(Minisign, key, []byte(passphrase))
+		if err != nil {
+			t.Errorf("passphrase %q: %s", passphrase, err)
+			continue
+		}
+		sigPath, err := signer.Sign(path)
+		if err != nil {
+			t.Errorf("passphrase %q: %s", passphrase, err)
+			continue
+		}
+		if sigPath != path+".minisig" {
+			t.Errorf("passphrase %q: signature written to %s", passphrase, sigPath)
+		}
+
+		out, err := ioutil.ReadFile(sigPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+		if len(lines) != 4 || !strings.HasPrefix(lines[0], "untrusted comment: ") {
+			t.Fatalf("passphrase %q: malformed signature file:\n%s", passphrase, out)
+		}
+
+		// The signature is prehashed, with the "ED" algorithm, and signs
+		// the BLAKE2b-512 hash of the file.
+		sig, err := base64.StdEncoding.DecodeString(lines[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != 2+8+ed25519.SignatureSize || string(sig[:2]) != "ED" {
+			t.Fatalf("passphrase %q: signature %x isn't prehashed", passphrase, sig)
+		}
+		if !bytes.Equal(sig[2:10], keyID) {
+			t.Errorf("passphrase %q: key ID %x, want %x", passphrase, sig[2:10], keyID)
+		}
+		hash := blake2b.Sum512(data)
+		if !ed25519.Verify(public, hash[:], sig[10:]) {
+			t.Errorf("passphrase %q: the signature doesn't verify", passphrase)
+		}
+
+		// The global signature signs the signature and the trusted
+		// comment.
+		trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+		if trusted == lines[2] || !strings.Contains(trusted, "\tfile:app_linux_amd64\thashed") {
+			t.Errorf("passphrase %q: trusted comment %q", passphrase, lines[2])
+		}
+		global, err := base64.StdEncoding.DecodeString(lines[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ed25519.Verify(public, append(append([]byte(nil), sig[10:]...), trusted...), global) {
+			t.Errorf("passphrase %q: the global signature doesn't verify", passphrase)
+		}
+	}
+}
+
+func TestMinisignLoadErrors(t *testing.T) {
+	_, _, key := testMinisignKey(t, "secret")
+
+	cases := []struct {
+		name       string
+		key        []byte
+		passphrase string
+		err        string
+	}{
+		{"no passphrase", key, "", "no passphrase was given"},
+		{"wrong passphrase", key, "wrong", "wrong passphrase"},
+		{"no comment", []byte("RWQ=\n"), "", "not a minisign secret key file"},
+		{"short key", []byte("untrusted comment: x\nRWQ=\n"), "", "unsupported key format"},
+	}
+
+	for _, tc := range cases {
+		_, err := Load(Minisign, tc.key, []byte(tc.passphrase))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestScryptParams(t *testing.T) {
+	cases := []struct {
+		ops, mem uint64
+		logN     uint
+		r, p     int
+	}{
+		// The limits minisign writes, those of libsodium's "sensitive"
+		// level.
+		{33554432, 1073741824, 20, 8, 1},
+		// libsodium's "interactive" level.
+		{524288, 16777216, 14, 8, 1},
+		{32768, 1 << 24, 10, 8, 1},
+	}
+
+	for _, tc := range cases {
+		logN, r, p := scryptParams(tc.ops, tc.mem)
+		if logN != tc.logN || r != tc.r || p != tc.p {
+			t.Errorf("scryptParams(%d, %d) = %d, %d, %d, want %d, %d, %d",
+				tc.ops, tc.mem, logN, r, p, tc.logN, tc.r, tc.p)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"io/ioutil"
+	"os"
+)
+
+// pgpSigner writes armored OpenPGP detached signatures.
+type pgpSigner struct {
+	entity *openpgp.Entity
+}
+
+// loadPGP reads the first key with a private key from an armored or binary
+// key ring, which may sign with the primary key or with a signing subkey.
+func loadPGP(key, passphrase []byte) (*pgpSigner, error) {
+	var ring openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN")) {
+		ring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	} else {
+		ring, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading OpenPGP key: %s", err)
+	}
+
+	for _, entity := range ring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+
+		if pgpEncrypted(entity) {
+			if len(passphrase) == 0 {
+				return nil, fmt.Errorf("the OpenPGP key is encrypted and no passphrase was given")
+			}
+			if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+				return nil, fmt.Errorf("decrypting OpenPGP key: %s", err)
+			}
+		}
+
+		return &pgpSigner{entity: entity}, nil
+	}
+
+	return nil, fmt.Errorf("no OpenPGP private key found")
+}
+
+// pgpEncrypted reports whether the primary key or a subkey of entity is
+// encrypted.
+func pgpEncrypted(entity *openpgp.Entity) bool {
+	if entity.PrivateKey.Encrypted {
+		return true
+	}
+	for _, sub := range entity.Subkeys {
+		if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *pgpSigner) Sign(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, s.entity, f, &packet.Config{}); err != nil {
+		return "", err
+	}
+	sig.WriteString("\n")
+
+	return path + ".asc", writeFile(path+".asc", sig.Bytes())
+}
+
+func writeFile(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,132 @@
+package sign
+
+import (
+	"bytes"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPGPKey generates a throwaway key of the algorithm, encrypted with
+// passphrase unless it is empty, and returns it along with the armored
+// secret key ring.
+func testPGPKey(t *testing.T, algo packet.PublicKeyAlgorithm, passphrase string) (*openpgp.Entity, []byte) {
+	config := &packet.Config{Algorithm: algo, RSABits: 2048}
+	entity, err := openpgp.NewEntity("gox test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != "" {
+		if err := entity.EncryptPrivateKeys([]byte(passphrase), config); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivateWithoutSigning(w, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return entity, buf.Bytes()
+}
+
+// testFile writes an artifact to sign in a temporary directory.
+func testFile(t *testing.T) (string, []byte) {
+	data := []byte("gox test artifact\n")
+	path := filepath.Join(t.TempDir(), "app_linux_amd64")
+	if err := ioutil.WriteFile(path, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, data
+}
+
+func TestPGPSign(t *testing.T) {
+	cases := []struct {
+		name       string
+		algo       packet.PublicKeyAlgorithm
+		passphrase string
+	}{
+		{"rsa", packet.PubKeyAlgoRSA, ""},
+		{"rsa encrypted", packet.PubKeyAlgoRSA, "secret"},
+		{"ed25519", packet.PubKeyAlgoEdDSA, ""},
+		{"ed25519 encrypted", packet.PubKeyAlgoEdDSA, "secret"},
+	}
+
+	for _, tc := range cases {
+		entity, key := testPGPKey(t, tc.algo, tc.passphrase)
+		path, data := testFile(t)
+
+		signer, err := Load(PGP, key, []byte(tc.passphrase))
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		sigPath, err := signer.Sign(path)
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if sigPath != path+".asc" {
+			t.Errorf("%s: signature written to %s", tc.name, sigPath)
+		}
+
+		sig, err := ioutil.ReadFile(sigPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring := openpgp.EntityList{entity}
+		if _, err := openpgp.CheckArmoredDetachedSignature(ring, bytes.NewReader(data), bytes.NewReader(sig), nil); err != nil {
+			t.Errorf("%s: verifying the signature: %s", tc.name, err)
+		}
+		tampered := append([]byte("x"), data...)
+		if _, err := openpgp.CheckArmoredDetachedSignature(ring, bytes.NewReader(tampered), bytes.NewReader(sig), nil); err == nil {
+			t.Errorf("%s: the signature verifies another file", tc.name)
+		}
+	}
+}
+
+func TestPGPLoadErrors(t *testing.T) {
+	_, key := testPGPKey(t, packet.PubKeyAlgoEdDSA, "secret")
+	entity, _ := testPGPKey(t, packet.PubKeyAlgoEdDSA, "")
+
+	var public bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	cases := []struct {
+		name       string
+		key        []byte
+		passphrase string
+		err        string
+	}{
+		{"no passphrase", key, "", "no passphrase was given"},
+		{"wrong passphrase", key, "wrong", "decrypting OpenPGP key"},
+		{"public key", public.Bytes(), "", "no OpenPGP private key found"},
+		{"garbage", []byte("not a key"), "", "reading OpenPGP key"},
+	}
+
+	for _, tc := range cases {
+		_, err := Load(PGP, tc.key, []byte(tc.passphrase))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
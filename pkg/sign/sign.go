@@ -0,0 +1,39 @@
+// Package sign writes detached signatures of artifacts, either OpenPGP
+// signatures in armored ".asc" files or minisign signatures in ".minisig"
+// files.
+package sign
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The supported kinds of signatures.
+const (
+	PGP      = "pgp"
+	Minisign = "minisign"
+)
+
+// Kinds are the supported kinds of signatures.
+var Kinds = []string{PGP, Minisign}
+
+// Signer signs files.
+type Signer interface {
+	// Sign writes the detached signature of the file at path next to it,
+	// returning the path of the signature.
+	Sign(path string) (string, error)
+}
+
+// Load returns a signer of the given kind for the secret key, decrypting
+// it with passphrase if it is encrypted.
+func Load(kind string, key, passphrase []byte) (Signer, error) {
+	switch kind {
+	case PGP:
+		return loadPGP(key, passphrase)
+	case Minisign:
+		return loadMinisign(key, passphrase)
+	}
+
+	return nil, fmt.Errorf("unknown signature kind %q, should be one of %s",
+		kind, strings.Join(Kinds, ", "))
+}
@@ -0,0 +1,147 @@
+// Package stamp reads the version information of a build from the git
+// repository it is built from.
+package stamp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info is the version information of the source tree. Every field has a
+// value, even outside of a git checkout.
+type Info struct {
+	// Version is the output of "git describe --tags --always --dirty",
+	// like "v1.2.0-3-g1a2b3c4d-dirty".
+	Version string
+
+	// Commit is the full hash of the checked out commit, Revision its
+	// first 8 characters.
+	Commit   string
+	Revision string
+
+	// Branch is the checked out branch, or a branch pointing at the commit
+	// when the HEAD is detached, as is usual in CI.
+	Branch string
+
+	// Dirty is set when the tree has uncommitted changes.
+	Dirty bool
+
+	// Author is the author of the commit, as "Name <email>", empty when
+	// unknown.
+	Author string
+
+	// Built is the commit time, or the time in SOURCE_DATE_EPOCH, so that
+	// builds of the same commit are reproducible.
+	Built string
+}
+
+// Unknown returns the information used outside of a git checkout, which
+// matches the defaults of the variables of pkg/version.
+func Unknown() *Info {
+	return &Info{
+		Version:  "dev",
+		Commit:   "unknown",
+		Revision: "unknown",
+		Branch:   "HEAD",
+		Built:    builtTime(time.Now()),
+	}
+}
+
+// Read reads the information of the git repository containing dir. It only
+// runs local git commands. When dir isn't in a git checkout, or git isn't
+// installed, it returns Unknown along with an error explaining why.
+func Read(dir string) (*Info, error) {
+	info := Unknown()
+
+	commit, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return info, err
+	}
+	info.Commit = commit
+	info.Revision = commit
+	if len(commit) > 8 {
+		info.Revision = commit[:8]
+	}
+
+	if version, err := git(dir, "describe", "--tags", "--always", "--dirty"); err == nil {
+		info.Version = version
+	}
+	if status, err := git(dir, "status", "--porcelain", "--untracked-files=no"); err == nil {
+		info.Dirty = status != ""
+	}
+	if branch := branch(dir); branch != "" {
+		info.Branch = branch
+	}
+	if author, err := git(dir, "show", "-s", "--format=%an <%ae>", "HEAD"); err == nil {
+		info.Author = author
+	}
+	if built, err := git(dir, "show", "-s", "--format=%ct", "HEAD"); err == nil {
+		if sec, err := strconv.ParseInt(built, 10, 64); err == nil {
+			info.Built = builtTime(time.Unix(sec, 0))
+		}
+	}
+
+	return info, nil
+}
+
+// branch returns the checked out branch. With a detached HEAD it falls
+// back to the first local or remote branch pointing at the commit.
+func branch(dir string) string {
+	branch, err := git(dir, "symbolic-ref", "--short", "-q", "HEAD")
+	if err == nil && branch != "" {
+		return branch
+	}
+
+	refs, err := git(dir, "for-each-ref", "--points-at", "HEAD",
+		"--format=%(refname:short)", "refs/heads", "refs/remotes")
+	if err != nil || refs == "" {
+		return ""
+	}
+
+	var names []string
+	for _, ref := range strings.Split(refs, "\n") {
+		if strings.HasSuffix(ref, "/HEAD") {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(ref, "origin/"))
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// builtTime formats the build time, honoring SOURCE_DATE_EPOCH.
+func builtTime(t time.Time) string {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if sec, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			t = time.Unix(sec, 0)
+		}
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func git(dir string, args ...string) (string, error) {
+	var stderr, stdout bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
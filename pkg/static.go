@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"io/ioutil"
+	"strings"
+)
+
+// StaticTags are the build tags of static cgo builds, which replace the
+// lookups of hosts and users through the C library by the pure Go ones,
+// as these need the shared libraries of the system even when linked
+// statically.
+var StaticTags = []string{"netgo", "osusergo"}
+
+// Static reports whether the binary built for platform must be statically
+// linked, which only applies to linux.
+func Static(cfg *config.Config, platform config.Platform) bool {
+	return cfg.Static && platform.OS == "linux"
+}
+
+// staticLdflags asks the external linker of cgo builds for a static binary
+// by adding -static to the -extldflags of fields, the linker flags, or
+// -static-pie for the position-independent executables of pie builds.
+// Executables linked by the go linker are static already, but its
+// position-independent ones need the dynamic loader, so pie builds are
+// linked externally unless fields set a -linkmode.
+func staticLdflags(fields []string, pie bool) []string {
+	flag := "-static"
+	if pie {
+		flag = "-static-pie"
+		linkmode := false
+		for _, f := range fields {
+			linkmode = linkmode || f == "-linkmode" || f == "--linkmode" ||
+				strings.HasPrefix(f, "-linkmode=") || strings.HasPrefix(f, "--linkmode=")
+		}
+		if !linkmode {
+			fields = append(fields, "-linkmode", "external")
+		}
+	}
+
+	for i, f := range fields {
+		switch {
+		case (f == "-extldflags" || f == "--extldflags") && i+1 < len(fields):
+			fields[i+1] = strings.TrimSpace(fields[i+1] + " " + flag)
+			return fields
+		case strings.HasPrefix(f, "-extldflags=") || strings.HasPrefix(f, "--extldflags="):
+			fields[i] = f + " " + flag
+			return fields
+		}
+	}
+
+	return append(fields, "-extldflags", flag)
+}
+
+// CheckStatic checks that the ELF binary at path is statically linked: that
+// it has no program interpreter and doesn't need any shared library.
+func CheckStatic(path string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return fmt.Errorf("checking static linking: %s", err)
+	}
+	defer f.Close()
+
+	var problems []string
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		interp, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return fmt.Errorf("checking static linking: %s", err)
+		}
+		problems = append(problems, "interpreter "+string(bytes.TrimRight(interp, "\x00")))
+	}
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return fmt.Errorf("checking static linking: %s", err)
+	}
+	if len(libs) > 0 {
+		problems = append(problems, "shared libraries "+strings.Join(libs, ", "))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is dynamically linked, with %s", path, strings.Join(problems, " and "))
+	}
+	return nil
+}
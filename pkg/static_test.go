@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStaticLdflags(t *testing.T) {
+	cases := []struct {
+		in   []string
+		pie  bool
+		want []string
+	}{
+		{nil, false, []string{"-extldflags", "-static"}},
+		{[]string{"-s", "-w"}, false, []string{"-s", "-w", "-extldflags", "-static"}},
+		{[]string{"-extldflags", "-L/opt/lib"}, false, []string{"-extldflags", "-L/opt/lib -static"}},
+		{[]string{"-extldflags=-L/opt/lib"}, false, []string{"-extldflags=-L/opt/lib -static"}},
+		{nil, true, []string{"-linkmode", "external", "-extldflags", "-static-pie"}},
+		{[]string{"-extldflags", "-L/opt/lib"}, true, []string{"-extldflags", "-L/opt/lib -static-pie", "-linkmode", "external"}},
+		{[]string{"-linkmode=external"}, true, []string{"-linkmode=external", "-extldflags", "-static-pie"}},
+	}
+
+	for _, tc := range cases {
+		in := append([]string(nil), tc.in...)
+		if got := staticLdflags(in, tc.pie); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("staticLdflags(%q, %v) = %q, want %q", tc.in, tc.pie, got, tc.want)
+		}
+	}
+}
+
+func TestCheckStatic(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the binaries are built for the host")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+		"cgo.go":  "//go:build cgo\n\npackage main\n\n// int answer(void) { return 42; }\nimport \"C\"\n\nvar _ = C.answer()\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(name, cgo string) string {
+		output := filepath.Join(dir, name)
+		cmd := exec.Command("go", "build", "-o", output, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "CGO_ENABLED="+cgo, "GOFLAGS=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("building %s: %s\n%s", name, err, out)
+		}
+		return output
+	}
+
+	if err := CheckStatic(build("static", "0")); err != nil {
+		t.Errorf("static binary: %s", err)
+	}
+
+	// A binary that isn't ELF can't be checked.
+	text := filepath.Join(dir, "main.go")
+	if err := CheckStatic(text); err == nil || !strings.Contains(err.Error(), "checking static linking") {
+		t.Errorf("%s: got error %v", text, err)
+	}
+
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler to build a dynamically linked binary")
+	}
+	dynamic := build("dynamic", "1")
+	err := CheckStatic(dynamic)
+	if err == nil {
+		t.Fatalf("%s passes as static", dynamic)
+	}
+	for _, want := range []string{"is dynamically linked", "interpreter /", "shared libraries ", "libc."} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+}
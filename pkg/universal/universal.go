@@ -0,0 +1,86 @@
+// Package universal merges Mach-O binaries built for several
+// architectures into a universal ("fat") binary, like Apple's lipo, so
+// that a single file runs on both Intel and Apple silicon Macs.
+package universal
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+// fatMagic starts the header of universal binaries.
+const fatMagic = 0xcafebabe
+
+// thin is a single-architecture binary to merge.
+type thin struct {
+	path  string
+	cpu   macho.Cpu
+	sub   uint32
+	data  []byte
+	align uint32
+}
+
+// Merge writes a universal binary of the Mach-O binaries at paths, which
+// must be for different architectures, to output.
+func Merge(output string, paths []string) error {
+	var thins []thin
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		for _, t := range thins {
+			if t.cpu == f.Cpu {
+				return fmt.Errorf("%s and %s are both %s binaries", t.path, path, f.Cpu)
+			}
+		}
+		thins = append(thins, thin{path: path, cpu: f.Cpu, sub: f.SubCpu, data: data, align: alignment(f.Cpu)})
+	}
+	sort.Slice(thins, func(i, j int) bool { return thins[i].cpu < thins[j].cpu })
+
+	// The header is followed by the binaries, each aligned to a page of
+	// its architecture.
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, []uint32{fatMagic, uint32(len(thins))})
+	offset := uint64(8 + 20*len(thins))
+	offsets := make([]uint64, len(thins))
+	for i, t := range thins {
+		offset = (offset + 1<<t.align - 1) &^ (1<<t.align - 1)
+		offsets[i] = offset
+		offset += uint64(len(t.data))
+		if offset > math.MaxUint32 {
+			return fmt.Errorf("the universal binary would be larger than 4GB")
+		}
+		binary.Write(&header, binary.BigEndian, []uint32{
+			uint32(t.cpu), t.sub, uint32(offsets[i]), uint32(len(t.data)), t.align,
+		})
+	}
+
+	data := make([]byte, offset)
+	copy(data, header.Bytes())
+	for i, t := range thins {
+		copy(data[offsets[i]:], t.data)
+	}
+
+	return ioutil.WriteFile(output, data, 0755)
+}
+
+// alignment returns the power of two the offset of a binary for cpu is
+// aligned to, its page size, as lipo does.
+func alignment(cpu macho.Cpu) uint32 {
+	if cpu == macho.CpuArm64 {
+		return 14
+	}
+
+	return 12
+}
@@ -0,0 +1,113 @@
+package universal
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testThin writes a minimal 64-bit Mach-O executable for cpu, without load
+// commands, followed by size bytes of code, and returns its path and data.
+func testThin(t *testing.T, dir string, cpu macho.Cpu, sub uint32, size int) (string, []byte) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{
+		Magic:  macho.Magic64,
+		Cpu:    cpu,
+		SubCpu: sub,
+		Type:   macho.TypeExec,
+	})
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // reserved
+	buf.Write(bytes.Repeat([]byte{0x90}, size))
+
+	path := filepath.Join(dir, cpu.String())
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, buf.Bytes()
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	arm64, arm64Data := testThin(t, dir, macho.CpuArm64, 0, 5000)
+	amd64, amd64Data := testThin(t, dir, macho.CpuAmd64, 3, 100)
+
+	// The order of the paths doesn't matter.
+	output := filepath.Join(dir, "universal")
+	if err := Merge(output, []string{arm64, amd64}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := macho.OpenFat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		cpu    macho.Cpu
+		sub    uint32
+		offset uint32
+		align  uint32
+		data   []byte
+	}{
+		// The header is followed by the binaries in the order of their
+		// CPU types, each aligned to a page of its architecture.
+		{macho.CpuAmd64, 3, 1 << 12, 12, amd64Data},
+		{macho.CpuArm64, 0, 1 << 14, 14, arm64Data},
+	}
+	if len(f.Arches) != len(want) {
+		t.Fatalf("%d architectures, want %d", len(f.Arches), len(want))
+	}
+	for i, w := range want {
+		arch := f.Arches[i]
+		if arch.Cpu != w.cpu || arch.SubCpu != w.sub {
+			t.Errorf("architecture %d is %s/%d, want %s/%d", i, arch.Cpu, arch.SubCpu, w.cpu, w.sub)
+		}
+		if arch.Offset != w.offset || arch.Align != w.align {
+			t.Errorf("%s: offset %d aligned to 2^%d, want %d aligned to 2^%d",
+				w.cpu, arch.Offset, arch.Align, w.offset, w.align)
+		}
+		if arch.Offset%(1<<arch.Align) != 0 {
+			t.Errorf("%s: offset %d isn't aligned to 2^%d", w.cpu, arch.Offset, arch.Align)
+		}
+		if int(arch.Size) != len(w.data) || !bytes.Equal(data[arch.Offset:arch.Offset+arch.Size], w.data) {
+			t.Errorf("%s: the binary isn't copied as is", w.cpu)
+		}
+	}
+	if end := want[1].offset + uint32(len(arm64Data)); len(data) != int(end) {
+		t.Errorf("the file is %d bytes, want %d", len(data), end)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	dir := t.TempDir()
+	amd64, _ := testThin(t, dir, macho.CpuAmd64, 3, 10)
+	notMachO := filepath.Join(dir, "text")
+	if err := ioutil.WriteFile(notMachO, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		paths []string
+		err   string
+	}{
+		{"same architecture", []string{amd64, amd64}, "are both"},
+		{"not Mach-O", []string{amd64, notMachO}, notMachO},
+	}
+
+	for _, tc := range cases {
+		err := Merge(filepath.Join(dir, "universal"), tc.paths)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Package verify checks that a built binary is one for the platform it
+// was built for: that its object format, machine type, bitness and byte
+// order match, so that a stray GOOS or GOARCH in the environment can't
+// pass a host binary off as a foreign one.
+package verify
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"debug/plan9obj"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Binary describes what a binary is built for.
+type Binary struct {
+	// Format is the object format: "elf", "macho", "pe", "plan9" or
+	// "wasm".
+	Format string
+
+	// Machine is the machine type as named by the format, like
+	// "EM_X86_64" or "CpuArm64", the machine types of the architectures
+	// of a universal binary being separated by commas.
+	Machine string
+
+	Bits      int
+	BigEndian bool
+}
+
+// String returns the attributes of the binary, like "elf EM_AARCH64
+// 64-bit little-endian".
+func (b *Binary) String() string {
+	return fmt.Sprintf("%s %s %d-bit %s-endian", b.Format, b.Machine, b.Bits, byteOrder(b.BigEndian))
+}
+
+// Attributes returns the attributes of the binary as name and value pairs.
+func (b *Binary) Attributes() [][2]string {
+	return [][2]string{
+		{"format", b.Format},
+		{"machine", b.Machine},
+		{"bits", fmt.Sprint(b.Bits)},
+		{"byteorder", byteOrder(b.BigEndian)},
+	}
+}
+
+func byteOrder(bigEndian bool) string {
+	if bigEndian {
+		return "big"
+	}
+
+	return "little"
+}
+
+// arch is what the binaries of an architecture are in every format.
+type arch struct {
+	bits      int
+	bigEndian bool
+	elf       elf.Machine
+	macho     macho.Cpu
+	pe        uint16
+	plan9     uint32
+}
+
+// arches are the architectures of the go command, with the machine types
+// of the formats they are built in.
+var arches = map[string]arch{
+	"386":      {bits: 32, elf: elf.EM_386, macho: macho.Cpu386, pe: pe.IMAGE_FILE_MACHINE_I386, plan9: plan9obj.Magic386},
+	"amd64":    {bits: 64, elf: elf.EM_X86_64, macho: macho.CpuAmd64, pe: pe.IMAGE_FILE_MACHINE_AMD64, plan9: plan9obj.MagicAMD64},
+	"arm":      {bits: 32, elf: elf.EM_ARM, macho: macho.CpuArm, pe: pe.IMAGE_FILE_MACHINE_ARMNT, plan9: plan9obj.MagicARM},
+	"arm64":    {bits: 64, elf: elf.EM_AARCH64, macho: macho.CpuArm64, pe: pe.IMAGE_FILE_MACHINE_ARM64},
+	"loong64":  {bits: 64, elf: elf.EM_LOONGARCH, pe: pe.IMAGE_FILE_MACHINE_LOONGARCH64},
+	"mips":     {bits: 32, bigEndian: true, elf: elf.EM_MIPS},
+	"mipsle":   {bits: 32, elf: elf.EM_MIPS},
+	"mips64":   {bits: 64, bigEndian: true, elf: elf.EM_MIPS},
+	"mips64le": {bits: 64, elf: elf.EM_MIPS},
+	"ppc64":    {bits: 64, bigEndian: true, elf: elf.EM_PPC64},
+	"ppc64le":  {bits: 64, elf: elf.EM_PPC64},
+	"riscv64":  {bits: 64, elf: elf.EM_RISCV, pe: pe.IMAGE_FILE_MACHINE_RISCV64},
+	"s390x":    {bits: 64, bigEndian: true, elf: elf.EM_S390},
+	"sparc64":  {bits: 64, bigEndian: true, elf: elf.EM_SPARCV9},
+	"wasm":     {bits: 32},
+}
+
+// peMachines are the names of the PE machine types, which debug/pe lacks.
+var peMachines = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:        "IMAGE_FILE_MACHINE_I386",
+	pe.IMAGE_FILE_MACHINE_AMD64:       "IMAGE_FILE_MACHINE_AMD64",
+	pe.IMAGE_FILE_MACHINE_ARMNT:       "IMAGE_FILE_MACHINE_ARMNT",
+	pe.IMAGE_FILE_MACHINE_ARM64:       "IMAGE_FILE_MACHINE_ARM64",
+	pe.IMAGE_FILE_MACHINE_LOONGARCH64: "IMAGE_FILE_MACHINE_LOONGARCH64",
+	pe.IMAGE_FILE_MACHINE_RISCV64:     "IMAGE_FILE_MACHINE_RISCV64",
+}
+
+// Format returns the object format of the binaries of goos, or empty for
+// the formats that aren't checked, like AIX's XCOFF.
+func Format(goos string) string {
+	switch goos {
+	case "aix":
+		return ""
+	case "darwin", "ios":
+		return "macho"
+	case "windows":
+		return "pe"
+	case "plan9":
+		return "plan9"
+	case "js", "wasip1":
+		return "wasm"
+	}
+
+	return "elf"
+}
+
+// File reads the binary at path, built for goos and goarch, and checks
+// that it is one for them. The universal binaries of darwin, whose goarch
+// is "universal", must hold the amd64 and arm64 architectures. The binary
+// is returned along with the error when it is for another platform, and
+// nil when the format of goos isn't checked.
+func File(path, goos, goarch string) (*Binary, error) {
+	format := Format(goos)
+	if format == "" {
+		return nil, nil
+	}
+
+	b, err := read(path)
+	if err != nil {
+		return nil, fmt.Errorf("verifying %s: %s", path, err)
+	}
+	if err := check(b, format, goos, goarch); err != nil {
+		return b, fmt.Errorf("%s is not for %s/%s (%s): %s", path, goos, goarch, b.String(), err)
+	}
+
+	return b, nil
+}
+
+// check checks that b is a binary in format for goos and goarch.
+func check(b *Binary, format, goos, goarch string) error {
+	if b.Format != format {
+		return fmt.Errorf("expected %s format", format)
+	}
+	if goos == "darwin" && goarch == "universal" {
+		if want := macho.CpuAmd64.String() + "," + macho.CpuArm64.String(); b.Machine != want {
+			return fmt.Errorf("expected the %s machine types", want)
+		}
+		return nil
+	}
+
+	a, ok := arches[goarch]
+	if !ok {
+		return fmt.Errorf("unknown architecture")
+	}
+	if want := a.machine(format); b.Machine != want {
+		return fmt.Errorf("expected machine type %s", want)
+	}
+	if b.Bits != a.bits {
+		return fmt.Errorf("expected %d-bit", a.bits)
+	}
+	if b.BigEndian != a.bigEndian {
+		return fmt.Errorf("expected %s-endian", byteOrder(a.bigEndian))
+	}
+
+	return nil
+}
+
+// machine returns the name of the machine type of the architecture in
+// format.
+func (a *arch) machine(format string) string {
+	switch format {
+	case "elf":
+		return a.elf.String()
+	case "macho":
+		return a.macho.String()
+	case "pe":
+		return peMachine(a.pe)
+	case "plan9":
+		return plan9Machine(a.plan9)
+	}
+
+	return "wasm"
+}
+
+// read reads the format and attributes of the binary at path.
+func read(path string) (*Binary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, fmt.Errorf("unknown format")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("\x7fELF")):
+		return readELF(f)
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return readPE(f)
+	case bytes.HasPrefix(magic, []byte("\x00asm")):
+		if binary.LittleEndian.Uint32(magic[4:]) != 1 {
+			return nil, fmt.Errorf("unknown WebAssembly version %d", binary.LittleEndian.Uint32(magic[4:]))
+		}
+		return &Binary{Format: "wasm", Machine: "wasm", Bits: 32}, nil
+	}
+
+	switch binary.BigEndian.Uint32(magic) {
+	case macho.Magic32, macho.Magic64, 0xcefaedfe, 0xcffaedfe:
+		return readMachO(f)
+	case macho.MagicFat:
+		return readFat(f)
+	}
+	if b, err := readPlan9(f); err == nil {
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unknown format")
+}
+
+func readELF(r io.ReaderAt) (*Binary, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binary{Format: "elf", Machine: f.Machine.String(), Bits: 32, BigEndian: f.ByteOrder == binary.BigEndian}
+	if f.Class == elf.ELFCLASS64 {
+		b.Bits = 64
+	}
+	return b, nil
+}
+
+func readPE(r io.ReaderAt) (*Binary, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binary{Format: "pe", Machine: peMachine(f.Machine), Bits: 32}
+	if _, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
+		b.Bits = 64
+	}
+	return b, nil
+}
+
+func readMachO(r io.ReaderAt) (*Binary, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binary{Format: "macho", Machine: f.Cpu.String(), Bits: 32, BigEndian: f.ByteOrder == binary.BigEndian}
+	if f.Magic == macho.Magic64 {
+		b.Bits = 64
+	}
+	return b, nil
+}
+
+// readFat reads a universal binary, which is 64-bit when all of its
+// architectures are.
+func readFat(r io.ReaderAt) (*Binary, error) {
+	f, err := macho.NewFatFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binary{Format: "macho", Bits: 64}
+	var cpus []string
+	for _, a := range f.Arches {
+		cpus = append(cpus, a.Cpu.String())
+		if a.Magic != macho.Magic64 {
+			b.Bits = 32
+		}
+	}
+	b.Machine = strings.Join(cpus, ",")
+	return b, nil
+}
+
+func readPlan9(r io.ReaderAt) (*Binary, error) {
+	f, err := plan9obj.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is big-endian whatever the architecture, while those
+	// of the go command are all little-endian.
+	b := &Binary{Format: "plan9", Machine: plan9Machine(f.Magic), Bits: 32}
+	if f.Magic&plan9obj.Magic64 != 0 {
+		b.Bits = 64
+	}
+	return b, nil
+}
+
+// peMachine returns the name of a PE machine type.
+func peMachine(machine uint16) string {
+	if name, ok := peMachines[machine]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%x", machine)
+}
+
+// plan9Machine returns the name of the magic number of a Plan 9 binary,
+// which tells its architecture.
+func plan9Machine(magic uint32) string {
+	switch magic {
+	case plan9obj.Magic386:
+		return "Magic386"
+	case plan9obj.MagicAMD64:
+		return "MagicAMD64"
+	case plan9obj.MagicARM:
+		return "MagicARM"
+	}
+
+	return fmt.Sprintf("0x%x", magic)
+}
@@ -0,0 +1,98 @@
+package verify
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtures builds a tiny program for each of the platforms, returning the
+// binaries by os/arch.
+func fixtures(t *testing.T, platforms ...string) map[string]string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	binaries := make(map[string]string)
+	for _, platform := range platforms {
+		parts := strings.SplitN(platform, "/", 2)
+		output := filepath.Join(dir, parts[0]+"_"+parts[1])
+		cmd := exec.Command("go", "build", "-o", output, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS="+parts[0], "GOARCH="+parts[1], "CGO_ENABLED=0", "GOFLAGS=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("building for %s: %s\n%s", platform, err, out)
+		}
+		binaries[platform] = output
+	}
+
+	return binaries
+}
+
+func TestFile(t *testing.T) {
+	binaries := fixtures(t, "linux/amd64", "linux/386", "linux/mips64", "windows/amd64", "darwin/arm64")
+	text := filepath.Join(t.TempDir(), "app")
+	if err := ioutil.WriteFile(text, []byte("#!/bin/sh\necho app\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	binaries["text"] = text
+
+	cases := []struct {
+		binary   string
+		platform string
+		err      string
+	}{
+		{"linux/amd64", "linux/amd64", ""},
+		{"windows/amd64", "windows/amd64", ""},
+		{"darwin/arm64", "darwin/arm64", ""},
+
+		// Another architecture.
+		{"linux/amd64", "linux/arm64", "expected machine type EM_AARCH64"},
+		{"linux/386", "linux/amd64", "expected machine type EM_X86_64"},
+		{"darwin/arm64", "darwin/amd64", "expected machine type CpuAmd64"},
+		{"darwin/arm64", "darwin/universal", "expected the CpuAmd64,CpuArm64 machine types"},
+
+		// The same machine type, with another byte order or bitness.
+		{"linux/mips64", "linux/mips64le", "expected little-endian"},
+		{"linux/mips64", "linux/mips", "expected 32-bit"},
+
+		// Another OS.
+		{"linux/amd64", "windows/amd64", "expected pe format"},
+		{"windows/amd64", "linux/amd64", "expected elf format"},
+		{"linux/amd64", "darwin/amd64", "expected macho format"},
+
+		{"text", "linux/amd64", "unknown format"},
+	}
+
+	for _, tc := range cases {
+		parts := strings.SplitN(tc.platform, "/", 2)
+		b, err := File(binaries[tc.binary], parts[0], parts[1])
+		if tc.err == "" {
+			if err != nil || b == nil {
+				t.Errorf("%s as %s: %v", tc.binary, tc.platform, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s as %s: got error %v, want %q", tc.binary, tc.platform, err, tc.err)
+		}
+	}
+
+	// Formats that aren't checked pass.
+	if b, err := File(binaries["linux/amd64"], "aix", "ppc64"); b != nil || err != nil {
+		t.Errorf("aix/ppc64: got %v, %v, want no check", b, err)
+	}
+}
@@ -0,0 +1,146 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// VersionInfo is the version information shown in the properties of the
+// executable and read by software inventory tools. FileVersion and
+// ProductVersion are shown as is, and their leading numbers, like 1.2.3
+// in "v1.2.3-4-gabcdef", are also the numeric versions.
+type VersionInfo struct {
+	FileVersion      string
+	ProductVersion   string
+	CompanyName      string
+	FileDescription  string
+	InternalName     string
+	LegalCopyright   string
+	LegalTrademarks  string
+	OriginalFilename string
+	ProductName      string
+	Comments         string
+}
+
+// stringTable returns the names and values of the strings of the version
+// information, leaving out the empty ones.
+func (v *VersionInfo) stringTable() [][2]string {
+	all := [][2]string{
+		{"Comments", v.Comments},
+		{"CompanyName", v.CompanyName},
+		{"FileDescription", v.FileDescription},
+		{"FileVersion", v.FileVersion},
+		{"InternalName", v.InternalName},
+		{"LegalCopyright", v.LegalCopyright},
+		{"LegalTrademarks", v.LegalTrademarks},
+		{"OriginalFilename", v.OriginalFilename},
+		{"ProductName", v.ProductName},
+		{"ProductVersion", v.ProductVersion},
+	}
+
+	var result [][2]string
+	for _, s := range all {
+		if s[1] != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// bytes returns the VS_VERSIONINFO structure of the version information,
+// with the strings in a single table for U.S. English and Unicode.
+func (v *VersionInfo) bytes() []byte {
+	file := NumericVersion(v.FileVersion)
+	product := NumericVersion(v.ProductVersion)
+
+	var fixed bytes.Buffer
+	binary.Write(&fixed, binary.LittleEndian, []uint32{
+		0xfeef04bd, // signature
+		0x00010000, // structure version
+		uint32(file[0])<<16 | uint32(file[1]),
+		uint32(file[2])<<16 | uint32(file[3]),
+		uint32(product[0])<<16 | uint32(product[1]),
+		uint32(product[2])<<16 | uint32(product[3]),
+		0x3f,    // VS_FFI_FILEFLAGSMASK
+		0,       // flags
+		0x40004, // VOS_NT_WINDOWS32
+		1,       // VFT_APP
+		0,       // subtype
+		0, 0,    // date
+	})
+
+	var strs [][]byte
+	for _, s := range v.stringTable() {
+		value := utf16String(s[1])
+		strs = append(strs, versionBlock(s[0], uint16(len(value)/2), 1, value))
+	}
+	table := versionBlock("040904b0", 0, 1, nil, strs...)
+	stringInfo := versionBlock("StringFileInfo", 0, 1, nil, table)
+
+	translation := []byte{0x09, 0x04, 0xb0, 0x04}
+	varInfo := versionBlock("VarFileInfo", 0, 1, nil,
+		versionBlock("Translation", uint16(len(translation)), 0, translation))
+
+	return versionBlock("VS_VERSION_INFO", uint16(fixed.Len()), 0, fixed.Bytes(), stringInfo, varInfo)
+}
+
+// versionBlock returns a block of the version information: its length,
+// the length and type, 0 for binary and 1 for text, of its value, its key,
+// its value and its children, each aligned to 32 bits.
+func versionBlock(key string, valueLength, typ uint16, value []byte, children ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, valueLength, typ})
+	buf.Write(utf16String(key))
+	pad(&buf)
+	buf.Write(value)
+	for _, child := range children {
+		pad(&buf)
+		buf.Write(child)
+	}
+
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	return b
+}
+
+// utf16String returns s in UTF-16, with the terminating NUL.
+func utf16String(s string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, utf16.Encode([]rune(s+"\x00")))
+	return buf.Bytes()
+}
+
+// pad aligns buf to 32 bits.
+func pad(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// NumericVersion returns the four numbers of the version v, taken from its
+// leading dot-separated numbers after an optional "v", the missing ones
+// being 0.
+func NumericVersion(v string) [4]uint16 {
+	var numbers [4]uint16
+	v = strings.TrimPrefix(v, "v")
+	for i := range numbers {
+		end := 0
+		for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+			end++
+		}
+		n, err := strconv.ParseUint(v[:end], 10, 16)
+		if err != nil {
+			break
+		}
+		numbers[i] = uint16(n)
+		if end == len(v) || v[end] != '.' {
+			break
+		}
+		v = v[end+1:]
+	}
+
+	return numbers
+}
@@ -0,0 +1,274 @@
+// Package winres writes Windows resources, the version information, icon
+// and application manifest of an executable, as a COFF object that the go
+// command links into windows binaries when it finds it as a .syso file in
+// the package being built.
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Resource types, and the language of the resources: U.S. English, which
+// Windows falls back to.
+const (
+	typeIcon      = 3
+	typeGroupIcon = 14
+	typeVersion   = 16
+	typeManifest  = 24
+
+	langEnUS = 0x0409
+)
+
+// machines are the COFF machine types of the windows architectures, and
+// relocations the type of their image-relative relocations, which point
+// the resource data entries at the data.
+var (
+	machines = map[string]uint16{
+		"386":   0x14c,
+		"amd64": 0x8664,
+		"arm":   0x1c4,
+		"arm64": 0xaa64,
+	}
+	relocations = map[string]uint16{
+		"386":   0x7, // IMAGE_REL_I386_DIR32NB
+		"amd64": 0x3, // IMAGE_REL_AMD64_ADDR32NB
+		"arm":   0x2, // IMAGE_REL_ARM_ADDR32NB
+		"arm64": 0x2, // IMAGE_REL_ARM64_ADDR32NB
+	}
+)
+
+// Resources are the resources of an executable. Icon is the contents of a
+// .ico file and Manifest of an application manifest, either can be empty.
+type Resources struct {
+	Version  VersionInfo
+	Icon     []byte
+	Manifest []byte
+}
+
+// ValidArch reports whether resources can be written for the windows
+// architecture arch.
+func ValidArch(arch string) bool {
+	_, ok := machines[arch]
+	return ok
+}
+
+// resource is a single resource of the object.
+type resource struct {
+	typ  uint16
+	id   uint16
+	data []byte
+}
+
+// Object returns the COFF object of the resources for the windows
+// architecture arch.
+func Object(arch string, r *Resources) ([]byte, error) {
+	machine, ok := machines[arch]
+	if !ok {
+		return nil, fmt.Errorf("no resources for windows/%s", arch)
+	}
+
+	resources := []resource{{typ: typeVersion, id: 1, data: r.Version.bytes()}}
+	if len(r.Icon) > 0 {
+		icons, group, err := readIcon(r.Icon)
+		if err != nil {
+			return nil, err
+		}
+		for i, icon := range icons {
+			resources = append(resources, resource{typ: typeIcon, id: uint16(i + 1), data: icon})
+		}
+		resources = append(resources, resource{typ: typeGroupIcon, id: 1, data: group})
+	}
+	if len(r.Manifest) > 0 {
+		resources = append(resources, resource{typ: typeManifest, id: 1, data: r.Manifest})
+	}
+
+	section, relocs := resourceSection(resources)
+
+	// The section is followed by its relocations and the symbol table,
+	// holding the section symbol they refer to, and the empty string
+	// table.
+	const headers = 20 + 40
+	relocsOffset := headers + len(section)
+	symbolsOffset := relocsOffset + 10*len(relocs)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Machine              uint16
+		NumberOfSections     uint16
+		TimeDateStamp        uint32
+		PointerToSymbolTable uint32
+		NumberOfSymbols      uint32
+		SizeOfOptionalHeader uint16
+		Characteristics      uint16
+	}{machine, 1, 0, uint32(symbolsOffset), 1, 0, 0})
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Name                 [8]byte
+		VirtualSize          uint32
+		VirtualAddress       uint32
+		SizeOfRawData        uint32
+		PointerToRawData     uint32
+		PointerToRelocations uint32
+		PointerToLineNumbers uint32
+		NumberOfRelocations  uint16
+		NumberOfLineNumbers  uint16
+		Characteristics      uint32
+	}{
+		Name:                 [8]byte{'.', 'r', 's', 'r', 'c'},
+		SizeOfRawData:        uint32(len(section)),
+		PointerToRawData:     headers,
+		PointerToRelocations: uint32(relocsOffset),
+		NumberOfRelocations:  uint16(len(relocs)),
+		// IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+		Characteristics: 0x40000040,
+	})
+	buf.Write(section)
+	for _, offset := range relocs {
+		binary.Write(&buf, binary.LittleEndian, struct {
+			VirtualAddress   uint32
+			SymbolTableIndex uint32
+			Type             uint16
+		}{offset, 0, relocations[arch]})
+	}
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Name               [8]byte
+		Value              uint32
+		SectionNumber      int16
+		Type               uint16
+		StorageClass       uint8
+		NumberOfAuxSymbols uint8
+	}{
+		Name:          [8]byte{'.', 'r', 's', 'r', 'c'},
+		SectionNumber: 1,
+		// IMAGE_SYM_CLASS_STATIC
+		StorageClass: 3,
+	})
+	binary.Write(&buf, binary.LittleEndian, uint32(4))
+
+	return buf.Bytes(), nil
+}
+
+// resourceSection lays out the resources in a .rsrc section: the tree of
+// resource directories, by type, ID and language, followed by the data
+// entries and the data. It returns the section along with the offsets of
+// the data addresses of the entries, which are relative to the image and
+// need relocating.
+func resourceSection(resources []resource) ([]byte, []uint32) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].typ != resources[j].typ {
+			return resources[i].typ < resources[j].typ
+		}
+		return resources[i].id < resources[j].id
+	})
+
+	var types []uint16
+	byType := make(map[uint16][]resource)
+	for _, r := range resources {
+		if len(byType[r.typ]) == 0 {
+			types = append(types, r.typ)
+		}
+		byType[r.typ] = append(byType[r.typ], r)
+	}
+
+	// Every directory is a header followed by its 8 byte entries.
+	dirSize := func(entries int) int { return 16 + 8*entries }
+	size := dirSize(len(types))
+	typeDirs := make([]int, len(types))
+	for i, typ := range types {
+		typeDirs[i] = size
+		size += dirSize(len(byType[typ]))
+	}
+	langDirs := make([]int, len(resources))
+	for i := range resources {
+		langDirs[i] = size
+		size += dirSize(1)
+	}
+	entries := make([]int, len(resources))
+	for i := range resources {
+		entries[i] = size
+		size += 16
+	}
+	data := make([]int, len(resources))
+	for i, r := range resources {
+		size = align(size, 8)
+		data[i] = size
+		size += len(r.data)
+	}
+
+	section := make([]byte, size)
+	le := binary.LittleEndian
+	dir := func(offset, entries int) {
+		le.PutUint16(section[offset+14:], uint16(entries))
+	}
+	entry := func(dirOffset, i int, id uint16, offset int, subdir bool) {
+		p := section[dirOffset+16+8*i:]
+		le.PutUint32(p, uint32(id))
+		if subdir {
+			offset |= 1 << 31
+		}
+		le.PutUint32(p[4:], uint32(offset))
+	}
+
+	dir(0, len(types))
+	n := 0
+	relocs := make([]uint32, len(resources))
+	for i, typ := range types {
+		entry(0, i, typ, typeDirs[i], true)
+		dir(typeDirs[i], len(byType[typ]))
+		for j, r := range byType[typ] {
+			entry(typeDirs[i], j, r.id, langDirs[n], true)
+			dir(langDirs[n], 1)
+			entry(langDirs[n], 0, langEnUS, entries[n], false)
+
+			p := section[entries[n]:]
+			le.PutUint32(p, uint32(data[n]))
+			le.PutUint32(p[4:], uint32(len(r.data)))
+			relocs[n] = uint32(entries[n])
+			copy(section[data[n]:], r.data)
+			n++
+		}
+	}
+
+	return section, relocs
+}
+
+// readIcon splits a .ico file into the images of its sizes, stored as
+// separate icon resources, and the icon group resource listing them,
+// whose entries refer to the images by ID, starting at 1.
+func readIcon(ico []byte) ([][]byte, []byte, error) {
+	le := binary.LittleEndian
+	if len(ico) < 6 || le.Uint16(ico) != 0 || le.Uint16(ico[2:]) != 1 {
+		return nil, nil, fmt.Errorf("icon is not an .ico file")
+	}
+	count := int(le.Uint16(ico[4:]))
+	if count == 0 || len(ico) < 6+16*count {
+		return nil, nil, fmt.Errorf("icon has no images")
+	}
+
+	group := make([]byte, 6+14*count)
+	copy(group, ico[:6])
+	var images [][]byte
+	for i := 0; i < count; i++ {
+		e := ico[6+16*i:]
+		size, offset := le.Uint32(e[8:]), le.Uint32(e[12:])
+		if uint64(offset)+uint64(size) > uint64(len(ico)) {
+			return nil, nil, fmt.Errorf("icon image %d is truncated", i+1)
+		}
+		images = append(images, ico[offset:offset+size])
+
+		// The entries keep the size, colors, planes, bit count and
+		// length of the image, with the ID in place of the offset.
+		g := group[6+14*i:]
+		copy(g, e[:12])
+		le.PutUint16(g[12:], uint16(i+1))
+	}
+
+	return images, group, nil
+}
+
+// align rounds n up to a multiple of a.
+func align(n, a int) int {
+	return (n + a - 1) &^ (a - 1)
+}
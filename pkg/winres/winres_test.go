@@ -0,0 +1,184 @@
+package winres
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// testBlock is a decoded block of the version information.
+type testBlock struct {
+	key      string
+	typ      uint16
+	value    []byte
+	children []testBlock
+}
+
+// readBlock decodes the version information block at the start of b.
+func readBlock(t *testing.T, b []byte) testBlock {
+	le := binary.LittleEndian
+	length, valueLength, typ := int(le.Uint16(b)), int(le.Uint16(b[2:])), le.Uint16(b[4:])
+	if length > len(b) {
+		t.Fatalf("block of %d bytes in %d", length, len(b))
+	}
+	b = b[:length]
+
+	var key []uint16
+	i := 6
+	for ; le.Uint16(b[i:]) != 0; i += 2 {
+		key = append(key, le.Uint16(b[i:]))
+	}
+	i = align(i+2, 4)
+
+	block := testBlock{key: string(utf16.Decode(key)), typ: typ}
+	if typ == 1 {
+		valueLength *= 2
+	}
+	block.value = b[i : i+valueLength]
+	for i = align(i+valueLength, 4); i < len(b); {
+		child := readBlock(t, b[i:])
+		block.children = append(block.children, child)
+		i = align(i+int(le.Uint16(b[i:])), 4)
+	}
+
+	return block
+}
+
+// readResource returns the data of the resource of type typ and ID id of
+// the object, following the directories of its .rsrc section and the
+// relocation of its data entry.
+func readResource(t *testing.T, object []byte, typ, id uint16) []byte {
+	f, err := pe.NewFile(bytes.NewReader(object))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Section(".rsrc")
+	if s == nil {
+		t.Fatal("no .rsrc section")
+	}
+	section, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	le := binary.LittleEndian
+	lookup := func(dir int, id uint32) int {
+		n := int(le.Uint16(section[dir+12:])) + int(le.Uint16(section[dir+14:]))
+		for i := 0; i < n; i++ {
+			e := section[dir+16+8*i:]
+			if le.Uint32(e) == id {
+				return int(le.Uint32(e[4:]) &^ (1 << 31))
+			}
+		}
+		t.Fatalf("no entry %d in the directory at %d", id, dir)
+		return 0
+	}
+	entry := lookup(lookup(lookup(0, uint32(typ)), uint32(id)), langEnUS)
+
+	// The data address is relative to the image, the section starting at
+	// 0 in the object.
+	relocated := false
+	for _, r := range s.Relocs {
+		relocated = relocated || int(r.VirtualAddress) == entry
+	}
+	if !relocated {
+		t.Errorf("the data entry at %d isn't relocated", entry)
+	}
+	offset, size := le.Uint32(section[entry:]), le.Uint32(section[entry+4:])
+	return section[offset : offset+size]
+}
+
+func TestObjectVersion(t *testing.T) {
+	v := VersionInfo{
+		FileVersion:      "v1.2.3-4-gabcdef",
+		ProductVersion:   "2.0",
+		CompanyName:      "Example Corp",
+		ProductName:      "App",
+		OriginalFilename: "app.exe",
+	}
+	object, err := Object("amd64", &Resources{Version: v, Manifest: []byte("<assembly/>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if machine := binary.LittleEndian.Uint16(object); machine != pe.IMAGE_FILE_MACHINE_AMD64 {
+		t.Errorf("machine %#x", machine)
+	}
+	if manifest := readResource(t, object, typeManifest, 1); string(manifest) != "<assembly/>" {
+		t.Errorf("manifest %q", manifest)
+	}
+
+	info := readBlock(t, readResource(t, object, typeVersion, 1))
+	if info.key != "VS_VERSION_INFO" {
+		t.Fatalf("key %q", info.key)
+	}
+	var fixed struct {
+		Signature, StrucVersion                    uint32
+		FileVersionMS, FileVersionLS               uint32
+		ProductVersionMS, ProductVersionLS         uint32
+		FileFlagsMask, FileFlags, FileOS, FileType uint32
+	}
+	if err := binary.Read(bytes.NewReader(info.value), binary.LittleEndian, &fixed); err != nil {
+		t.Fatal(err)
+	}
+	if fixed.Signature != 0xfeef04bd {
+		t.Errorf("signature %#x", fixed.Signature)
+	}
+	if fixed.FileVersionMS != 1<<16|2 || fixed.FileVersionLS != 3<<16 {
+		t.Errorf("file version %#x %#x, want 1.2.3.0", fixed.FileVersionMS, fixed.FileVersionLS)
+	}
+	if fixed.ProductVersionMS != 2<<16 || fixed.ProductVersionLS != 0 {
+		t.Errorf("product version %#x %#x, want 2.0.0.0", fixed.ProductVersionMS, fixed.ProductVersionLS)
+	}
+
+	if len(info.children) != 2 || info.children[0].key != "StringFileInfo" || info.children[1].key != "VarFileInfo" {
+		t.Fatalf("children %v", info.children)
+	}
+	tables := info.children[0].children
+	if len(tables) != 1 || tables[0].key != "040904b0" {
+		t.Fatalf("string tables %v", tables)
+	}
+	strs := make(map[string]string)
+	for _, s := range tables[0].children {
+		if s.typ != 1 {
+			t.Errorf("%s: type %d, want text", s.key, s.typ)
+		}
+		u := make([]uint16, len(s.value)/2)
+		binary.Read(bytes.NewReader(s.value), binary.LittleEndian, u)
+		strs[s.key] = string(utf16.Decode(u))
+	}
+	want := map[string]string{
+		"FileVersion":      "v1.2.3-4-gabcdef\x00",
+		"ProductVersion":   "2.0\x00",
+		"CompanyName":      "Example Corp\x00",
+		"ProductName":      "App\x00",
+		"OriginalFilename": "app.exe\x00",
+	}
+	if !reflect.DeepEqual(strs, want) {
+		t.Errorf("strings %q, want %q", strs, want)
+	}
+
+	translation := info.children[1].children
+	if len(translation) != 1 || !bytes.Equal(translation[0].value, []byte{0x09, 0x04, 0xb0, 0x04}) {
+		t.Errorf("translation %v", translation)
+	}
+}
+
+func TestNumericVersion(t *testing.T) {
+	cases := map[string][4]uint16{
+		"1.2.3":            {1, 2, 3, 0},
+		"v1.2.3-4-gabcdef": {1, 2, 3, 0},
+		"1.2.3.4.5":        {1, 2, 3, 4},
+		"v2":               {2, 0, 0, 0},
+		"dev":              {0, 0, 0, 0},
+		"":                 {0, 0, 0, 0},
+	}
+
+	for v, want := range cases {
+		if got := NumericVersion(v); got != want {
+			t.Errorf("%q: %v, want %v", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/mitchellh/gox/pkg/config"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// zigArches are the zig names of the architectures.
+var zigArches = map[string]string{
+	"386":      "x86",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64":    "powerpc64",
+	"ppc64le":  "powerpc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// zigLibc matches the values of cfg.CgoLibc: glibc, optionally with the
+// version to link against, or musl.
+var zigLibc = regexp.MustCompile(`^(gnu(\.[0-9]+\.[0-9]+)?|musl)$`)
+
+// zigTarget returns the zig target triple of platform, like
+// "aarch64-linux-gnu.2.28", the C library of linux targets being libc:
+// "gnu" by default, "gnu.X.Y" for a glibc version or "musl".
+func zigTarget(platform config.Platform, libc, goarm, gomips string) (string, error) {
+	arch, ok := zigArches[platform.Arch]
+	if libc == "" {
+		libc = "gnu"
+	}
+	if !zigLibc.MatchString(libc) {
+		return "", fmt.Errorf("invalid C library %q, should be gnu, gnu.X.Y like gnu.2.17 or musl", libc)
+	}
+
+	switch {
+	case !ok:
+	case platform.OS == "linux":
+		// The C library comes first, followed by the ABI variant and by
+		// the glibc version.
+		name, version := libc, ""
+		if i := strings.Index(libc, "."); i >= 0 {
+			name, version = libc[:i], libc[i:]
+		}
+		abi := ""
+		switch platform.Arch {
+		case "arm":
+			abi = "eabihf"
+			if strings.HasPrefix(goarm, "5") {
+				abi = "eabi"
+			}
+		case "mips", "mipsle":
+			abi = "eabihf"
+			if gomips == "softfloat" {
+				abi = "eabi"
+			}
+		case "mips64", "mips64le":
+			abi = "abi64"
+		}
+		return arch + "-linux-" + name + abi + version, nil
+	case platform.OS == "windows" && platform.Arch != "arm":
+		return arch + "-windows-gnu", nil
+	case platform.OS == "darwin" && (platform.Arch == "amd64" || platform.Arch == "arm64"):
+		return arch + "-macos", nil
+	}
+
+	return "", fmt.Errorf("zig has no target for %s", platform.String())
+}
+
+// zigToolchain returns the variables setting the C toolchain of a cgo
+// build for platform to "zig cc", bar the CXX and AR set in cfg.Env.
+func zigToolchain(cfg *config.Config, platform config.Platform) ([]string, error) {
+	if _, err := exec.LookPath("zig"); err != nil {
+		return nil, fmt.Errorf("zig not found on the PATH, install it to build with --cgo-toolchain zig")
+	}
+
+	// zig only links musl statically.
+	libc := cfg.CgoLibc
+	if Static(cfg, platform) {
+		if libc != "" && libc != "musl" {
+			return nil, fmt.Errorf("static builds with zig need musl, not %s", libc)
+		}
+		libc = "musl"
+	}
+
+	target, err := zigTarget(platform, libc, cfg.Getenv("GOARM"), cfg.Getenv("GOMIPS"))
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{"CC=zig cc -target " + target}
+	if _, ok := cfg.LookupEnv("CXX"); !ok {
+		env = append(env, "CXX=zig c++ -target "+target)
+	}
+	if _, ok := cfg.LookupEnv("AR"); !ok {
+		env = append(env, "AR=zig ar")
+	}
+	return env, nil
+}